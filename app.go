@@ -2,29 +2,45 @@ package tofu
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 
 	"github.com/WojciechWiderski/tofu/tconfig"
 	"github.com/WojciechWiderski/tofu/tdatabase"
+	"github.com/WojciechWiderski/tofu/tdatabase/memory"
+	"github.com/WojciechWiderski/tofu/tdatabase/migration"
 	"github.com/WojciechWiderski/tofu/tdatabase/mysql"
+	"github.com/WojciechWiderski/tofu/tdatabase/postgres"
+	"github.com/WojciechWiderski/tofu/tdatabase/sqlite"
+	"github.com/WojciechWiderski/tofu/terror"
 	"github.com/WojciechWiderski/tofu/thelpers"
 	"github.com/WojciechWiderski/tofu/thttp"
 	"github.com/WojciechWiderski/tofu/tlogger"
+	"github.com/WojciechWiderski/tofu/tmetrics"
 	"github.com/WojciechWiderski/tofu/tmodel"
 	"github.com/WojciechWiderski/tofu/tqueue"
+	"github.com/WojciechWiderski/tofu/ttrace"
 )
 
 type Tofu struct {
 	CTX context.Context
 
-	graceful   *thelpers.Graceful
-	appConfig  tconfig.App
-	corsConfig tconfig.Cors
+	Lifecycle   *thelpers.Lifecycle
+	Config      tconfig.Config
+	appConfig   tconfig.App
+	corsConfig  tconfig.Cors
+	httpOptions []func(*thttp.HttpAPI)
+	apiKeys     *thttp.APIKeys
 
 	Models     *tmodel.Models
 	HTTPServer *http.Server
 	DB         tdatabase.DBOperations
+	Migrator   *migration.Migrator
+
+	metrics bool
+	tracing bool
 
 	MQTT *tqueue.MQTT
 }
@@ -35,7 +51,7 @@ func New(opts ...func(tofu *Tofu)) *Tofu {
 
 	tf.Models = tmodel.NewModels()
 
-	tf.graceful = thelpers.NewGraceful(thelpers.StopSignal())
+	tf.Lifecycle = thelpers.NewLifecycle()
 
 	for _, opt := range opts {
 		opt(tf)
@@ -44,12 +60,80 @@ func New(opts ...func(tofu *Tofu)) *Tofu {
 	return tf
 }
 
+// WithConfigFile loads tconfig.Config from path, TOFU_ environment variables and opts, e.g.
+// tconfig.WithArgs(os.Args[1:]) or tconfig.WithSection for app sections, then applies the configured
+// sections: the logger, the first of mysql, postgres and sqlite, the http server and the mqtt broker.
+// Pass it first so later options override it.
+func WithConfigFile(path string, opts ...tconfig.Option) func(*Tofu) {
+	return func(tofu *Tofu) {
+		opts = append([]tconfig.Option{tconfig.WithFile(path), tconfig.WithEnv("TOFU")}, opts...)
+		if err := tconfig.Load(&tofu.Config, opts...); err != nil {
+			panic(terror.Wrap("tconfig.Load", terror.NewBadRequest(err.Error())))
+		}
+
+		config := tofu.Config
+		tofu.appConfig = config.App
+		if config.App.ShutdownTimeout > 0 {
+			tofu.Lifecycle.StopTimeout = config.App.ShutdownTimeout
+		}
+		WithLogger(config.Logger)(tofu)
+		switch {
+		case config.MySql.Address != "":
+			WithMySQLDB(config.MySql)(tofu)
+		case config.Postgres.Host != "":
+			WithPostgresDB(config.Postgres)(tofu)
+		case config.SQLite.Path != "" || config.SQLite.InMemory:
+			WithSQLiteDB(config.SQLite)(tofu)
+		}
+		if config.HTTP.Port != "" {
+			WithHTTPServer(config.HTTP, config.Cors)(tofu)
+		}
+		if config.MQTT.Broker != "" {
+			WithMQTTBroker(config.MQTT)(tofu)
+		}
+	}
+}
+
+// WithLogger configures tlogger, pass it first so the other options log with it.
+func WithLogger(config tconfig.Logger) func(*Tofu) {
+	return func(tofu *Tofu) {
+		if err := tlogger.Configure(config); err != nil {
+			panic(terror.Wrap("tlogger.Configure", terror.NewBadRequest(err.Error())))
+		}
+	}
+}
+
 func WithMySQLDB(config tconfig.MySql) func(*Tofu) {
 	return func(tofu *Tofu) {
 		tofu.DB = mysql.New(config, tofu.Models)
 	}
 }
 
+func WithPostgresDB(config tconfig.Postgres) func(*Tofu) {
+	return func(tofu *Tofu) {
+		tofu.DB = postgres.New(config, tofu.Models)
+	}
+}
+
+func WithSQLiteDB(config tconfig.SQLite) func(*Tofu) {
+	return func(tofu *Tofu) {
+		tofu.DB = sqlite.New(config, tofu.Models)
+	}
+}
+
+func WithMemoryDB() func(*Tofu) {
+	return func(tofu *Tofu) {
+		tofu.DB = memory.New(tofu.Models)
+	}
+}
+
+// WithMigrations runs the versioned migrations of migrator in Run instead of AutoMigrate of every model.
+func WithMigrations(migrator *migration.Migrator) func(*Tofu) {
+	return func(tofu *Tofu) {
+		tofu.Migrator = migrator
+	}
+}
+
 func WithHTTPServer(httpConfig tconfig.HTTP, corsConfig tconfig.Cors) func(*Tofu) {
 	tlogger.Info(fmt.Sprintf("Create http server"))
 	return func(tofu *Tofu) {
@@ -59,6 +143,13 @@ func WithHTTPServer(httpConfig tconfig.HTTP, corsConfig tconfig.Cors) func(*Tofu
 	}
 }
 
+// WithOpenAPI sets the info of the document served at /api/openapi.json, ui adds the /api/docs page.
+func WithOpenAPI(title string, version string, ui bool) func(*Tofu) {
+	return func(tofu *Tofu) {
+		tofu.httpOptions = append(tofu.httpOptions, thttp.WithOpenAPI(title, version, ui))
+	}
+}
+
 func WithMQTTBroker(config tconfig.MQTT) func(*Tofu) {
 	tlogger.Info(fmt.Sprintf("Create mqtt broker"))
 	return func(tofu *Tofu) {
@@ -73,53 +164,281 @@ func (t *Tofu) SetOwnDB(db tdatabase.DBOperations) {
 	}
 }
 
+// WithMetrics serves the Prometheus metrics at /metrics and records the database calls.
+func WithMetrics() func(*Tofu) {
+	return func(tofu *Tofu) {
+		tofu.metrics = true
+		tofu.httpOptions = append(tofu.httpOptions, thttp.WithMetrics())
+	}
+}
+
+// WithTracing exports the spans of the http requests, hooks, database calls and mqtt messages as
+// configured, the provider is flushed on shutdown.
+func WithTracing(config tconfig.Tracing) func(*Tofu) {
+	return func(tofu *Tofu) {
+		provider, err := ttrace.NewProvider(tofu.CTX, config)
+		if err != nil {
+			panic(terror.Wrap("ttrace.NewProvider", terror.NewBadRequest(err.Error())))
+		}
+		tofu.tracing = true
+		tofu.httpOptions = append(tofu.httpOptions, thttp.WithTracing())
+		tofu.AddComponent(ComponentTracing, thelpers.ComponentFuncs{StopFn: provider.Shutdown})
+	}
+}
+
+// WithAuth requires a bearer JWT verified as configured on the routes of scopes, or on every /api route
+// without them, e.g. thttp.AuthModel("user", tmodel.RouteUpdate, tmodel.RouteDeleteOne).
+func WithAuth(config tconfig.Auth, scopes ...thttp.AuthScope) func(*Tofu) {
+	return func(tofu *Tofu) {
+		authenticator, err := thttp.NewAuthenticator(config)
+		if err != nil {
+			panic(terror.Wrap("thttp.NewAuthenticator", err))
+		}
+		tofu.httpOptions = append(tofu.httpOptions, thttp.WithAuth(authenticator, scopes...))
+	}
+}
+
+// WithAPIKeys migrates the api_key model, with WithMigrations too after the migrations, accepts its keys in
+// the X-API-Key header and serves /api/api-keys to callers with one of adminRoles, admin by default.
+func WithAPIKeys(adminRoles ...string) func(*Tofu) {
+	return func(tofu *Tofu) {
+		keys := thttp.NewAPIKeys(tofu.Models, adminRoles...)
+		tofu.apiKeys = keys
+		tofu.httpOptions = append(tofu.httpOptions, thttp.WithAPIKeys(keys))
+	}
+}
+
+// gormDB returns the gorm backend behind DB, looking through wrappers such as tmetrics.DB.
+func (t *Tofu) gormDB() (migration.GormDB, bool) {
+	db := t.DB
+	for {
+		if gormDB, ok := db.(migration.GormDB); ok {
+			return gormDB, true
+		}
+		wrapper, ok := db.(interface{ Unwrap() tdatabase.DBOperations })
+		if !ok {
+			return nil, false
+		}
+		db = wrapper.Unwrap()
+	}
+}
+
+func (t *Tofu) migrate() error {
+	if t.Migrator == nil {
+		return t.DB.Migrate()
+	}
+
+	db, ok := t.gormDB()
+	if !ok {
+		return terror.NewInternal("database does not support migrations")
+	}
+	if err := t.Migrator.Run(t.CTX, db.Gorm()); err != nil {
+		return terror.Wrap("t.Migrator.Run", err)
+	}
+
+	// The api_key table is internal, the app migrations are not expected to create it.
+	if t.apiKeys != nil && !t.Migrator.DryRun {
+		if err := db.Gorm().WithContext(t.CTX).AutoMigrate(t.apiKeys.Model.In); err != nil {
+			return terror.NewInternalf(fmt.Sprintf("AutoMigrate() - model: %s", t.apiKeys.Model.Name), err)
+		}
+	}
+	return nil
+}
+
+// Names of the components Run adds to the Lifecycle, components added by the app may depend on them.
+const (
+	ComponentDatabase = "database"
+	ComponentHTTP     = "http"
+	ComponentMQTT     = "mqtt"
+	ComponentTracing  = "tracing"
+)
+
+// AddComponent adds c to the Lifecycle, it starts in Run after its dependencies and stops before them.
+func (t *Tofu) AddComponent(name string, c thelpers.Component, opts ...thelpers.ComponentOption) {
+	if err := t.Lifecycle.Add(name, c, opts...); err != nil {
+		panic(err)
+	}
+}
+
+// AddWorker adds fn running until shutdown, see thelpers.Lifecycle.AddWorker.
+func (t *Tofu) AddWorker(name string, fn func(ctx context.Context) error, opts ...thelpers.ComponentOption) {
+	if err := t.Lifecycle.AddWorker(name, fn, opts...); err != nil {
+		panic(err)
+	}
+}
+
+// AddHealthCheck adds a readiness check served by /readyz next to the database, mqtt, migration and
+// lifecycle checks.
+func (t *Tofu) AddHealthCheck(name string, check thttp.Check) {
+	t.httpOptions = append(t.httpOptions, thttp.WithHealthCheck(name, check))
+}
+
+// AddLivenessCheck adds a check served by /healthz, fail it only when the process must be restarted.
+func (t *Tofu) AddLivenessCheck(name string, check thttp.Check) {
+	t.httpOptions = append(t.httpOptions, thttp.WithLivenessCheck(name, check))
+}
+
+func (t *Tofu) healthChecks() []func(*thttp.HttpAPI) {
+	checks := []func(*thttp.HttpAPI){
+		thttp.WithHealthCheck("lifecycle", func(ctx context.Context) error {
+			for name, state := range t.Lifecycle.Status() {
+				if state != thelpers.StateReady {
+					return terror.NewInternal(fmt.Sprintf("component %s is %s", name, state))
+				}
+			}
+			return nil
+		}),
+	}
+	if t.MQTT != nil {
+		checks = append(checks, thttp.WithHealthCheck(ComponentMQTT, func(ctx context.Context) error {
+			if !t.MQTT.Client.IsConnected() {
+				return terror.NewInternal("mqtt client is not connected")
+			}
+			return nil
+		}))
+	}
+	if db, ok := t.gormDB(); ok && t.Migrator != nil {
+		checks = append(checks, thttp.WithHealthCheck("migrations", func(ctx context.Context) error {
+			status, err := t.Migrator.Status(ctx, db.Gorm().WithContext(ctx))
+			if err != nil {
+				return terror.Wrap("t.Migrator.Status", err)
+			}
+			pending := 0
+			for _, s := range status {
+				if !s.Applied {
+					pending++
+				}
+			}
+			if pending > 0 {
+				return terror.NewInternal(fmt.Sprintf("%d pending migrations", pending))
+			}
+			return nil
+		}))
+	}
+	return checks
+}
+
+// Run starts the database, the http server, the mqtt client and the added components, then waits for
+// SIGINT or SIGTERM and stops them in reverse order. With the database only it returns once it is migrated,
+// call Shutdown when done to close the database and flush the traces.
 func (t *Tofu) Run() {
+	var deps []thelpers.ComponentOption
+	if t.DB != nil && t.tracing {
+		t.DB = ttrace.InstrumentDB(t.DB)
+	}
+	if t.DB != nil && t.metrics {
+		t.DB = tmetrics.InstrumentDB(t.DB)
+	}
+	if t.DB != nil {
+		t.AddComponent(ComponentDatabase, t.databaseComponent())
+		deps = append(deps, thelpers.DependsOn(ComponentDatabase))
+	}
+	if t.HTTPServer != nil {
+		t.AddComponent(ComponentHTTP, t.httpComponent(), deps...)
+	}
+	if t.MQTT != nil {
+		t.AddComponent(ComponentMQTT, t.mqttComponent(), deps...)
+	}
+
+	background := len(t.Lifecycle.Status())
 	if t.DB != nil {
-		if err := t.DB.Migrate(); err != nil {
-			tlogger.Error(fmt.Sprintf("tofu.DB.Migrate error! Error: %v", err))
+		background--
+	}
+	if t.tracing {
+		background--
+	}
+	if background == 0 {
+		if err := t.Lifecycle.Start(t.CTX); err != nil {
+			tlogger.Error(fmt.Sprintf("tofu.Lifecycle.Start error! Error: %v", err))
 			panic(err)
 		}
-		for _, model := range t.Models.All {
-			model.Store = t.DB
-		}
+		return
 	}
 
-	if t.HTTPServer != nil {
-		api := thttp.NewHttpApi(t.Models, thttp.WithDatabase(t.DB))
-		t.HTTPServer.Handler = api.GetHandler(t.corsConfig)
+	if err := t.Lifecycle.Run(t.CTX, thelpers.StopSignal()); err != nil {
+		tlogger.Error(fmt.Sprintf("tofu.Lifecycle.Run error! Error: %v", err))
+		panic(err)
+	}
+}
 
-		go func() {
-			tlogger.Info(fmt.Sprintf("Http api listen on port: %s", t.HTTPServer.Addr))
-			if err := t.HTTPServer.ListenAndServe(); err != nil {
-				tlogger.Error(fmt.Sprintf(" tofu.HTTPServer.ListenAndServe error! Error: %v", err))
+// Shutdown stops the components started by Run in reverse order, it is needed only when Run returned
+// without waiting for a signal.
+func (t *Tofu) Shutdown(ctx context.Context) error {
+	return t.Lifecycle.Stop(ctx)
+}
+
+func (t *Tofu) databaseComponent() thelpers.Component {
+	return thelpers.ComponentFuncs{
+		StartFn: func(ctx context.Context) error {
+			if err := t.migrate(); err != nil {
+				return terror.Wrap("tofu.migrate", err)
+			}
+			for _, model := range t.Models.All {
+				model.Store = t.DB
+			}
+			return nil
+		},
+		StopFn: func(ctx context.Context) error {
+			db, ok := t.gormDB()
+			if !ok {
+				return nil
+			}
+			sqlDB, err := db.Gorm().DB()
+			if err != nil {
+				return terror.NewInternalf("db.Gorm().DB", err)
 			}
-		}()
+			return sqlDB.Close()
+		},
+	}
+}
 
-		t.graceful.GoNoErr(func() {
-			if err := t.HTTPServer.Shutdown(t.CTX); err != nil && err != http.ErrServerClosed {
-				tlogger.Error(fmt.Sprintf("Graceful shutdown thttp server terror: %v", err))
-				return
+func (t *Tofu) httpComponent() thelpers.Component {
+	return thelpers.ComponentFuncs{
+		StartFn: func(ctx context.Context) error {
+			opts := append([]func(*thttp.HttpAPI){thttp.WithDatabase(t.DB)}, t.healthChecks()...)
+			api := thttp.NewHttpApi(t.Models, append(opts, t.httpOptions...)...)
+			t.HTTPServer.Handler = api.GetHandler(t.corsConfig)
+
+			listener, err := net.Listen("tcp", t.HTTPServer.Addr)
+			if err != nil {
+				return terror.NewInternalf("net.Listen", err)
+			}
+			tlogger.Info(fmt.Sprintf("Http api listen on port: %s", t.HTTPServer.Addr))
+			go func() {
+				if err := t.HTTPServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					t.Lifecycle.Fail(terror.NewInternalf("tofu.HTTPServer.Serve", err))
+				}
+			}()
+			return nil
+		},
+		StopFn: func(ctx context.Context) error {
+			if err := t.HTTPServer.Shutdown(ctx); err != nil {
+				return terror.NewInternalf("tofu.HTTPServer.Shutdown", err)
 			}
 			tlogger.Info("HttpApi grace down!")
-		})
-		_ = t.graceful.Wait()
+			return nil
+		},
 	}
+}
 
-	if t.MQTT != nil && (len(t.MQTT.Subscribers) > 0 || len(t.MQTT.Publishers) > 0) {
-		for _, subscriber := range t.MQTT.Subscribers {
-			go func(s tqueue.SubFn) {
-				t.MQTT.Subscribe(s.Topic, s.Fn)
-			}(subscriber)
-		}
-		for _, publisher := range t.MQTT.Publishers {
-			go func(p tqueue.PubFn) {
-				t.MQTT.Publish(p.Topic, p.Fn)
-			}(publisher)
-		}
-		t.graceful.GoNoErr(func() {
+func (t *Tofu) mqttComponent() thelpers.Component {
+	return thelpers.ComponentFuncs{
+		StartFn: func(ctx context.Context) error {
+			for _, subscriber := range t.MQTT.Subscribers {
+				if err := t.MQTT.Subscribe(subscriber.Topic, subscriber.Fn); err != nil {
+					return terror.Wrap("t.MQTT.Subscribe()", err)
+				}
+			}
+			for _, publisher := range t.MQTT.Publishers {
+				go func(p tqueue.PubFn) {
+					t.MQTT.Publish(p.Topic, p.Fn)
+				}(publisher)
+			}
+			return nil
+		},
+		StopFn: func(ctx context.Context) error {
 			t.MQTT.Disconnect()
-		})
-		_ = t.graceful.Wait()
+			return nil
+		},
 	}
-
 }
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"context"
+	"os"
+
 	"github.com/WojciechWiderski/tofu"
 	"github.com/WojciechWiderski/tofu/example-app/model"
 	"github.com/WojciechWiderski/tofu/example-app/service"
@@ -12,23 +15,23 @@ import (
 
 func main() {
 	app := tofu.New(
-		tofu.WithMySQLDB(tconfig.MySql{
-			Username:     "user",
-			Password:     "password",
-			Address:      "localhost:3306",
-			DatabaseName: "db",
-		}),
+		tofu.WithConfigFile("config.yaml", tconfig.WithArgs(os.Args[1:])),
 	)
 
 	app.Models.Set(tmodel.NewModel(&model.Day{}, "day"))
 	app.Models.Set(tmodel.NewModel(&model.Date{}, "date"))
-	app.Models.Set(tmodel.NewModel(&model.User{}, "user"))
+	users := tmodel.Register[model.User](app.Models, "user")
 	app.Models.Set(tmodel.NewModel(&model.Level{}, "level"))
 	app.Models.Set(tmodel.NewModel(&model.Task{}, "task"))
 
 	app.Run()
+	defer func() {
+		if err := app.Shutdown(context.Background()); err != nil {
+			tlogger.Error(terror.Wrap("app.Shutdown()", err).Error())
+		}
+	}()
 
-	svc := service.New(app.Models)
+	svc := service.New(users)
 	err := svc.AddUser()
 	if err != nil {
 		tlogger.Error(terror.Wrap("svc.AddUser()", err).Error())
@@ -12,9 +12,9 @@ type User struct {
 
 type Level struct {
 	gorm.Model
-	MinExperience uint
-	MaxExperience uint
-	Award         string
+	MinExperience uint   `validate:"ltefield=MaxExperience"`
+	MaxExperience uint   `validate:"required"`
+	Award         string `validate:"max=255"`
 }
 
 type Day struct {
@@ -1,13 +1,48 @@
 package tconfig
 
+import "time"
+
+// Config holds every section tofu knows, Load reads it from files, the environment and flags.
+type Config struct {
+	App      App
+	MySql    MySql `config:"mysql"`
+	Postgres Postgres
+	SQLite   SQLite `config:"sqlite"`
+	HTTP     HTTP
+	Cors     Cors
+	MQTT     MQTT
+	Logger   Logger
+	Tracing  Tracing
+	Auth     Auth
+}
+
 type App struct {
+	Name            string        `default:"tofu"`
+	Env             string        `default:"development"`
+	ShutdownTimeout time.Duration `default:"10s"`
 }
 
 type MySql struct {
-	Username     string
+	Username     string `required:"true"`
 	Password     string
-	Address      string
-	DatabaseName string
+	Address      string `required:"true"`
+	DatabaseName string `required:"true"`
+}
+
+type Postgres struct {
+	Host         string `required:"true"`
+	Port         int    `default:"5432"`
+	Username     string `required:"true"`
+	Password     string
+	DatabaseName string `required:"true"`
+	SSLMode      string `default:"disable"`
+	Schema       string
+	SearchPath   []string
+}
+
+type SQLite struct {
+	Path     string
+	InMemory bool
 }
 
 type Cors struct {
@@ -16,17 +51,51 @@ type Cors struct {
 	AllowedHeaders   []string
 	ExposedHeaders   []string
 	AllowCredentials bool
-	MaxAge           int
+	MaxAge           int `default:"300"`
 }
 
 type HTTP struct {
-	Port string
+	Port string `required:"true"`
 }
 
 type MQTT struct {
-	Broker   string
-	Port     int
+	Broker   string `required:"true"`
+	Port     int    `default:"1883"`
 	ClientID string
 	Username string
 	Password string
+	// TraceEnvelope wraps published payloads with the trace context, subscribers unwrap it either way.
+	TraceEnvelope bool
+}
+
+type Logger struct {
+	Level    string
+	Format   string
+	Packages map[string]string
+}
+
+type Tracing struct {
+	ServiceName string `default:"tofu"`
+	// Exporter is none, stdout or otlp.
+	Exporter    string `default:"none"`
+	Endpoint    string
+	Insecure    bool
+	SampleRatio float64 `default:"1"`
+}
+
+type Auth struct {
+	// Algorithms accepted in tokens, of HS256, RS256 and EdDSA.
+	Algorithms []string `default:"HS256,RS256,EdDSA"`
+	// Secret verifies HS256 tokens.
+	Secret string
+	// PublicKeyFile is a PEM RSA or Ed25519 public key verifying RS256 or EdDSA tokens.
+	PublicKeyFile string
+	// JWKS is a URL or a file path of a JSON Web Key Set, keys are matched by the kid header.
+	JWKS        string
+	JWKSRefresh time.Duration `default:"1h"`
+	Issuer      string
+	Audience    string
+	Leeway      time.Duration
+	// RolesClaim names the claim holding the roles of the caller, a list or a space separated string.
+	RolesClaim string `default:"roles"`
 }
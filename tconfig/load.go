@@ -0,0 +1,466 @@
+package tconfig
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Load fills dst, a pointer to a struct of sections like Config, from the sources given by opts. Later
+// sources win: default tags, then files in order, then the environment, then flags.
+//
+// A field is named by its config tag or by its snake cased name, e.g. MySql.DatabaseName is
+// mysql.database_name in files, PREFIX_MYSQL_DATABASE_NAME in the environment and -mysql.database_name
+// as a flag. PREFIX_MYSQL_PASSWORD_FILE reads the value from a file, e.g. a mounted secret. Lists and maps
+// are comma separated in the environment and flags: a,b or key=value,key=value.
+//
+// Fields tagged required:"true" must be set once any source sets a field of their section, so an unused
+// section, like mysql in an app on postgres, is not validated.
+func Load(dst interface{}, opts ...Option) error {
+	l := &loader{}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config destination must be a pointer to a struct, got %T", dst)
+	}
+	l.walk(rv.Elem(), nil)
+	for _, name := range sortedKeys(l.sections) {
+		section := reflect.ValueOf(l.sections[name])
+		if section.Kind() != reflect.Pointer || section.Elem().Kind() != reflect.Struct {
+			return fmt.Errorf("config section %s must be a pointer to a struct, got %T", name, l.sections[name])
+		}
+		l.walk(section.Elem(), []string{name})
+	}
+
+	l.touched = map[string]bool{}
+	steps := []func() error{l.loadDefaults, l.loadFiles, l.loadEnv, l.loadFlags, l.checkRequired}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type Option func(*loader)
+
+// WithFile reads path as YAML, JSON or TOML by its extension, files added later win.
+func WithFile(path string) Option {
+	return func(l *loader) {
+		l.files = append(l.files, path)
+	}
+}
+
+// WithEnv reads variables named PREFIX_SECTION_FIELD, an empty prefix reads SECTION_FIELD.
+func WithEnv(prefix string) Option {
+	return func(l *loader) {
+		l.env = true
+		l.prefix = prefix
+	}
+}
+
+// WithArgs reads the -section.field=value flags of args, usually os.Args[1:], other flags and arguments
+// are left to the app.
+func WithArgs(args []string) Option {
+	return func(l *loader) {
+		l.args = args
+	}
+}
+
+// WithSection loads dst, a pointer to a struct, under name next to the sections of the Load destination.
+func WithSection(name string, dst interface{}) Option {
+	return func(l *loader) {
+		if l.sections == nil {
+			l.sections = map[string]interface{}{}
+		}
+		l.sections[name] = dst
+	}
+}
+
+// MissingError lists the required fields no source has set.
+type MissingError struct {
+	Keys []string
+}
+
+func (e MissingError) Error() string {
+	return fmt.Sprintf("missing required config: %s", strings.Join(e.Keys, ", "))
+}
+
+type loader struct {
+	files    []string
+	env      bool
+	prefix   string
+	args     []string
+	sections map[string]interface{}
+
+	fields  []*field
+	touched map[string]bool
+}
+
+type field struct {
+	path     []string
+	value    reflect.Value
+	def      string
+	required bool
+}
+
+func (f *field) key() string {
+	return strings.Join(f.path, ".")
+}
+
+func (l *loader) walk(v reflect.Value, path []string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := sf.Tag.Get("config")
+		if !sf.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = snakeCase(sf.Name)
+		}
+		fieldPath := append(append([]string{}, path...), name)
+
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct && fv.Type() != reflect.TypeOf(time.Time{}) {
+			l.walk(fv, fieldPath)
+			continue
+		}
+		l.fields = append(l.fields, &field{
+			path:     fieldPath,
+			value:    fv,
+			def:      sf.Tag.Get("default"),
+			required: sf.Tag.Get("required") == "true",
+		})
+	}
+}
+
+func (l *loader) set(f *field, raw string, source string) error {
+	if err := setString(f.value, raw); err != nil {
+		return fmt.Errorf("%s %s: %w", source, f.key(), err)
+	}
+	for i := 1; i < len(f.path); i++ {
+		l.touched[strings.Join(f.path[:i], ".")] = true
+	}
+	l.touched[f.key()] = true
+	return nil
+}
+
+func (l *loader) loadDefaults() error {
+	for _, f := range l.fields {
+		if f.def == "" || !f.value.IsZero() {
+			continue
+		}
+		if err := setString(f.value, f.def); err != nil {
+			return fmt.Errorf("default %s: %w", f.key(), err)
+		}
+	}
+	return nil
+}
+
+func (l *loader) loadFiles() error {
+	for _, path := range l.files {
+		data, err := readFile(path)
+		if err != nil {
+			return err
+		}
+		for _, f := range l.fields {
+			raw, ok := lookup(data, f.path)
+			if !ok {
+				continue
+			}
+			if err := l.setAny(f, raw, path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (l *loader) setAny(f *field, raw interface{}, source string) error {
+	switch value := raw.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		items := make([]string, len(value))
+		for i, item := range value {
+			items[i] = scalar(item)
+		}
+		return l.set(f, strings.Join(items, ","), source)
+	case map[string]interface{}:
+		items := make([]string, 0, len(value))
+		for _, k := range sortedKeys(value) {
+			items = append(items, k+"="+scalar(value[k]))
+		}
+		return l.set(f, strings.Join(items, ","), source)
+	}
+	return l.set(f, scalar(raw), source)
+}
+
+func (l *loader) loadEnv() error {
+	if !l.env {
+		return nil
+	}
+	for _, f := range l.fields {
+		name := strings.ToUpper(strings.Join(f.path, "_"))
+		if l.prefix != "" {
+			name = strings.ToUpper(l.prefix) + "_" + name
+		}
+
+		value, ok := os.LookupEnv(name)
+		secret, fromFile := os.LookupEnv(name + "_FILE")
+		switch {
+		case ok && fromFile:
+			return fmt.Errorf("env %s and %s_FILE are both set", name, name)
+		case fromFile:
+			content, err := os.ReadFile(secret)
+			if err != nil {
+				return fmt.Errorf("env %s_FILE: %w", name, err)
+			}
+			value, ok = strings.TrimRight(string(content), "\r\n"), true
+		}
+		if !ok {
+			continue
+		}
+		if err := l.set(f, value, "env "+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadFlags sets the fields of the -section.field flags in args, written -key=value, -key value or -key
+// for a bool. Any other flag or argument belongs to the app and is skipped, "--" ends the flags.
+func (l *loader) loadFlags() error {
+	fields := make(map[string]*field, len(l.fields))
+	for _, f := range l.fields {
+		fields[f.key()] = f
+	}
+
+	for i := 0; i < len(l.args); i++ {
+		arg := l.args[i]
+		if arg == "--" {
+			return nil
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(arg[1:], "-"), "=")
+		f, ok := fields[name]
+		if !ok {
+			continue
+		}
+		if !hasValue {
+			switch {
+			case f.value.Kind() == reflect.Bool:
+				value = "true"
+			case i+1 < len(l.args):
+				i++
+				value = l.args[i]
+			default:
+				return fmt.Errorf("flag -%s needs a value", name)
+			}
+		}
+		if err := l.set(f, value, "flag"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *loader) checkRequired() error {
+	var missing []string
+	for _, f := range l.fields {
+		if !f.required || !f.value.IsZero() {
+			continue
+		}
+		if len(f.path) > 1 && !l.touched[strings.Join(f.path[:len(f.path)-1], ".")] {
+			continue
+		}
+		missing = append(missing, f.key())
+	}
+	if len(missing) > 0 {
+		return MissingError{Keys: missing}
+	}
+	return nil
+}
+
+func readFile(path string) (map[string]interface{}, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config file: %w", err)
+	}
+
+	data := map[string]interface{}{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &data)
+	case ".json":
+		err = json.Unmarshal(content, &data)
+	case ".toml":
+		err = toml.Unmarshal(content, &data)
+	default:
+		err = errors.New("unsupported extension " + ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	return data, nil
+}
+
+// lookup finds path in data ignoring case, underscores and dashes, so database_name, databaseName and
+// database-name are the same key.
+func lookup(data map[string]interface{}, path []string) (interface{}, bool) {
+	var current interface{} = data
+	for _, name := range path {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = nil, false
+		for k, v := range m {
+			if normalize(k) == normalize(name) {
+				current, ok = v, true
+				break
+			}
+		}
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func normalize(key string) string {
+	return strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(key))
+}
+
+func scalar(v interface{}) string {
+	switch value := v.(type) {
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case time.Time:
+		return value.Format(time.RFC3339)
+	}
+	return fmt.Sprint(v)
+}
+
+func setString(v reflect.Value, raw string) error {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		items := splitList(raw)
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setString(slice.Index(i), item); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	case reflect.Map:
+		m := reflect.MakeMap(v.Type())
+		for _, item := range splitList(raw) {
+			k, value, ok := strings.Cut(item, "=")
+			if !ok {
+				return fmt.Errorf("wrong map item %q, want key=value", item)
+			}
+			key := reflect.New(v.Type().Key()).Elem()
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := setString(key, strings.TrimSpace(k)); err != nil {
+				return err
+			}
+			if err := setString(elem, strings.TrimSpace(value)); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, elem)
+		}
+		v.Set(m)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// snakeCase turns DatabaseName into database_name and SSLMode into ssl_mode.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,159 @@
+package tconfig
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testDB struct {
+	Host         string `default:"localhost"`
+	Port         int    `default:"5432"`
+	DatabaseName string `required:"true"`
+	Password     string
+}
+
+type testServer struct {
+	Timeout time.Duration `default:"5s"`
+	Debug   bool
+	Origins []string
+	Labels  map[string]int
+	Addr    string `config:"address"`
+}
+
+type testConfig struct {
+	DB     testDB
+	Server testServer
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("os.WriteFile() error = %v", err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	yamlFile := writeFile(t, "config.yaml", "db:\n  database-name: app\n  port: 6000\nserver:\n  origins: [a, b]\n  labels: {x: 1}\n")
+	jsonFile := writeFile(t, "config.json", `{"db": {"databaseName": "other"}, "server": {"address": ":8080"}}`)
+	tomlFile := writeFile(t, "config.toml", "[server]\ndebug = true\n")
+	secret := writeFile(t, "secret", "s3cret\n")
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		env     map[string]string
+		want    testConfig
+		wantErr bool
+	}{
+		{
+			name: "defaults only, the untouched section is not required",
+			want: testConfig{DB: testDB{Host: "localhost", Port: 5432}, Server: testServer{Timeout: 5 * time.Second}},
+		},
+		{
+			name: "later files win",
+			opts: []Option{WithFile(yamlFile), WithFile(jsonFile), WithFile(tomlFile)},
+			want: testConfig{
+				DB:     testDB{Host: "localhost", Port: 6000, DatabaseName: "other"},
+				Server: testServer{Timeout: 5 * time.Second, Debug: true, Origins: []string{"a", "b"}, Labels: map[string]int{"x": 1}, Addr: ":8080"},
+			},
+		},
+		{
+			name: "env wins over files and reads secrets",
+			opts: []Option{WithFile(yamlFile), WithEnv("TEST")},
+			env:  map[string]string{"TEST_DB_PORT": "7000", "TEST_DB_PASSWORD_FILE": secret, "TEST_SERVER_LABELS": "y=2, z=3"},
+			want: testConfig{
+				DB:     testDB{Host: "localhost", Port: 7000, DatabaseName: "app", Password: "s3cret"},
+				Server: testServer{Timeout: 5 * time.Second, Origins: []string{"a", "b"}, Labels: map[string]int{"y": 2, "z": 3}},
+			},
+		},
+		{
+			name: "flags win over env",
+			opts: []Option{WithEnv("TEST"), WithArgs([]string{"-db.database_name=flag", "-server.debug", "-server.timeout=1m"})},
+			env:  map[string]string{"TEST_DB_DATABASE_NAME": "env"},
+			want: testConfig{DB: testDB{Host: "localhost", Port: 5432, DatabaseName: "flag"}, Server: testServer{Timeout: time.Minute, Debug: true}},
+		},
+		{name: "missing required field of a touched section", opts: []Option{WithArgs([]string{"-db.port=1"})}, wantErr: true},
+		{name: "value and secret file both set", opts: []Option{WithEnv("TEST")}, env: map[string]string{"TEST_DB_PASSWORD": "a", "TEST_DB_PASSWORD_FILE": secret}, wantErr: true},
+		{name: "wrong value", opts: []Option{WithEnv("TEST")}, env: map[string]string{"TEST_DB_PORT": "x"}, wantErr: true},
+		{name: "wrong map item", opts: []Option{WithEnv("TEST")}, env: map[string]string{"TEST_SERVER_LABELS": "y"}, wantErr: true},
+		{name: "missing file", opts: []Option{WithFile(filepath.Join(t.TempDir(), "nope.yaml"))}, wantErr: true},
+		{name: "unsupported extension", opts: []Option{WithFile(writeFile(t, "config.ini", "a=1"))}, wantErr: true},
+		{
+			name: "app flags and arguments are skipped",
+			opts: []Option{WithArgs([]string{"-h", "-v=2", "serve", "--db.database_name", "app", "-server.debug=false", "-workers", "4", "input.csv"})},
+			want: testConfig{DB: testDB{Host: "localhost", Port: 5432, DatabaseName: "app"}, Server: testServer{Timeout: 5 * time.Second}},
+		},
+		{
+			name: "double dash ends the flags",
+			opts: []Option{WithArgs([]string{"-db.database_name=app", "--", "-db.host=other"})},
+			want: testConfig{DB: testDB{Host: "localhost", Port: 5432, DatabaseName: "app"}, Server: testServer{Timeout: 5 * time.Second}},
+		},
+		{name: "config flag without a value", opts: []Option{WithArgs([]string{"-db.port"})}, wantErr: true},
+		{name: "wrong flag value", opts: []Option{WithArgs([]string{"-db.port=x"})}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			var got testConfig
+			err := Load(&got, tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Load() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad_Missing(t *testing.T) {
+	var got testConfig
+	err := Load(&got, WithArgs([]string{"-db.host=db"}))
+	var missing MissingError
+	if !errors.As(err, &missing) || !reflect.DeepEqual(missing.Keys, []string{"db.database_name"}) {
+		t.Errorf("Load() error = %v, want the missing db.database_name", err)
+	}
+}
+
+func TestLoad_Section(t *testing.T) {
+	var conf struct{ DB testDB }
+	var extra struct {
+		Name string `default:"worker"`
+		Size int
+	}
+	t.Setenv("TEST_EXTRA_SIZE", "3")
+	if err := Load(&conf, WithSection("extra", &extra), WithEnv("TEST")); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if extra.Name != "worker" || extra.Size != 3 {
+		t.Errorf("section = %+v", extra)
+	}
+	if err := Load(conf); err == nil {
+		t.Errorf("Load() of a non pointer did not fail")
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	tests := map[string]string{
+		"DatabaseName": "database_name",
+		"SSLMode":      "ssl_mode",
+		"JWKSRefresh":  "jwks_refresh",
+		"Port":         "port",
+		"Http2Enabled": "http2_enabled",
+	}
+	for in, want := range tests {
+		t.Run(in, func(t *testing.T) {
+			if got := snakeCase(in); got != want {
+				t.Errorf("snakeCase() = %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package tcontext
 
 import (
 	"context"
+	"strings"
 
 	"github.com/WojciechWiderski/tofu/tmodel"
 )
@@ -10,8 +11,38 @@ const (
 	RouteTypeCtxKey = "route-type-ctx-key"
 	ModelCtxKey     = "model-ctx-key"
 	PatternCtxKey   = "pattern-ctx-key"
+	ClaimsCtxKey    = "claims-ctx-key"
+	RolesCtxKey     = "roles-ctx-key"
+	EventCtxKey     = "event-ctx-key"
 )
 
+// Claims are the claims of the authenticated token.
+type Claims map[string]interface{}
+
+func (c Claims) Subject() string {
+	sub, _ := c["sub"].(string)
+	return sub
+}
+
+// Strings returns the claim key as a list, a space separated string claim such as scope is split.
+func (c Claims) Strings(key string) []string {
+	switch value := c[key].(type) {
+	case string:
+		return strings.Fields(value)
+	case []string:
+		return value
+	case []interface{}:
+		out := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
 func ContextWithPattern(ctx context.Context, pattern string) context.Context {
 	return context.WithValue(ctx, PatternCtxKey, pattern)
 }
@@ -51,3 +82,41 @@ func PatternFromCtx(ctx context.Context) string {
 	}
 	return ""
 }
+
+func ContextWithClaims(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(ctx, ClaimsCtxKey, claims)
+}
+
+// ClaimsFromCtx returns the claims of the request, nil when it is not authenticated.
+func ClaimsFromCtx(ctx context.Context) Claims {
+	if value, ok := ctx.Value(ClaimsCtxKey).(Claims); ok {
+		return value
+	}
+	return nil
+}
+
+// ContextWithRoles marks the request as authenticated with roles, which may be empty.
+func ContextWithRoles(ctx context.Context, roles []string) context.Context {
+	if roles == nil {
+		roles = []string{}
+	}
+	return context.WithValue(ctx, RolesCtxKey, roles)
+}
+
+// RolesFromCtx returns the roles of the caller, ok is false when the request is not authenticated.
+func RolesFromCtx(ctx context.Context) (roles []string, ok bool) {
+	roles, ok = ctx.Value(RolesCtxKey).([]string)
+	return roles, ok
+}
+
+func ContextWithEvent(ctx context.Context, event *tmodel.Event) context.Context {
+	return context.WithValue(ctx, EventCtxKey, event)
+}
+
+// EventFromCtx returns the hook event of the route, nil outside of the generic routes.
+func EventFromCtx(ctx context.Context) *tmodel.Event {
+	if value, ok := ctx.Value(EventCtxKey).(*tmodel.Event); ok {
+		return value
+	}
+	return nil
+}
@@ -2,15 +2,42 @@ package tdatabase
 
 import (
 	"context"
+	"path"
+	"reflect"
 )
 
 type DBOperations interface {
 	Add(ctx context.Context, in interface{}) error
+	AddMany(ctx context.Context, in []interface{}) ([]Result, error)
 	GetOne(ctx context.Context, in interface{}, params ParamRequest) (interface{}, error)
 	GetMany(ctx context.Context, in interface{}, params ParamRequest) ([]interface{}, error)
-	Update(ctx context.Context, update interface{}, in interface{}, id int) error
-	Delete(ctx context.Context, in interface{}, id int) error
+	Count(ctx context.Context, in interface{}, params ParamRequest) (int64, error)
+	Update(ctx context.Context, update interface{}, in interface{}, id interface{}) error
+	Delete(ctx context.Context, in interface{}, id interface{}) error
+	DeleteMany(ctx context.Context, in interface{}, params ParamRequest) ([]Result, error)
 	Migrate() error
+	// Ping checks the connection, it backs the database readiness check.
+	Ping(ctx context.Context) error
+
+	// WithTx runs fn in a transaction carried in ctx, every method called with that ctx takes part in it.
+	WithTx(ctx context.Context, fn func(ctx context.Context, tx DBOperations) error) error
+}
+
+// Backend returns the package name of the store behind db, e.g. sqlite or memory, looking through
+// wrappers with an Unwrap method such as tmetrics.DB and ttrace.DB.
+func Backend(db DBOperations) string {
+	for {
+		wrapper, ok := db.(interface{ Unwrap() DBOperations })
+		if !ok {
+			break
+		}
+		db = wrapper.Unwrap()
+	}
+	t := reflect.TypeOf(db)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return path.Base(t.PkgPath())
 }
 
 type ParamRequest struct {
@@ -18,4 +45,22 @@ type ParamRequest struct {
 	Value any `json:"value"`
 	From  any `json:"from"`
 	To    any `json:"to"`
+
+	Filter Filter `json:"filter"`
+
+	// Include lists the relations to load with the records as struct field paths such as Dates or
+	// Dates.Task, see tmodel.Model.Includes. The gorm backends preload them with one query per relation.
+	Include []string `json:"include"`
+
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+	Cursor string `json:"cursor"`
+	Sort   []Sort `json:"sort"`
+}
+
+// Result describes a single item of a batch operation.
+type Result struct {
+	Index int         `json:"index"`
+	Item  interface{} `json:"item,omitempty"`
+	Error string      `json:"error,omitempty"`
 }
@@ -0,0 +1,152 @@
+package tdatabase
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+type Operator uint8
+
+const (
+	WrongOperator Operator = iota
+	OpEq
+	OpNe
+	OpLt
+	OpLte
+	OpGt
+	OpGte
+	OpIn
+	OpNotIn
+	OpLike
+	OpNull
+)
+
+var OperatorMap = map[string]Operator{
+	"wrong": WrongOperator,
+	"eq":    OpEq,
+	"ne":    OpNe,
+	"lt":    OpLt,
+	"lte":   OpLte,
+	"gt":    OpGt,
+	"gte":   OpGte,
+	"in":    OpIn,
+	"nin":   OpNotIn,
+	"like":  OpLike,
+	"null":  OpNull,
+}
+
+// NewOperator returns OpEq for an empty operator, so filter[name]=foo means equality.
+func NewOperator(in string) Operator {
+	if len(in) == 0 {
+		return OpEq
+	}
+
+	if op, ok := OperatorMap[in]; ok {
+		return op
+	}
+	return WrongOperator
+}
+
+func (op Operator) String() string {
+	switch op {
+	case OpEq:
+		return "eq"
+	case OpNe:
+		return "ne"
+	case OpLt:
+		return "lt"
+	case OpLte:
+		return "lte"
+	case OpGt:
+		return "gt"
+	case OpGte:
+		return "gte"
+	case OpIn:
+		return "in"
+	case OpNotIn:
+		return "nin"
+	case OpLike:
+		return "like"
+	case OpNull:
+		return "null"
+	default:
+		return "wrong"
+	}
+}
+
+// Condition is a single comparison of a model field, Field is a column or struct field name and
+// is validated by every backend against the model schema.
+type Condition struct {
+	Field    string   `json:"field"`
+	Operator Operator `json:"operator"`
+	Value    any      `json:"value"`
+}
+
+// Filter is a list of conditions that all have to match.
+type Filter []Condition
+
+// NewCondition parses the raw query string value for the given operator, "in" and "nin" take comma separated lists.
+func NewCondition(field string, operator string, value string) (Condition, error) {
+	op := NewOperator(operator)
+	if op == WrongOperator {
+		return Condition{}, fmt.Errorf("wrong filter operator %s for field %s", operator, field)
+	}
+	if field == "" {
+		return Condition{}, fmt.Errorf("empty filter field")
+	}
+
+	condition := Condition{Field: field, Operator: op, Value: value}
+	switch op {
+	case OpIn, OpNotIn:
+		var values []any
+		for _, v := range strings.Split(value, ",") {
+			values = append(values, v)
+		}
+		condition.Value = values
+	case OpNull:
+		condition.Value = value == "" || value == "true" || value == "1"
+	case OpLike:
+		if !strings.ContainsAny(value, "%_") {
+			condition.Value = "%" + value + "%"
+		}
+	}
+	return condition, nil
+}
+
+// Values returns the list of an in or nin condition, a slice of any element type is spread into its elements.
+func (c Condition) Values() []any {
+	value := reflect.ValueOf(c.Value)
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array || value.Type().Elem().Kind() == reflect.Uint8 {
+		return []any{c.Value}
+	}
+	values := make([]any, value.Len())
+	for i := range values {
+		values[i] = value.Index(i).Interface()
+	}
+	return values
+}
+
+// Conditions joins Filter with the legacy By/Value equality and the From/To range on By.
+func (p ParamRequest) Conditions() Filter {
+	conditions := append(Filter{}, p.Filter...)
+	if isEmpty(p.By) {
+		return conditions
+	}
+
+	by := fmt.Sprint(p.By)
+	if !isEmpty(p.Value) {
+		conditions = append(conditions, Condition{Field: by, Operator: OpEq, Value: p.Value})
+	}
+	if !isEmpty(p.From) {
+		conditions = append(conditions, Condition{Field: by, Operator: OpGte, Value: p.From})
+	}
+	if !isEmpty(p.To) {
+		conditions = append(conditions, Condition{Field: by, Operator: OpLte, Value: p.To})
+	}
+	return conditions
+}
+
+func isEmpty(v any) bool {
+	return v == nil || fmt.Sprint(v) == ""
+}
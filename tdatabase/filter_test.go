@@ -0,0 +1,79 @@
+package tdatabase
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewCondition(t *testing.T) {
+	tests := []struct {
+		name     string
+		field    string
+		operator string
+		value    string
+		want     Condition
+		wantErr  bool
+	}{
+		{name: "empty operator is eq", field: "name", value: "foo", want: Condition{Field: "name", Operator: OpEq, Value: "foo"}},
+		{name: "in list", field: "status", operator: "in", value: "1,2", want: Condition{Field: "status", Operator: OpIn, Value: []any{"1", "2"}}},
+		{name: "null", field: "deleted_at", operator: "null", value: "", want: Condition{Field: "deleted_at", Operator: OpNull, Value: true}},
+		{name: "not null", field: "deleted_at", operator: "null", value: "false", want: Condition{Field: "deleted_at", Operator: OpNull, Value: false}},
+		{name: "like without wildcards", field: "name", operator: "like", value: "foo", want: Condition{Field: "name", Operator: OpLike, Value: "%foo%"}},
+		{name: "like with wildcards", field: "name", operator: "like", value: "foo%", want: Condition{Field: "name", Operator: OpLike, Value: "foo%"}},
+		{name: "wrong operator", field: "name", operator: "nope", value: "foo", wantErr: true},
+		{name: "empty field", field: "", operator: "eq", value: "foo", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewCondition(tt.field, tt.operator, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewCondition() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewCondition() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCondition_Values(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  []any
+	}{
+		{name: "[]any", value: []any{"1", "2"}, want: []any{"1", "2"}},
+		{name: "[]uint", value: []uint{1, 2}, want: []any{uint(1), uint(2)}},
+		{name: "[]string", value: []string{"a"}, want: []any{"a"}},
+		{name: "single value", value: 5, want: []any{5}},
+		{name: "bytes are a single value", value: []byte("ab"), want: []any{[]byte("ab")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Condition{Value: tt.value}).Values(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Values() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParamRequest_Conditions(t *testing.T) {
+	tests := []struct {
+		name   string
+		params ParamRequest
+		want   Filter
+	}{
+		{name: "none", params: ParamRequest{By: "", Value: ""}, want: Filter{}},
+		{name: "by without a value", params: ParamRequest{By: "name"}, want: Filter{}},
+		{name: "by and value", params: ParamRequest{By: "id", Value: "5"}, want: Filter{{Field: "id", Operator: OpEq, Value: "5"}}},
+		{name: "range", params: ParamRequest{By: "count", From: "1", To: "9"}, want: Filter{{Field: "count", Operator: OpGte, Value: "1"}, {Field: "count", Operator: OpLte, Value: "9"}}},
+		{name: "filter first", params: ParamRequest{By: "id", Value: "5", Filter: Filter{{Field: "name", Operator: OpLike, Value: "%a%"}}}, want: Filter{{Field: "name", Operator: OpLike, Value: "%a%"}, {Field: "id", Operator: OpEq, Value: "5"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.params.Conditions(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Conditions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
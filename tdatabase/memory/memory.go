@@ -0,0 +1,829 @@
+package memory
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"github.com/WojciechWiderski/tofu/tdatabase"
+	"github.com/WojciechWiderski/tofu/terror"
+	"github.com/WojciechWiderski/tofu/tlogger"
+	"github.com/WojciechWiderski/tofu/tmodel"
+)
+
+// DB keeps every model in Go maps keyed by model type and id. It is safe for concurrent use. Unlike the gorm
+// backends it supports only integer primary keys and loads no includes, both fail with a clear error.
+type DB struct {
+	mu      sync.RWMutex
+	models  *tmodel.Models
+	schemas *sync.Map
+	tables  map[reflect.Type]*table
+}
+
+type table struct {
+	db     *DB
+	schema *schema.Schema
+	rows   map[uint64]reflect.Value
+	nextID uint64
+	// unique holds the fields of every unique index, see checkUnique.
+	unique [][]*schema.Field
+}
+
+func New(models *tmodel.Models) *DB {
+	tlogger.Success("Memory database created!")
+	return &DB{
+		models:  models,
+		schemas: &sync.Map{},
+		tables:  make(map[reflect.Type]*table),
+	}
+}
+
+// Ping always succeeds, the store lives in the process and has no connection to lose.
+func (m *DB) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Migrate registers a table for every model, there is no schema to change.
+func (m *DB) Migrate() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, model := range m.models.All {
+		if _, err := m.register(model.In); err != nil {
+			tlogger.Error(fmt.Sprintf("Migrate terror for: %s, terror: %s", model.Name, err))
+			return terror.Wrap(fmt.Sprintf("m.register() - model: %s", model.Name), err)
+		}
+		tlogger.Success(fmt.Sprintf("Migrate success for: %s", model.Name))
+	}
+	return nil
+}
+
+func (m *DB) Add(ctx context.Context, in interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.add(ctx, in)
+}
+
+// AddMany adds all items or none of them, the rows added before a failing item are removed again.
+func (m *DB) AddMany(ctx context.Context, in []interface{}) ([]tdatabase.Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	results := make([]tdatabase.Result, 0, len(in))
+	for i, item := range in {
+		results = append(results, tdatabase.Result{Index: i, Item: item})
+		if err := m.add(ctx, item); err != nil {
+			results[i].Error = err.Error()
+			for _, added := range in[:i] {
+				m.remove(ctx, added)
+			}
+			return results, terror.Wrap(fmt.Sprintf("m.add() - item %d", i), err)
+		}
+	}
+	return results, nil
+}
+
+func (m *DB) add(ctx context.Context, in interface{}) error {
+	t, err := m.table(in)
+	if err != nil {
+		return terror.Wrap("m.table()", err)
+	}
+
+	row := reflect.New(modelType(in)).Elem()
+	row.Set(reflect.Indirect(reflect.ValueOf(in)))
+
+	id, err := t.id(ctx, row)
+	if err != nil {
+		return terror.Wrap("t.id()", err)
+	}
+	if id == 0 {
+		t.nextID++
+		id = t.nextID
+		if err := t.setID(ctx, row, id); err != nil {
+			return terror.Wrap("t.setID()", err)
+		}
+	} else if _, ok := t.rows[id]; ok {
+		return terror.NewConflict(fmt.Sprintf("record with id %d already exists", id))
+	}
+	if id > t.nextID {
+		t.nextID = id
+	}
+
+	if err := t.checkUnique(ctx, id, row); err != nil {
+		return terror.Wrap("t.checkUnique()", err)
+	}
+
+	now := time.Now()
+	setTime(ctx, t.schema, row, "CreatedAt", now)
+	setTime(ctx, t.schema, row, "UpdatedAt", now)
+
+	t.set(ctx, id, row)
+	copyBack(in, row)
+	return nil
+}
+
+// remove drops the row of in without soft delete, it is used to undo add.
+func (m *DB) remove(ctx context.Context, in interface{}) {
+	t, err := m.table(in)
+	if err != nil {
+		return
+	}
+	if id, err := t.id(ctx, reflect.Indirect(reflect.ValueOf(in))); err == nil {
+		t.unset(ctx, id)
+	}
+}
+
+func (m *DB) GetOne(ctx context.Context, in interface{}, params tdatabase.ParamRequest) (interface{}, error) {
+	if err := checkInclude(params); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	t, err := m.table(in)
+	if err != nil {
+		return nil, terror.Wrap("m.table()", err)
+	}
+
+	rows, err := t.find(ctx, params)
+	if err != nil {
+		return nil, terror.Wrap("t.find()", err)
+	}
+	if len(rows) == 0 {
+		return nil, terror.NewNotFound("record not found")
+	}
+
+	copyBack(in, rows[0])
+	return in, nil
+}
+
+func (m *DB) GetMany(ctx context.Context, in interface{}, params tdatabase.ParamRequest) ([]interface{}, error) {
+	if err := checkInclude(params); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	t, err := m.table(in)
+	if err != nil {
+		return nil, terror.Wrap("m.table()", err)
+	}
+
+	rows, err := t.find(ctx, params)
+	if err != nil {
+		return nil, terror.Wrap("t.find()", err)
+	}
+
+	rows, err = t.paginate(ctx, rows, params)
+	if err != nil {
+		return nil, terror.Wrap("t.paginate()", err)
+	}
+
+	var result []any
+	for _, row := range rows {
+		newIn := reflect.New(row.Type())
+		newIn.Elem().Set(row)
+		result = append(result, newIn.Interface())
+	}
+	return result, nil
+}
+
+func (m *DB) Count(ctx context.Context, in interface{}, params tdatabase.ParamRequest) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	t, err := m.table(in)
+	if err != nil {
+		return 0, terror.Wrap("m.table()", err)
+	}
+
+	rows, err := t.find(ctx, params)
+	if err != nil {
+		return 0, terror.Wrap("t.find()", err)
+	}
+	return int64(len(rows)), nil
+}
+
+// Update copies every non-zero field of update onto the stored record, like gorm Updates does.
+func (m *DB) Update(ctx context.Context, update interface{}, in interface{}, id interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, err := m.table(in)
+	if err != nil {
+		return terror.Wrap("m.table()", err)
+	}
+
+	rowID, ok := parseID(id)
+	row, found := t.rows[rowID]
+	if !ok || !found || t.deleted(ctx, row) {
+		return terror.NewNotFound(fmt.Sprintf("record with id %v not found", id))
+	}
+
+	updateValue := reflect.Indirect(reflect.ValueOf(update))
+	if updateValue.Type() != row.Type() {
+		return terror.NewBadRequest(fmt.Sprintf("wrong update type %s", updateValue.Type()))
+	}
+
+	updated := reflect.New(row.Type()).Elem()
+	updated.Set(row)
+	for _, field := range t.schema.Fields {
+		if field.PrimaryKey || field.Name == "CreatedAt" {
+			continue
+		}
+		value, isZero := field.ValueOf(ctx, updateValue)
+		if isZero {
+			continue
+		}
+		if err := field.Set(ctx, updated, value); err != nil {
+			return terror.NewInternalf("field.Set()", err)
+		}
+	}
+	if err := t.checkUnique(ctx, rowID, updated); err != nil {
+		return terror.Wrap("t.checkUnique()", err)
+	}
+	setTime(ctx, t.schema, updated, "UpdatedAt", time.Now())
+
+	t.set(ctx, rowID, updated)
+	copyBack(in, updated)
+	return nil
+}
+
+// Delete marks the record as deleted when the model has a DeletedAt field, otherwise removes it. A missing
+// or already deleted record is NotFound.
+func (m *DB) Delete(ctx context.Context, in interface{}, id interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, err := m.table(in)
+	if err != nil {
+		return terror.Wrap("m.table()", err)
+	}
+	rowID, ok := parseID(id)
+	if row, found := t.rows[rowID]; !ok || !found || t.deleted(ctx, row) {
+		return terror.NewNotFound(fmt.Sprintf("record with id %v not found", id))
+	}
+	return t.delete(ctx, rowID)
+}
+
+// checkInclude rejects params.Include, the memory store keeps no relations to load, so a request with an
+// include fails instead of returning records without the related ones.
+func checkInclude(params tdatabase.ParamRequest) error {
+	if len(params.Include) == 0 {
+		return nil
+	}
+	return terror.New(terror.BadRequest, fmt.Sprintf("include %s is not supported by the memory store", strings.Join(params.Include, ","))).
+		WithCode("unsupported_include")
+}
+
+// parseID returns the row key of an id passed to Update or Delete, an id which is not a non-negative
+// integer matches no row.
+func parseID(id interface{}) (uint64, bool) {
+	rowID, err := strconv.ParseUint(fmt.Sprint(id), 10, 64)
+	return rowID, err == nil
+}
+
+// DeleteMany deletes every record matching params, params without any condition are rejected.
+func (m *DB) DeleteMany(ctx context.Context, in interface{}, params tdatabase.ParamRequest) ([]tdatabase.Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(params.Conditions()) == 0 {
+		return nil, terror.NewBadRequest("delete many requires at least one filter")
+	}
+
+	t, err := m.table(in)
+	if err != nil {
+		return nil, terror.Wrap("m.table()", err)
+	}
+
+	rows, err := t.find(ctx, params)
+	if err != nil {
+		return nil, terror.Wrap("t.find()", err)
+	}
+
+	results := make([]tdatabase.Result, 0, len(rows))
+	for i, row := range rows {
+		id, err := t.id(ctx, row)
+		if err != nil {
+			return nil, terror.Wrap("t.id()", err)
+		}
+		if err := t.delete(ctx, id); err != nil {
+			return nil, terror.Wrap("t.delete()", err)
+		}
+		if deleted, ok := t.rows[id]; ok {
+			row = deleted
+		}
+		item := reflect.New(row.Type())
+		item.Elem().Set(row)
+		results = append(results, tdatabase.Result{Index: i, Item: item.Interface()})
+	}
+	return results, nil
+}
+
+// undoCtxKey keys the undo log of one store in a context, so another store never writes to it.
+type undoCtxKey struct {
+	db *DB
+}
+
+// undoLog holds the former rows of every row written in a transaction, in the order of the writes.
+type undoLog struct {
+	changes []change
+}
+
+type change struct {
+	table   *table
+	id      uint64
+	row     reflect.Value
+	existed bool
+}
+
+func undoFromCtx(ctx context.Context, db *DB) *undoLog {
+	if log, ok := ctx.Value(undoCtxKey{db: db}).(*undoLog); ok {
+		return log
+	}
+	return nil
+}
+
+// WithTx runs fn with an undo log carried by the context passed to fn, every write made with that context
+// records the row it replaces. When fn returns an error or panics only those rows are restored, so writes of
+// other callers are kept. A nested WithTx works like a savepoint. Changes are visible to other callers before
+// fn returns, the memory store has no isolation.
+func (m *DB) WithTx(ctx context.Context, fn func(ctx context.Context, tx tdatabase.DBOperations) error) (err error) {
+	log := &undoLog{}
+
+	defer func() {
+		if p := recover(); p != nil {
+			m.rollback(log)
+			panic(p)
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, undoCtxKey{db: m}, log), m); err != nil {
+		m.rollback(log)
+		return terror.Wrap("fn()", err)
+	}
+
+	if parent := undoFromCtx(ctx, m); parent != nil {
+		m.mu.Lock()
+		parent.changes = append(parent.changes, log.changes...)
+		m.mu.Unlock()
+	}
+	return nil
+}
+
+// rollback restores the rows of log in the reverse order of the writes. Ids taken in the transaction are
+// not reused, like a sequence in SQL.
+func (m *DB) rollback(log *undoLog) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(log.changes) - 1; i >= 0; i-- {
+		c := log.changes[i]
+		if c.existed {
+			c.table.rows[c.id] = c.row
+		} else {
+			delete(c.table.rows, c.id)
+		}
+	}
+	log.changes = nil
+}
+
+func (m *DB) register(in interface{}) (*table, error) {
+	typ := modelType(in)
+	if t, ok := m.tables[typ]; ok {
+		return t, nil
+	}
+
+	s, err := schema.Parse(reflect.New(typ).Interface(), m.schemas, schema.NamingStrategy{})
+	if err != nil {
+		return nil, terror.NewInternalf("schema.Parse()", err)
+	}
+	if s.PrioritizedPrimaryField == nil {
+		return nil, terror.NewInternal(fmt.Sprintf("model %s has no primary key", s.Name))
+	}
+	switch s.PrioritizedPrimaryField.IndirectFieldType.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		return nil, terror.New(terror.Internal, fmt.Sprintf("model %s has a %s primary key, the memory store supports only integer keys",
+			s.Name, s.PrioritizedPrimaryField.FieldType)).WithCode("unsupported_key")
+	}
+
+	t := &table{
+		db:     m,
+		schema: s,
+		rows:   make(map[uint64]reflect.Value),
+		unique: uniqueFields(s),
+	}
+	m.tables[typ] = t
+	return t, nil
+}
+
+func (m *DB) table(in interface{}) (*table, error) {
+	if t, ok := m.tables[modelType(in)]; ok {
+		return t, nil
+	}
+	return nil, terror.NewInternal(fmt.Sprintf("model %s is not migrated", modelType(in)))
+}
+
+func (t *table) id(ctx context.Context, row reflect.Value) (uint64, error) {
+	value, isZero := t.schema.PrioritizedPrimaryField.ValueOf(ctx, row)
+	if isZero {
+		return 0, nil
+	}
+	id, err := strconv.ParseUint(fmt.Sprint(value), 10, 64)
+	if err != nil {
+		return 0, terror.NewInternalf("strconv.ParseUint()", err)
+	}
+	return id, nil
+}
+
+func (t *table) setID(ctx context.Context, row reflect.Value, id uint64) error {
+	if err := t.schema.PrioritizedPrimaryField.Set(ctx, row, id); err != nil {
+		return terror.NewInternalf("field.Set()", err)
+	}
+	return nil
+}
+
+// uniqueFields returns the fields of every unique index and unique field of s.
+func uniqueFields(s *schema.Schema) [][]*schema.Field {
+	var (
+		unique [][]*schema.Field
+		seen   = map[string]bool{}
+	)
+	add := func(fields []*schema.Field) {
+		key := fieldNames(fields)
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, fields)
+		}
+	}
+
+	indexes := s.ParseIndexes()
+	names := make([]string, 0, len(indexes))
+	for name := range indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if index := indexes[name]; index.Class == "UNIQUE" {
+			fields := make([]*schema.Field, len(index.Fields))
+			for i, option := range index.Fields {
+				fields[i] = option.Field
+			}
+			add(fields)
+		}
+	}
+	for _, field := range s.Fields {
+		if field.Unique {
+			add([]*schema.Field{field})
+		}
+	}
+	return unique
+}
+
+// checkUnique returns a Conflict when row, stored as id, has the values of another row in a unique index.
+// Soft deleted rows count like in SQL and a NULL value never conflicts.
+func (t *table) checkUnique(ctx context.Context, id uint64, row reflect.Value) error {
+	for _, fields := range t.unique {
+		key, ok := uniqueKey(ctx, fields, row)
+		if !ok {
+			continue
+		}
+		for otherID, other := range t.rows {
+			if otherID == id {
+				continue
+			}
+			if otherKey, ok := uniqueKey(ctx, fields, other); ok && otherKey == key {
+				return terror.New(terror.Conflict, fmt.Sprintf("duplicated key %s", fieldNames(fields))).WithCode("duplicated_key")
+			}
+		}
+	}
+	return nil
+}
+
+func uniqueKey(ctx context.Context, fields []*schema.Field, row reflect.Value) (string, bool) {
+	values := make([]string, len(fields))
+	for i, field := range fields {
+		fieldValue := field.ReflectValueOf(ctx, row)
+		if fieldValue.Kind() == reflect.Ptr {
+			if fieldValue.IsNil() {
+				return "", false
+			}
+			fieldValue = fieldValue.Elem()
+		}
+
+		value := fieldValue.Interface()
+		if valuer, ok := value.(driver.Valuer); ok {
+			var err error
+			if value, err = valuer.Value(); err != nil || value == nil {
+				return "", false
+			}
+		}
+		values[i] = fmt.Sprint(value)
+	}
+	return strings.Join(values, "\x00"), true
+}
+
+func fieldNames(fields []*schema.Field) string {
+	names := make([]string, len(fields))
+	for i, field := range fields {
+		names[i] = field.DBName
+	}
+	return strings.Join(names, ",")
+}
+
+// set stores row as id and records the replaced row in the undo log of the transaction in ctx.
+func (t *table) set(ctx context.Context, id uint64, row reflect.Value) {
+	t.record(ctx, id)
+	t.rows[id] = row
+}
+
+func (t *table) unset(ctx context.Context, id uint64) {
+	t.record(ctx, id)
+	delete(t.rows, id)
+}
+
+func (t *table) record(ctx context.Context, id uint64) {
+	if log := undoFromCtx(ctx, t.db); log != nil {
+		row, existed := t.rows[id]
+		log.changes = append(log.changes, change{table: t, id: id, row: row, existed: existed})
+	}
+}
+
+func (t *table) delete(ctx context.Context, id uint64) error {
+	row, ok := t.rows[id]
+	if !ok {
+		return nil
+	}
+
+	if field := t.schema.LookUpField("DeletedAt"); field != nil {
+		deleted := reflect.New(row.Type()).Elem()
+		deleted.Set(row)
+		if err := field.Set(ctx, deleted, gorm.DeletedAt{Time: time.Now(), Valid: true}); err != nil {
+			return terror.NewInternalf("field.Set()", err)
+		}
+		t.set(ctx, id, deleted)
+		return nil
+	}
+
+	t.unset(ctx, id)
+	return nil
+}
+
+func (t *table) deleted(ctx context.Context, row reflect.Value) bool {
+	field := t.schema.LookUpField("DeletedAt")
+	if field == nil {
+		return false
+	}
+	_, isZero := field.ValueOf(ctx, row)
+	return !isZero
+}
+
+// find returns the not deleted rows matching params ordered by id.
+func (t *table) find(ctx context.Context, params tdatabase.ParamRequest) ([]reflect.Value, error) {
+	conditions := params.Conditions()
+	fields := make([]*schema.Field, len(conditions))
+	for i, condition := range conditions {
+		fields[i] = t.schema.LookUpField(condition.Field)
+		if fields[i] == nil || fields[i].DBName == "" {
+			return nil, terror.NewBadRequest(fmt.Sprintf("wrong filter field %s", condition.Field))
+		}
+	}
+
+	ids := make([]uint64, 0, len(t.rows))
+	for id := range t.rows {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var result []reflect.Value
+rows:
+	for _, id := range ids {
+		row := t.rows[id]
+		if t.deleted(ctx, row) {
+			continue
+		}
+		for i, condition := range conditions {
+			ok, err := matches(ctx, fields[i], row, condition)
+			if err != nil {
+				return nil, terror.Wrap("matches()", err)
+			}
+			if !ok {
+				continue rows
+			}
+		}
+		result = append(result, row)
+	}
+	return result, nil
+}
+
+// paginate sorts rows by the keyset of params, they are already ordered by id, and cuts the page after the
+// cursor or at the offset.
+func (t *table) paginate(ctx context.Context, rows []reflect.Value, params tdatabase.ParamRequest) ([]reflect.Value, error) {
+	limit, offset, err := params.Window()
+	if err != nil {
+		return nil, terror.NewBadRequest(err.Error())
+	}
+	keyset, err := params.Keyset(t.schema)
+	if err != nil {
+		return nil, terror.NewBadRequest(err.Error())
+	}
+
+	var sortErr error
+	sort.SliceStable(rows, func(i, j int) bool {
+		c, err := compareKeys(keyset, keyOf(ctx, keyset, rows[i]), keyOf(ctx, keyset, rows[j]))
+		if err != nil {
+			sortErr = err
+		}
+		return c < 0
+	})
+	if sortErr != nil {
+		return nil, sortErr
+	}
+
+	if keyset.Values != nil {
+		var page []reflect.Value
+		for _, row := range rows {
+			c, err := compareKeys(keyset, keyOf(ctx, keyset, row), keyset.Values)
+			if err != nil {
+				return nil, err
+			}
+			if (c > 0 && !keyset.Before) || (c < 0 && keyset.Before) {
+				page = append(page, row)
+			}
+		}
+		rows = page
+		if keyset.Before && limit > 0 && len(rows) > limit {
+			return rows[len(rows)-limit:], nil
+		}
+	}
+
+	if offset >= len(rows) {
+		return nil, nil
+	}
+	end := offset + limit
+	if limit == 0 || end > len(rows) {
+		end = len(rows)
+	}
+	return rows[offset:end], nil
+}
+
+// keyOf returns the values of the keyset fields of row.
+func keyOf(ctx context.Context, keyset *tdatabase.Keyset, row reflect.Value) []interface{} {
+	key := make([]interface{}, len(keyset.Fields))
+	for i, field := range keyset.Fields {
+		value := field.ReflectValueOf(ctx, row)
+		if value.Kind() == reflect.Ptr && !value.IsNil() {
+			value = value.Elem()
+		}
+		key[i] = value.Interface()
+	}
+	return key
+}
+
+// compareKeys orders two keys in the order of keyset, descending fields compare the other way round.
+func compareKeys(keyset *tdatabase.Keyset, a []interface{}, b []interface{}) (int, error) {
+	for i := range keyset.Fields {
+		c, err := compare(a[i], b[i])
+		if err != nil {
+			return 0, err
+		}
+		if c == 0 {
+			continue
+		}
+		if keyset.Desc[i] {
+			return -c, nil
+		}
+		return c, nil
+	}
+	return 0, nil
+}
+
+func matches(ctx context.Context, field *schema.Field, row reflect.Value, condition tdatabase.Condition) (bool, error) {
+	value, isZero := field.ValueOf(ctx, row)
+
+	switch condition.Operator {
+	case tdatabase.OpEq:
+		return fmt.Sprint(value) == fmt.Sprint(condition.Value), nil
+	case tdatabase.OpNe:
+		return fmt.Sprint(value) != fmt.Sprint(condition.Value), nil
+	case tdatabase.OpIn, tdatabase.OpNotIn:
+		in := false
+		for _, v := range condition.Values() {
+			if fmt.Sprint(value) == fmt.Sprint(v) {
+				in = true
+				break
+			}
+		}
+		return in == (condition.Operator == tdatabase.OpIn), nil
+	case tdatabase.OpLike:
+		return like(fmt.Sprint(value), fmt.Sprint(condition.Value)), nil
+	case tdatabase.OpNull:
+		isNull, _ := condition.Value.(bool)
+		return isZero == isNull, nil
+	}
+
+	c, err := compare(value, condition.Value)
+	if err != nil {
+		return false, err
+	}
+	switch condition.Operator {
+	case tdatabase.OpLt:
+		return c < 0, nil
+	case tdatabase.OpLte:
+		return c <= 0, nil
+	case tdatabase.OpGt:
+		return c > 0, nil
+	case tdatabase.OpGte:
+		return c >= 0, nil
+	}
+	return false, terror.NewBadRequest(fmt.Sprintf("wrong filter operator %s", condition.Operator))
+}
+
+// like matches value against a SQL LIKE pattern where "%" is any text and "_" any single character.
+func like(value string, pattern string) bool {
+	var expr strings.Builder
+	expr.WriteString("(?s)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			expr.WriteString(".*")
+		case '_':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String()).MatchString(value)
+}
+
+// compare orders a field value against a request value which usually comes from the query string.
+func compare(value interface{}, to interface{}) (int, error) {
+	switch v := value.(type) {
+	case time.Time:
+		t, ok := to.(time.Time)
+		if !ok {
+			parsed, err := time.Parse(time.RFC3339, fmt.Sprint(to))
+			if err != nil {
+				return 0, terror.NewBadRequest(fmt.Sprintf("wrong time value %v", to))
+			}
+			t = parsed
+		}
+		return v.Compare(t), nil
+	case string:
+		return strings.Compare(v, fmt.Sprint(to)), nil
+	}
+
+	a, err := strconv.ParseFloat(fmt.Sprint(value), 64)
+	if err != nil {
+		return strings.Compare(fmt.Sprint(value), fmt.Sprint(to)), nil
+	}
+	b, err := strconv.ParseFloat(fmt.Sprint(to), 64)
+	if err != nil {
+		return 0, terror.NewBadRequest(fmt.Sprintf("wrong number value %v", to))
+	}
+	switch {
+	case a < b:
+		return -1, nil
+	case a > b:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func setTime(ctx context.Context, s *schema.Schema, row reflect.Value, name string, now time.Time) {
+	if field := s.LookUpField(name); field != nil {
+		_ = field.Set(ctx, row, now)
+	}
+}
+
+func copyBack(in interface{}, row reflect.Value) {
+	value := reflect.ValueOf(in)
+	if value.Kind() == reflect.Ptr && !value.IsNil() {
+		value.Elem().Set(row)
+	}
+}
+
+func modelType(in interface{}) reflect.Type {
+	typ := reflect.TypeOf(in)
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ
+}
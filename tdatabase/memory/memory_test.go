@@ -0,0 +1,573 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"github.com/WojciechWiderski/tofu/tdatabase"
+	"github.com/WojciechWiderski/tofu/terror"
+	"github.com/WojciechWiderski/tofu/tmodel"
+)
+
+type item struct {
+	ID    uint
+	Name  string  `gorm:"uniqueIndex"`
+	Group string  `gorm:"uniqueIndex:idx_group_slot"`
+	Slot  int     `gorm:"uniqueIndex:idx_group_slot"`
+	Email *string `gorm:"unique"`
+	Count int
+}
+
+type note struct {
+	ID        uint
+	Text      string
+	DeletedAt gorm.DeletedAt
+}
+
+func newDB(t *testing.T) *DB {
+	t.Helper()
+	db := New(tmodel.NewModels(tmodel.NewModel(&item{}, "item"), tmodel.NewModel(&note{}, "note")))
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	return db
+}
+
+func email(in string) *string {
+	return &in
+}
+
+func TestDB_AddUnique(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []item
+		kind  terror.Kind
+	}{
+		{name: "distinct", items: []item{{Name: "a", Slot: 1}, {Name: "b", Slot: 2}}},
+		{name: "duplicated unique index", items: []item{{Name: "a", Slot: 1}, {Name: "a", Slot: 2}}, kind: terror.Conflict},
+		{name: "duplicated composite index", items: []item{{Name: "a", Group: "g", Slot: 1}, {Name: "b", Group: "g", Slot: 1}}, kind: terror.Conflict},
+		{name: "composite index differs in one field", items: []item{{Name: "a", Group: "g", Slot: 1}, {Name: "b", Group: "g", Slot: 2}}},
+		{name: "duplicated unique field", items: []item{{Name: "a", Slot: 1, Email: email("x")}, {Name: "b", Slot: 2, Email: email("x")}}, kind: terror.Conflict},
+		{name: "null unique field", items: []item{{Name: "a", Slot: 1}, {Name: "b", Slot: 2}}},
+		{name: "duplicated id", items: []item{{ID: 1, Name: "a", Slot: 1}, {ID: 1, Name: "b", Slot: 2}}, kind: terror.Conflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := newDB(t)
+			var err error
+			for i := range tt.items {
+				if err = db.Add(ctx, &tt.items[i]); err != nil {
+					break
+				}
+			}
+			if tt.kind == (terror.Kind{}) && err != nil {
+				t.Fatalf("Add() error = %v", err)
+			}
+			if tt.kind != (terror.Kind{}) && !errors.Is(err, tt.kind) {
+				t.Errorf("Add() error = %v, want %s", err, tt.kind)
+			}
+		})
+	}
+}
+
+func TestDB_UpdateUnique(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(t)
+	for _, in := range []*item{{Name: "a", Slot: 1}, {Name: "b", Slot: 2}} {
+		if err := db.Add(ctx, in); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		id     int
+		update item
+		kind   terror.Kind
+	}{
+		{name: "own value", id: 1, update: item{Name: "a", Count: 3}},
+		{name: "value of another record", id: 2, update: item{Name: "a"}, kind: terror.Conflict},
+		{name: "missing record", id: 9, update: item{Count: 1}, kind: terror.NotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := db.Update(ctx, &tt.update, &item{}, tt.id)
+			if tt.kind == (terror.Kind{}) && err != nil {
+				t.Fatalf("Update() error = %v", err)
+			}
+			if tt.kind != (terror.Kind{}) && !errors.Is(err, tt.kind) {
+				t.Errorf("Update() error = %v, want %s", err, tt.kind)
+			}
+		})
+	}
+}
+
+func TestDB_GetManyFilter(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(t)
+	for i, name := range []string{"apple", "banana", "cherry", "date"} {
+		if err := db.Add(ctx, &item{Name: name, Slot: i, Count: i * 10}); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter tdatabase.Filter
+		want   []string
+		kind   terror.Kind
+	}{
+		{name: "eq", filter: tdatabase.Filter{{Field: "name", Operator: tdatabase.OpEq, Value: "banana"}}, want: []string{"banana"}},
+		{name: "in with []any", filter: tdatabase.Filter{{Field: "id", Operator: tdatabase.OpIn, Value: []any{"1", "3"}}}, want: []string{"apple", "cherry"}},
+		{name: "in with []uint", filter: tdatabase.Filter{{Field: "id", Operator: tdatabase.OpIn, Value: []uint{2, 4}}}, want: []string{"banana", "date"}},
+		{name: "nin with []string", filter: tdatabase.Filter{{Field: "name", Operator: tdatabase.OpNotIn, Value: []string{"apple", "date"}}}, want: []string{"banana", "cherry"}},
+		{name: "in with a single value", filter: tdatabase.Filter{{Field: "name", Operator: tdatabase.OpIn, Value: "cherry"}}, want: []string{"cherry"}},
+		{name: "gte", filter: tdatabase.Filter{{Field: "count", Operator: tdatabase.OpGte, Value: "20"}}, want: []string{"cherry", "date"}},
+		{name: "like", filter: tdatabase.Filter{{Field: "name", Operator: tdatabase.OpLike, Value: "%an%"}}, want: []string{"banana"}},
+		{name: "wrong field", filter: tdatabase.Filter{{Field: "nope", Operator: tdatabase.OpEq, Value: "1"}}, kind: terror.BadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := db.GetMany(ctx, &item{}, tdatabase.ParamRequest{Filter: tt.filter})
+			if tt.kind != (terror.Kind{}) {
+				if !errors.Is(err, tt.kind) {
+					t.Errorf("GetMany() error = %v, want %s", err, tt.kind)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetMany() error = %v", err)
+			}
+			var got []string
+			for _, o := range out {
+				got = append(got, o.(*item).Name)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("GetMany() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("GetMany() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDB_SoftDelete(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(t)
+	if err := db.Add(ctx, &note{Text: "a"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := db.Delete(ctx, &note{}, 1); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := db.Delete(ctx, &note{}, 1); !errors.Is(err, terror.NotFound) {
+		t.Errorf("Delete() of a deleted record error = %v, want %s", err, terror.NotFound)
+	}
+
+	if _, err := db.GetOne(ctx, &note{}, tdatabase.ParamRequest{By: "id", Value: 1}); !errors.Is(err, terror.NotFound) {
+		t.Errorf("GetOne() error = %v, want %s", err, terror.NotFound)
+	}
+	if total, err := db.Count(ctx, &note{}, tdatabase.ParamRequest{}); err != nil || total != 0 {
+		t.Errorf("Count() = %d, %v, want 0", total, err)
+	}
+}
+
+func TestDB_GetManyWindow(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(t)
+	for i := 0; i < 150; i++ {
+		if err := db.Add(ctx, &item{Name: fmt.Sprint(i), Slot: i, Count: i}); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		params    tdatabase.ParamRequest
+		wantLen   int
+		wantFirst int
+	}{
+		{name: "no limit reads every record", params: tdatabase.ParamRequest{}, wantLen: 150, wantFirst: 0},
+		{name: "offset without limit", params: tdatabase.ParamRequest{Offset: 140}, wantLen: 10, wantFirst: 140},
+		{name: "limit and offset", params: tdatabase.ParamRequest{Limit: 5, Offset: 10}, wantLen: 5, wantFirst: 10},
+		{name: "sorted descending", params: tdatabase.ParamRequest{Limit: 1, Sort: []tdatabase.Sort{{Field: "count", Desc: true}}}, wantLen: 1, wantFirst: 149},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := db.GetMany(ctx, &item{}, tt.params)
+			if err != nil {
+				t.Fatalf("GetMany() error = %v", err)
+			}
+			if len(out) != tt.wantLen {
+				t.Fatalf("GetMany() len = %d, want %d", len(out), tt.wantLen)
+			}
+			if got := out[0].(*item).Count; got != tt.wantFirst {
+				t.Errorf("GetMany() first = %d, want %d", got, tt.wantFirst)
+			}
+		})
+	}
+}
+
+func TestDB_GetManyCursor(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name         string
+		sort         string
+		insert       int
+		wantForward  string
+		wantBackward string
+	}{
+		{name: "primary key", insert: 0, wantForward: "abc def gx", wantBackward: "abcdefgx"},
+		{name: "ties broken by primary key", sort: "count", insert: -1, wantForward: "bdg cfa e", wantBackward: "xbdgcfae"},
+		{name: "descending", sort: "-count", insert: 3, wantForward: "aec fbd g", wantBackward: "xaecfbdg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newDB(t)
+			for i, count := range []int{2, 0, 1, 0, 2, 1, 0} {
+				if err := db.Add(ctx, &item{Name: string(rune('a' + i)), Slot: i, Count: count}); err != nil {
+					t.Fatalf("Add() error = %v", err)
+				}
+			}
+			read := func(cursor string) ([]string, *tdatabase.Page) {
+				params := tdatabase.ParamRequest{Limit: 3, Sort: tdatabase.ParseSort(tt.sort), Cursor: cursor}
+				items, err := db.GetMany(ctx, &item{}, params)
+				if err != nil {
+					t.Fatalf("GetMany() error = %v", err)
+				}
+				total, err := db.Count(ctx, &item{}, params)
+				if err != nil {
+					t.Fatalf("Count() error = %v", err)
+				}
+				page, err := tdatabase.NewPage(items, total, params)
+				if err != nil {
+					t.Fatalf("NewPage() error = %v", err)
+				}
+				var names []string
+				for _, found := range items {
+					names = append(names, found.(*item).Name)
+				}
+				return names, page
+			}
+
+			// A record added before the position of the next cursor is neither read nor shifts the pages.
+			var forward []string
+			names, page := read("")
+			forward = append(forward, strings.Join(names, ""))
+			if err := db.Add(ctx, &item{Name: "x", Slot: 99, Count: tt.insert}); err != nil {
+				t.Fatalf("Add() error = %v", err)
+			}
+			for page.NextCursor != "" {
+				names, page = read(page.NextCursor)
+				forward = append(forward, strings.Join(names, ""))
+			}
+			if got := strings.TrimSpace(strings.Join(forward, " ")); got != tt.wantForward {
+				t.Errorf("forward pages = %s, want %s", got, tt.wantForward)
+			}
+
+			last := forward[len(forward)-1]
+			backward := last
+			for cursor := page.PrevCursor; cursor != ""; cursor = page.PrevCursor {
+				names, page = read(cursor)
+				backward = strings.Join(names, "") + backward
+			}
+			if backward != tt.wantBackward {
+				t.Errorf("backward pages = %s, want %s", backward, tt.wantBackward)
+			}
+		})
+	}
+}
+
+func TestDB_Delete(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(t)
+	if err := db.Add(ctx, &item{Name: "a"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		id   int
+		kind terror.Kind
+	}{
+		{name: "existing record", id: 1},
+		{name: "same record again", id: 1, kind: terror.NotFound},
+		{name: "missing record", id: 9, kind: terror.NotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := db.Delete(ctx, &item{}, tt.id)
+			if tt.kind == (terror.Kind{}) && err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			if tt.kind != (terror.Kind{}) && !errors.Is(err, tt.kind) {
+				t.Errorf("Delete() error = %v, want %s", err, tt.kind)
+			}
+		})
+	}
+}
+
+func TestDB_WithTx(t *testing.T) {
+	rollback := errors.New("rollback")
+
+	tests := []struct {
+		name      string
+		fn        func(ctx context.Context, tx tdatabase.DBOperations) error
+		wantErr   error
+		wantPanic bool
+		want      []string
+	}{
+		{
+			name: "commit",
+			fn: func(ctx context.Context, tx tdatabase.DBOperations) error {
+				return tx.Add(ctx, &item{Name: "b", Slot: 2})
+			},
+			want: []string{"a", "b"},
+		},
+		{
+			name: "error rolls back add, update and delete",
+			fn: func(ctx context.Context, tx tdatabase.DBOperations) error {
+				if err := tx.Add(ctx, &item{Name: "b", Slot: 2}); err != nil {
+					return err
+				}
+				if err := tx.Update(ctx, &item{Name: "c"}, &item{}, 1); err != nil {
+					return err
+				}
+				if err := tx.Delete(ctx, &item{}, 1); err != nil {
+					return err
+				}
+				return rollback
+			},
+			wantErr: rollback,
+			want:    []string{"a"},
+		},
+		{
+			name: "panic rolls back",
+			fn: func(ctx context.Context, tx tdatabase.DBOperations) error {
+				if err := tx.Add(ctx, &item{Name: "b", Slot: 2}); err != nil {
+					return err
+				}
+				panic("boom")
+			},
+			wantPanic: true,
+			want:      []string{"a"},
+		},
+		{
+			name: "failed nested transaction is a savepoint",
+			fn: func(ctx context.Context, tx tdatabase.DBOperations) error {
+				if err := tx.Add(ctx, &item{Name: "b", Slot: 2}); err != nil {
+					return err
+				}
+				_ = tx.WithTx(ctx, func(ctx context.Context, tx tdatabase.DBOperations) error {
+					if err := tx.Add(ctx, &item{Name: "c", Slot: 3}); err != nil {
+						return err
+					}
+					return rollback
+				})
+				return nil
+			},
+			want: []string{"a", "b"},
+		},
+		{
+			name: "committed nested transaction rolls back with the outer one",
+			fn: func(ctx context.Context, tx tdatabase.DBOperations) error {
+				if err := tx.WithTx(ctx, func(ctx context.Context, tx tdatabase.DBOperations) error {
+					return tx.Add(ctx, &item{Name: "c", Slot: 3})
+				}); err != nil {
+					return err
+				}
+				return rollback
+			},
+			wantErr: rollback,
+			want:    []string{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := newDB(t)
+			if err := db.Add(ctx, &item{Name: "a", Slot: 1}); err != nil {
+				t.Fatalf("Add() error = %v", err)
+			}
+
+			func() {
+				defer func() {
+					if p := recover(); (p != nil) != tt.wantPanic {
+						t.Errorf("WithTx() panic = %v, wantPanic %v", p, tt.wantPanic)
+					}
+				}()
+				if err := db.WithTx(ctx, tt.fn); !errors.Is(err, tt.wantErr) {
+					t.Errorf("WithTx() error = %v, want %v", err, tt.wantErr)
+				}
+			}()
+
+			out, err := db.GetMany(ctx, &item{}, tdatabase.ParamRequest{})
+			if err != nil {
+				t.Fatalf("GetMany() error = %v", err)
+			}
+			var got []string
+			for _, o := range out {
+				got = append(got, o.(*item).Name)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("records = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestDB_WithTxConcurrentRollback checks that a rollback only undoes its own writes while other
+// transactions commit at the same time, every transaction writes before any of them ends.
+func TestDB_WithTxConcurrentRollback(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(t)
+	rollback := errors.New("rollback")
+
+	const n = 400
+	var wg, written sync.WaitGroup
+	written.Add(n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = db.WithTx(ctx, func(ctx context.Context, tx tdatabase.DBOperations) error {
+				err := tx.Add(ctx, &item{Name: fmt.Sprint(i), Slot: i})
+				written.Done()
+				written.Wait()
+				if err != nil {
+					return err
+				}
+				if i%2 == 0 {
+					return rollback
+				}
+				return nil
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	committed := 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			committed++
+		case i%2 == 0 && errors.Is(err, rollback):
+		default:
+			t.Errorf("WithTx() %d error = %v", i, err)
+		}
+	}
+
+	total, err := db.Count(ctx, &item{}, tdatabase.ParamRequest{})
+	if err != nil {
+		t.Fatalf("Count() error = %v", err)
+	}
+	if committed != n/2 || total != int64(committed) {
+		t.Errorf("committed %d transactions and stored %d records, want %d", committed, total, n/2)
+	}
+}
+
+func TestDB_Unsupported(t *testing.T) {
+	type code struct {
+		Code string `gorm:"primaryKey"`
+	}
+	type token struct {
+		ID [16]byte
+	}
+	ctx := context.Background()
+	db := newDB(t)
+	if err := db.Add(ctx, &item{Name: "a"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		run      func() error
+		kind     terror.Kind
+		wantCode string
+	}{
+		{name: "string key", run: func() error {
+			return New(tmodel.NewModels(tmodel.NewModel(&code{}, "code"))).Migrate()
+		}, kind: terror.Internal, wantCode: "unsupported_key"},
+		{name: "uuid key", run: func() error {
+			return New(tmodel.NewModels(tmodel.NewModel(&token{}, "token"))).Migrate()
+		}, kind: terror.Internal, wantCode: "unsupported_key"},
+		{name: "get one with include", run: func() error {
+			_, err := db.GetOne(ctx, &item{}, tdatabase.ParamRequest{By: "id", Value: 1, Include: []string{"Notes"}})
+			return err
+		}, kind: terror.BadRequest, wantCode: "unsupported_include"},
+		{name: "get many with include", run: func() error {
+			_, err := db.GetMany(ctx, &item{}, tdatabase.ParamRequest{Include: []string{"Notes"}})
+			return err
+		}, kind: terror.BadRequest, wantCode: "unsupported_include"},
+		{name: "update with a string id", run: func() error { return db.Update(ctx, &item{Count: 1}, &item{}, "a") }, kind: terror.NotFound},
+		{name: "delete with a string id", run: func() error { return db.Delete(ctx, &item{}, "a") }, kind: terror.NotFound},
+		{name: "string of an integer id", run: func() error { return db.Update(ctx, &item{Count: 1}, &item{}, "1") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.run()
+			if tt.kind == (terror.Kind{}) {
+				if err != nil {
+					t.Fatalf("error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.kind) {
+				t.Fatalf("error = %v, want %s", err, tt.kind)
+			}
+			var betterError terror.BetterError
+			if tt.wantCode != "" && (!errors.As(err, &betterError) || betterError.Code() != tt.wantCode) {
+				t.Errorf("error code of %v, want %s", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestDB_WithTxTwoStores(t *testing.T) {
+	rollback := errors.New("rollback")
+
+	tests := []struct {
+		name      string
+		err       error
+		wantDB    int64
+		wantOther int64
+	}{
+		{name: "rolled back", err: rollback, wantDB: 0, wantOther: 1},
+		{name: "committed", wantDB: 1, wantOther: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db, other := newDB(t), newDB(t)
+			err := db.WithTx(ctx, func(ctx context.Context, tx tdatabase.DBOperations) error {
+				if err := tx.Add(ctx, &item{Name: "a"}); err != nil {
+					return err
+				}
+				if err := other.Add(ctx, &item{Name: "b"}); err != nil {
+					return err
+				}
+				return tt.err
+			})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("WithTx() error = %v, want %v", err, tt.err)
+			}
+			for store, want := range map[*DB]int64{db: tt.wantDB, other: tt.wantOther} {
+				if got, err := store.Count(ctx, &item{}, tdatabase.ParamRequest{}); err != nil || got != want {
+					t.Errorf("Count() = %d, %v, want %d", got, err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,319 @@
+// Package migration runs ordered, reversible schema migrations against the gorm based backends.
+package migration
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/WojciechWiderski/tofu/terror"
+	"github.com/WojciechWiderski/tofu/tlogger"
+	"github.com/WojciechWiderski/tofu/tmodel"
+)
+
+const lockName = "tofu_schema_migrations"
+
+// GormDB is implemented by the backends migrations can run on.
+type GormDB interface {
+	Gorm() *gorm.DB
+}
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(ctx context.Context, tx *gorm.DB) error
+	Down    func(ctx context.Context, tx *gorm.DB) error
+}
+
+// SchemaMigration is a row of the schema_migrations bookkeeping table.
+type SchemaMigration struct {
+	Version   int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	migrations []Migration
+	// DryRun makes Run log the planned SQL instead of executing it.
+	DryRun bool
+	// LockTimeout limits how long Up and Down wait for another instance to finish migrating.
+	LockTimeout time.Duration
+}
+
+func New(migrations ...Migration) *Migrator {
+	m := &Migrator{LockTimeout: time.Minute}
+	for _, migration := range migrations {
+		m.Add(migration)
+	}
+	return m
+}
+
+func (m *Migrator) Add(migration Migration) *Migrator {
+	m.migrations = append(m.migrations, migration)
+	sort.SliceStable(m.migrations, func(i, j int) bool {
+		return m.migrations[i].Version < m.migrations[j].Version
+	})
+	tlogger.Info(fmt.Sprintf("Migration %d %s added.", migration.Version, migration.Name))
+	return m
+}
+
+// AutoMigrate returns a migration running gorm AutoMigrate for every registered model, it has no down step.
+func AutoMigrate(version int64, models *tmodel.Models) Migration {
+	return Migration{
+		Version: version,
+		Name:    "auto_migrate_models",
+		Up: func(ctx context.Context, tx *gorm.DB) error {
+			for _, model := range models.All {
+				if err := tx.AutoMigrate(model.In); err != nil {
+					return terror.NewInternalf(fmt.Sprintf("tx.AutoMigrate() - model: %s", model.Name), err)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// Run applies the pending migrations, or only logs their SQL when DryRun is set.
+func (m *Migrator) Run(ctx context.Context, db *gorm.DB) error {
+	if !m.DryRun {
+		return m.Up(ctx, db)
+	}
+
+	plan, err := m.Plan(ctx, db)
+	if err != nil {
+		return terror.Wrap("m.Plan()", err)
+	}
+	for _, sql := range plan {
+		tlogger.Info(fmt.Sprintf("Migration dry run: %s", sql))
+	}
+	return nil
+}
+
+// Up applies every pending migration in version order, each one in its own transaction.
+func (m *Migrator) Up(ctx context.Context, db *gorm.DB) error {
+	if err := m.validate(); err != nil {
+		return terror.Wrap("m.validate()", err)
+	}
+
+	return m.locked(ctx, db, func(conn *gorm.DB) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return terror.Wrap("m.applied()", err)
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, conn, migration); err != nil {
+				return terror.Wrap(fmt.Sprintf("m.apply() - migration %d %s", migration.Version, migration.Name), err)
+			}
+		}
+		return nil
+	})
+}
+
+// Down reverts the last steps applied migrations in reverse version order.
+func (m *Migrator) Down(ctx context.Context, db *gorm.DB, steps int) error {
+	if err := m.validate(); err != nil {
+		return terror.Wrap("m.validate()", err)
+	}
+
+	return m.locked(ctx, db, func(conn *gorm.DB) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return terror.Wrap("m.applied()", err)
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if err := m.revert(ctx, conn, migration); err != nil {
+				return terror.Wrap(fmt.Sprintf("m.revert() - migration %d %s", migration.Version, migration.Name), err)
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+// Plan returns the SQL the pending migrations would run without executing it.
+func (m *Migrator) Plan(ctx context.Context, db *gorm.DB) ([]string, error) {
+	if err := m.validate(); err != nil {
+		return nil, terror.Wrap("m.validate()", err)
+	}
+
+	applied := map[int64]SchemaMigration{}
+	if db.Migrator().HasTable(&SchemaMigration{}) {
+		var err error
+		if applied, err = m.applied(db); err != nil {
+			return nil, terror.Wrap("m.applied()", err)
+		}
+	}
+
+	recorder := &recorder{}
+	dryRun := db.Session(&gorm.Session{DryRun: true, Logger: recorder, Context: ctx})
+	if !db.Migrator().HasTable(&SchemaMigration{}) {
+		if err := dryRun.Migrator().CreateTable(&SchemaMigration{}); err != nil {
+			return nil, terror.NewInternalf("dryRun.Migrator().CreateTable()", err)
+		}
+	}
+
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		recorder.comment(fmt.Sprintf("-- migration %d %s", migration.Version, migration.Name))
+		if err := migration.Up(ctx, dryRun); err != nil {
+			return nil, terror.Wrap(fmt.Sprintf("migration.Up() - migration %d %s", migration.Version, migration.Name), err)
+		}
+	}
+	return recorder.sql, nil
+}
+
+func (m *Migrator) Status(ctx context.Context, db *gorm.DB) ([]Status, error) {
+	applied := map[int64]SchemaMigration{}
+	if db.WithContext(ctx).Migrator().HasTable(&SchemaMigration{}) {
+		var err error
+		if applied, err = m.applied(db.WithContext(ctx)); err != nil {
+			return nil, terror.Wrap("m.applied()", err)
+		}
+	}
+
+	status := make([]Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		row, ok := applied[migration.Version]
+		status[i] = Status{Migration: migration, Applied: ok, AppliedAt: row.AppliedAt}
+	}
+	return status, nil
+}
+
+func (m *Migrator) validate() error {
+	for i, migration := range m.migrations {
+		if migration.Up == nil {
+			return terror.NewInternal(fmt.Sprintf("migration %d %s has no up step", migration.Version, migration.Name))
+		}
+		if i > 0 && m.migrations[i-1].Version == migration.Version {
+			return terror.NewInternal(fmt.Sprintf("migration version %d is used twice", migration.Version))
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *gorm.DB, migration Migration) error {
+	return conn.Transaction(func(tx *gorm.DB) error {
+		if err := migration.Up(ctx, tx); err != nil {
+			return terror.Wrap("migration.Up()", err)
+		}
+		row := SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}
+		if err := tx.Create(&row).Error; err != nil {
+			return terror.NewInternalf("tx.Create()", err)
+		}
+		tlogger.Success(fmt.Sprintf("Migration %d %s applied.", migration.Version, migration.Name))
+		return nil
+	})
+}
+
+func (m *Migrator) revert(ctx context.Context, conn *gorm.DB, migration Migration) error {
+	if migration.Down == nil {
+		return terror.NewInternal(fmt.Sprintf("migration %d %s has no down step", migration.Version, migration.Name))
+	}
+
+	return conn.Transaction(func(tx *gorm.DB) error {
+		if err := migration.Down(ctx, tx); err != nil {
+			return terror.Wrap("migration.Down()", err)
+		}
+		if err := tx.Delete(&SchemaMigration{}, migration.Version).Error; err != nil {
+			return terror.NewInternalf("tx.Delete()", err)
+		}
+		tlogger.Success(fmt.Sprintf("Migration %d %s reverted.", migration.Version, migration.Name))
+		return nil
+	})
+}
+
+func (m *Migrator) applied(conn *gorm.DB) (map[int64]SchemaMigration, error) {
+	var rows []SchemaMigration
+	if err := conn.Find(&rows).Error; err != nil {
+		return nil, terror.NewInternalf("conn.Find()", err)
+	}
+
+	applied := make(map[int64]SchemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// locked runs fn on a single connection holding the migration lock, so only one instance migrates at a time.
+func (m *Migrator) locked(ctx context.Context, db *gorm.DB, fn func(conn *gorm.DB) error) error {
+	return db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		// Every statement starts clean but keeps running on the pinned connection.
+		conn = conn.Session(&gorm.Session{NewDB: true})
+
+		if err := m.lock(conn); err != nil {
+			return terror.Wrap("m.lock()", err)
+		}
+		defer m.unlock(conn)
+
+		if err := conn.AutoMigrate(&SchemaMigration{}); err != nil {
+			return terror.NewInternalf("conn.AutoMigrate()", err)
+		}
+		return fn(conn)
+	})
+}
+
+func (m *Migrator) lock(conn *gorm.DB) error {
+	switch conn.Dialector.Name() {
+	case "mysql":
+		var locked int
+		if err := conn.Raw("SELECT GET_LOCK(?, ?)", lockName, int(m.LockTimeout.Seconds())).Scan(&locked).Error; err != nil {
+			return terror.NewInternalf("GET_LOCK", err)
+		}
+		if locked != 1 {
+			return terror.NewInternal("timeout waiting for the migration lock")
+		}
+	case "postgres":
+		ctx, cancel := context.WithTimeout(conn.Statement.Context, m.LockTimeout)
+		defer cancel()
+		if err := conn.WithContext(ctx).Exec("SELECT pg_advisory_lock(?)", lockKey()).Error; err != nil {
+			return terror.NewInternalf("pg_advisory_lock", err)
+		}
+	}
+	// SQLite allows a single writer and the schema_migrations primary key rejects a migration applied twice.
+	return nil
+}
+
+func (m *Migrator) unlock(conn *gorm.DB) {
+	var err error
+	switch conn.Dialector.Name() {
+	case "mysql":
+		err = conn.Exec("SELECT RELEASE_LOCK(?)", lockName).Error
+	case "postgres":
+		err = conn.Exec("SELECT pg_advisory_unlock(?)", lockKey()).Error
+	}
+	if err != nil {
+		tlogger.Error(fmt.Sprintf("Release migration lock terror: %s", err))
+	}
+}
+
+func lockKey() int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(lockName))
+	return int64(h.Sum64())
+}
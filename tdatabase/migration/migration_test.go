@@ -0,0 +1,234 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("gorm.Open() error = %v", err)
+	}
+	return db
+}
+
+func tables(t *testing.T, db *gorm.DB) []string {
+	t.Helper()
+	var names []string
+	if err := db.Raw("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name").Scan(&names).Error; err != nil {
+		t.Fatalf("list tables error = %v", err)
+	}
+	return names
+}
+
+func migrations() []Migration {
+	return []Migration{
+		NewSQL(2, "create_dates", "CREATE TABLE dates (id INTEGER PRIMARY KEY);", "DROP TABLE dates;"),
+		NewSQL(1, "create_tasks", "CREATE TABLE tasks (id INTEGER PRIMARY KEY);\nCREATE INDEX idx_tasks ON tasks (id);", "DROP TABLE tasks;"),
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(t)
+	m := New(migrations()...)
+
+	tests := []struct {
+		name        string
+		run         func() error
+		wantTables  []string
+		wantApplied []bool
+	}{
+		{name: "up applies in version order", run: func() error { return m.Up(ctx, db) }, wantTables: []string{"dates", "schema_migrations", "tasks"}, wantApplied: []bool{true, true}},
+		{name: "up again does nothing", run: func() error { return m.Up(ctx, db) }, wantTables: []string{"dates", "schema_migrations", "tasks"}, wantApplied: []bool{true, true}},
+		{name: "down reverts the last step", run: func() error { return m.Down(ctx, db, 1) }, wantTables: []string{"schema_migrations", "tasks"}, wantApplied: []bool{true, false}},
+		{name: "down more steps than applied", run: func() error { return m.Down(ctx, db, 5) }, wantTables: []string{"schema_migrations"}, wantApplied: []bool{false, false}},
+		{name: "up after down", run: func() error { return m.Up(ctx, db) }, wantTables: []string{"dates", "schema_migrations", "tasks"}, wantApplied: []bool{true, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.run(); err != nil {
+				t.Fatalf("run error = %v", err)
+			}
+			if got := tables(t, db); !reflect.DeepEqual(got, tt.wantTables) {
+				t.Errorf("tables = %v, want %v", got, tt.wantTables)
+			}
+			status, err := m.Status(ctx, db)
+			if err != nil {
+				t.Fatalf("Status() error = %v", err)
+			}
+			for i, s := range status {
+				if s.Version != int64(i+1) || s.Applied != tt.wantApplied[i] {
+					t.Errorf("Status()[%d] = %d applied %v, want %d applied %v", i, s.Version, s.Applied, i+1, tt.wantApplied[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMigrator_Errors(t *testing.T) {
+	ctx := context.Background()
+	failing := errors.New("failing")
+
+	tests := []struct {
+		name       string
+		migrations []Migration
+		run        func(m *Migrator, db *gorm.DB) error
+		wantErr    string
+		wantTables []string
+	}{
+		{
+			name: "failing migration is rolled back with the ones after it skipped",
+			migrations: append(migrations(), Migration{Version: 3, Name: "failing", Up: func(ctx context.Context, tx *gorm.DB) error {
+				if err := tx.Exec("CREATE TABLE half (id INTEGER)").Error; err != nil {
+					return err
+				}
+				return failing
+			}}, NewSQL(4, "after", "CREATE TABLE after (id INTEGER);", "")),
+			run:        func(m *Migrator, db *gorm.DB) error { return m.Up(ctx, db) },
+			wantErr:    "migration 3 failing",
+			wantTables: []string{"dates", "schema_migrations", "tasks"},
+		},
+		{
+			name:       "duplicated version",
+			migrations: append(migrations(), NewSQL(1, "again", "CREATE TABLE again (id INTEGER);", "")),
+			run:        func(m *Migrator, db *gorm.DB) error { return m.Up(ctx, db) },
+			wantErr:    "version 1 is used twice",
+		},
+		{
+			name:       "missing up step",
+			migrations: []Migration{{Version: 1, Name: "empty"}},
+			run:        func(m *Migrator, db *gorm.DB) error { return m.Up(ctx, db) },
+			wantErr:    "has no up step",
+		},
+		{
+			name:       "missing down step",
+			migrations: []Migration{NewSQL(1, "create_tasks", "CREATE TABLE tasks (id INTEGER);", "")},
+			run: func(m *Migrator, db *gorm.DB) error {
+				if err := m.Up(ctx, db); err != nil {
+					return err
+				}
+				return m.Down(ctx, db, 1)
+			},
+			wantErr:    "has no down step",
+			wantTables: []string{"schema_migrations", "tasks"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newDB(t)
+			err := tt.run(New(tt.migrations...), db)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %s", err, tt.wantErr)
+			}
+			if got := tables(t, db); !reflect.DeepEqual(got, tt.wantTables) {
+				t.Errorf("tables = %v, want %v", got, tt.wantTables)
+			}
+		})
+	}
+}
+
+func TestMigrator_Plan(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(t)
+	m := New(migrations()[1])
+	if err := m.Up(ctx, db); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	m.Add(migrations()[0])
+	m.DryRun = true
+
+	plan, err := m.Plan(ctx, db)
+	if err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+	want := []string{"-- migration 2 create_dates", "CREATE TABLE dates (id INTEGER PRIMARY KEY);"}
+	if !reflect.DeepEqual(plan, want) {
+		t.Errorf("Plan() = %q, want %q", plan, want)
+	}
+	if err := m.Run(ctx, db); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := tables(t, db); !reflect.DeepEqual(got, []string{"schema_migrations", "tasks"}) {
+		t.Errorf("tables after a dry run = %v", got)
+	}
+}
+
+func TestLoadSQL(t *testing.T) {
+	tests := []struct {
+		name         string
+		files        fstest.MapFS
+		wantVersions []int64
+		wantDown     []bool
+		wantErr      bool
+	}{
+		{
+			name: "pairs and single up files",
+			files: fstest.MapFS{
+				"sql/0002_create_dates.up.sql":   {Data: []byte("CREATE TABLE dates (id INTEGER);")},
+				"sql/0001_create_tasks.up.sql":   {Data: []byte("CREATE TABLE tasks (id INTEGER);")},
+				"sql/0001_create_tasks.down.sql": {Data: []byte("DROP TABLE tasks;")},
+				"sql/README.md":                  {Data: []byte("not a migration")},
+			},
+			wantVersions: []int64{1, 2},
+			wantDown:     []bool{true, false},
+		},
+		{
+			name:    "down without up",
+			files:   fstest.MapFS{"sql/0001_create_tasks.down.sql": {Data: []byte("DROP TABLE tasks;")}},
+			wantErr: true,
+		},
+		{
+			name:    "missing dir",
+			files:   fstest.MapFS{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := New()
+			err := m.LoadSQL(tt.files, "sql")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadSQL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(m.migrations) != len(tt.wantVersions) {
+				t.Fatalf("migrations = %d, want %d", len(m.migrations), len(tt.wantVersions))
+			}
+			for i, migration := range m.migrations {
+				if migration.Version != tt.wantVersions[i] || (migration.Down != nil) != tt.wantDown[i] {
+					t.Errorf("migration %d = %d with down %v, want %d with down %v", i, migration.Version, migration.Down != nil, tt.wantVersions[i], tt.wantDown[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{name: "empty", script: "\n-- only a comment\n", want: nil},
+		{name: "one per line", script: "CREATE TABLE a (id INTEGER);\nCREATE TABLE b (id INTEGER);", want: []string{"CREATE TABLE a (id INTEGER);", "CREATE TABLE b (id INTEGER);"}},
+		{name: "multi line statement", script: "CREATE TABLE a (\n  id INTEGER\n);\n-- comment\nDROP TABLE b", want: []string{"CREATE TABLE a (\n  id INTEGER\n);", "DROP TABLE b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitStatements(tt.script); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitStatements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
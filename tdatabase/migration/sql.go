@@ -0,0 +1,138 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/WojciechWiderski/tofu/terror"
+)
+
+// sqlFile matches migration files named like 0001_create_tasks.up.sql and 0001_create_tasks.down.sql.
+var sqlFile = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// NewSQL returns a migration executing the given SQL scripts, statements are separated by a semicolon at the end of a line.
+func NewSQL(version int64, name string, up string, down string) Migration {
+	migration := Migration{
+		Version: version,
+		Name:    name,
+		Up:      execSQL(up),
+	}
+	if strings.TrimSpace(down) != "" {
+		migration.Down = execSQL(down)
+	}
+	return migration
+}
+
+// LoadSQL adds a migration for every pair of up and down files in dir.
+func (m *Migrator) LoadSQL(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return terror.NewInternalf("fs.ReadDir()", err)
+	}
+
+	type scripts struct {
+		name     string
+		up, down string
+	}
+	found := map[int64]*scripts{}
+	for _, entry := range entries {
+		match := sqlFile.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return terror.NewInternalf("strconv.ParseInt()", err)
+		}
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return terror.NewInternalf("fs.ReadFile()", err)
+		}
+
+		s, ok := found[version]
+		if !ok {
+			s = &scripts{name: match[2]}
+			found[version] = s
+		}
+		if match[3] == "up" {
+			s.up = string(content)
+		} else {
+			s.down = string(content)
+		}
+	}
+
+	for version, s := range found {
+		if s.up == "" {
+			return terror.NewInternal(fmt.Sprintf("migration %d %s has no up file", version, s.name))
+		}
+		m.Add(NewSQL(version, s.name, s.up, s.down))
+	}
+	return nil
+}
+
+func execSQL(script string) func(ctx context.Context, tx *gorm.DB) error {
+	return func(ctx context.Context, tx *gorm.DB) error {
+		for _, statement := range splitStatements(script) {
+			if err := tx.WithContext(ctx).Exec(statement).Error; err != nil {
+				return terror.NewInternalf(fmt.Sprintf("tx.Exec() - %s", statement), err)
+			}
+		}
+		return nil
+	}
+}
+
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
+
+// recorder is a gorm logger collecting the SQL of a dry run session.
+type recorder struct {
+	sql []string
+}
+
+func (r *recorder) comment(line string) {
+	r.sql = append(r.sql, line)
+}
+
+func (r *recorder) LogMode(logger.LogLevel) logger.Interface {
+	return r
+}
+
+func (r *recorder) Info(context.Context, string, ...interface{}) {}
+
+func (r *recorder) Warn(context.Context, string, ...interface{}) {}
+
+func (r *recorder) Error(context.Context, string, ...interface{}) {}
+
+func (r *recorder) Trace(_ context.Context, _ time.Time, fc func() (sql string, rowsAffected int64), _ error) {
+	if sql, _ := fc(); sql != "" {
+		r.sql = append(r.sql, sql)
+	}
+}
@@ -2,15 +2,14 @@ package mysql
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"reflect"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 
 	"github.com/WojciechWiderski/tofu/tconfig"
 	"github.com/WojciechWiderski/tofu/tdatabase"
+	"github.com/WojciechWiderski/tofu/tdatabase/tgorm"
 	"github.com/WojciechWiderski/tofu/terror"
 	"github.com/WojciechWiderski/tofu/tlogger"
 	"github.com/WojciechWiderski/tofu/tmodel"
@@ -39,7 +38,7 @@ func New(conf tconfig.MySql, models *tmodel.Models) *DB {
 }
 
 func connectMySql(conf tconfig.MySql) (*gorm.DB, error) {
-	db, err := gorm.Open(mysql.Open(fmt.Sprintf(dsn, conf.Username, conf.Password, conf.Address, conf.DatabaseName)), &gorm.Config{})
+	db, err := gorm.Open(mysql.Open(fmt.Sprintf(dsn, conf.Username, conf.Password, conf.Address, conf.DatabaseName)), &gorm.Config{TranslateError: true})
 	if err != nil {
 		tlogger.Error(fmt.Sprintf("Connect to mysql terror: %s", err))
 		return nil, terror.NewInternalf("gorm.Open()", err)
@@ -48,6 +47,15 @@ func connectMySql(conf tconfig.MySql) (*gorm.DB, error) {
 	return db, nil
 }
 
+// Gorm exposes the connection for tools working below DBOperations, such as migrations.
+func (m *DB) Gorm() *gorm.DB {
+	return m.db
+}
+
+func (m *DB) Ping(ctx context.Context) error {
+	return tgorm.Ping(ctx, m.db)
+}
+
 func (m *DB) Migrate() error {
 	for _, model := range m.models.All {
 		if err := m.db.AutoMigrate(&model.In); err != nil {
@@ -60,77 +68,119 @@ func (m *DB) Migrate() error {
 }
 
 func (m *DB) Add(ctx context.Context, in interface{}) error {
-	tx := m.db.Begin()
+	tx := tgorm.Begin(ctx, m.db)
 
 	if result := tx.Create(in); result.Error != nil {
 		tx.Rollback()
-		return terror.NewInternalf("tx.Create()", fmt.Errorf(result.Error.Error()))
+		return tgorm.Error("tx.Create()", result.Error)
 	}
 	tx.Commit()
 	return nil
 }
 
+func (m *DB) AddMany(ctx context.Context, in []interface{}) ([]tdatabase.Result, error) {
+	tx := tgorm.Begin(ctx, m.db)
+
+	results, err := tgorm.AddMany(tx.DB, in)
+	if err != nil {
+		tx.Rollback()
+		return results, terror.Wrap("tgorm.AddMany()", err)
+	}
+	tx.Commit()
+	return results, nil
+}
+
 func (m *DB) GetOne(ctx context.Context, in interface{}, params tdatabase.ParamRequest) (interface{}, error) {
-	tx := m.db.Begin()
+	tx := tgorm.Begin(ctx, m.db)
 
-	if result := tx.First(&in, fmt.Sprintf("%s = ?", params.By), params.Value); result.Error != nil {
+	query, err := tgorm.Where(tx.Model(in), params)
+	if err != nil {
 		tx.Rollback()
-		if errors.Is(result.Error, fmt.Errorf("record not found")) {
-			return nil,
-		}
-		return nil, terror.NewInternalf("tx.First()", fmt.Errorf(result.Error.Error()))
+		return nil, terror.Wrap("tgorm.Where()", err)
+	}
+
+	query = tgorm.Preload(query, params)
+	if result := query.First(in); result.Error != nil {
+		tx.Rollback()
+		return nil, tgorm.Error("tx.First()", result.Error)
 	}
 	tx.Commit()
 	return in, nil
 }
 
 func (m *DB) GetMany(ctx context.Context, in interface{}, params tdatabase.ParamRequest) ([]interface{}, error) {
-	tx := m.db.Begin()
-	var result []any
-	rows, err := tx.Model(in).Rows()
+	tx := tgorm.Begin(ctx, m.db)
+	query, err := tgorm.Where(tx.Model(in), params)
 	if err != nil {
 		tx.Rollback()
-		return nil, terror.NewInternalf("tx.Model().Rows()", fmt.Errorf(err.Error()))
-	}
-	defer rows.Close()
-	for rows.Next() {
-		newIn := reflect.New(reflect.ValueOf(in).Elem().Type()).Interface()
-		err := tx.ScanRows(rows, &newIn)
-		if err != nil {
-			tx.Rollback()
-			return nil, terror.NewInternalf("tx.ScanRows()", fmt.Errorf(err.Error()))
-		}
-		result = append(result, newIn)
+		return nil, terror.Wrap("tgorm.Where()", err)
+	}
+	result, err := tgorm.FindPage(query, in, params)
+	if err != nil {
+		tx.Rollback()
+		return nil, terror.Wrap("tgorm.FindPage()", err)
 	}
 
 	tx.Commit()
 	return result, nil
 }
 
-func (m *DB) Update(ctx context.Context, update interface{}, in interface{}, id int) error {
-	tx := m.db.Begin()
-	in, err := m.GetOne(ctx, in, tdatabase.ParamRequest{
-		By:    "id",
-		Value: id,
-	})
+func (m *DB) Count(ctx context.Context, in interface{}, params tdatabase.ParamRequest) (int64, error) {
+	db := m.db.WithContext(ctx)
+	if tx := tgorm.TxFromCtx(ctx, m.db); tx != nil {
+		db = tx.WithContext(ctx)
+	}
+
+	query, err := tgorm.Where(db.Model(in), params)
 	if err != nil {
-		tx.Rollback()
-		return terror.Wrap("m.GetOne()", fmt.Errorf(err.Error()))
+		return 0, terror.Wrap("tgorm.Where()", err)
+	}
+
+	var total int64
+	if result := query.Count(&total); result.Error != nil {
+		return 0, tgorm.Error("db.Model().Count()", result.Error)
 	}
-	if result := tx.Model(in).Updates(update); result.Error != nil {
+	return total, nil
+}
+
+func (m *DB) Update(ctx context.Context, update interface{}, in interface{}, id interface{}) error {
+	tx := tgorm.Begin(ctx, m.db)
+	if err := tgorm.Update(tx.DB, update, in, id); err != nil {
 		tx.Rollback()
-		return terror.NewInternalf("tx.Model().Updates()", fmt.Errorf(result.Error.Error()))
+		return terror.Wrap("tgorm.Update()", err)
 	}
 	tx.Commit()
 	return nil
 }
 
-func (m *DB) Delete(ctx context.Context, in interface{}, id int) error {
-	tx := m.db.Begin()
-	if result := tx.Delete(in, id); result.Error != nil {
+// Delete removes the record id, or marks it deleted for a model with gorm.DeletedAt, a missing record is NotFound.
+func (m *DB) Delete(ctx context.Context, in interface{}, id interface{}) error {
+	tx := tgorm.Begin(ctx, m.db)
+	result := tx.Where(tgorm.ByID(id)).Delete(in)
+	if result.Error != nil {
+		tx.Rollback()
+		return tgorm.Error("tx.Delete()", result.Error)
+	}
+	if result.RowsAffected == 0 {
 		tx.Rollback()
-		return terror.NewInternalf("tx.Delete()", fmt.Errorf(result.Error.Error()))
+		return terror.NewNotFound(fmt.Sprintf("record with id %v not found", id))
 	}
 	tx.Commit()
 	return nil
 }
+
+func (m *DB) DeleteMany(ctx context.Context, in interface{}, params tdatabase.ParamRequest) ([]tdatabase.Result, error) {
+	tx := tgorm.Begin(ctx, m.db)
+
+	results, err := tgorm.DeleteMany(tx.DB, in, params)
+	if err != nil {
+		tx.Rollback()
+		return nil, terror.Wrap("tgorm.DeleteMany()", err)
+	}
+	tx.Commit()
+	return results, nil
+}
+
+func (m *DB) WithTx(ctx context.Context, fn func(ctx context.Context, tx tdatabase.DBOperations) error) error {
+	return tgorm.WithTx(ctx, m.db, m, fn)
+}
@@ -0,0 +1,221 @@
+package tdatabase
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm/schema"
+)
+
+// DefaultLimit and MaxLimit bound the page size of the get-many route, the backends read every record
+// for a zero limit.
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+var pageSchemas sync.Map
+
+type Sort struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc"`
+}
+
+// ParseSort reads a comma separated list of fields, a leading "-" sorts the field descending, e.g. "-created_at,name".
+func ParseSort(in string) []Sort {
+	var sort []Sort
+	for _, field := range strings.Split(in, ",") {
+		field = strings.TrimSpace(field)
+		desc := strings.HasPrefix(field, "-")
+		field = strings.TrimLeft(field, "-+")
+		if field == "" {
+			continue
+		}
+		sort = append(sort, Sort{Field: field, Desc: desc})
+	}
+	return sort
+}
+
+// cursor is the opaque position of a page: the keyset values of the record next to it, see Keyset. A Before
+// cursor reads the records before that record, any other cursor the records after it.
+type cursor struct {
+	Values []json.RawMessage `json:"v"`
+	Before bool              `json:"b,omitempty"`
+}
+
+// EncodeCursor returns the cursor of the records after, or with before of the records before, the record with
+// the keyset values.
+func EncodeCursor(values []interface{}, before bool) string {
+	c := cursor{Values: make([]json.RawMessage, len(values)), Before: before}
+	for i, value := range values {
+		c.Values[i], _ = json.Marshal(value)
+	}
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(in string) (cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(in)
+	if err != nil {
+		return cursor{}, fmt.Errorf("wrong cursor: %w", err)
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil || len(c.Values) == 0 {
+		return cursor{}, fmt.Errorf("wrong cursor: %s", in)
+	}
+	return c, nil
+}
+
+// Window returns the limit and offset to read, a cursor replaces the offset. A limit of 0 means no limit.
+func (p ParamRequest) Window() (int, int, error) {
+	limit := p.Limit
+	if limit < 0 {
+		limit = 0
+	}
+
+	if p.Cursor != "" {
+		if _, err := decodeCursor(p.Cursor); err != nil {
+			return 0, 0, err
+		}
+		return limit, 0, nil
+	}
+
+	offset := p.Offset
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset, nil
+}
+
+// Keyset is the order of a page and the position of its cursor. Fields are the sort fields with the primary
+// key added last, so every record has its own position and a cursor page never skips or repeats a record
+// when others are added or removed in between, unlike an offset. A record with a NULL sort value has no
+// position and is skipped by a cursor.
+type Keyset struct {
+	Fields []*schema.Field
+	Desc   []bool
+	// Values are the values of Fields of the cursor record, nil without a cursor.
+	Values []interface{}
+	// Before reads the records before the cursor record instead of the ones after it.
+	Before bool
+}
+
+// Keyset returns the keyset of params for records of s, a wrong sort field or a cursor of another sort is
+// an error.
+func (p ParamRequest) Keyset(s *schema.Schema) (*Keyset, error) {
+	keyset := &Keyset{}
+	for _, sort := range p.Sort {
+		field := s.LookUpField(sort.Field)
+		if field == nil || field.DBName == "" {
+			return nil, fmt.Errorf("wrong sort field %s", sort.Field)
+		}
+		keyset.Fields = append(keyset.Fields, field)
+		keyset.Desc = append(keyset.Desc, sort.Desc)
+	}
+	if pk := s.PrioritizedPrimaryField; pk != nil && !slices.Contains(keyset.Fields, pk) {
+		keyset.Fields = append(keyset.Fields, pk)
+		keyset.Desc = append(keyset.Desc, false)
+	}
+
+	if p.Cursor == "" {
+		return keyset, nil
+	}
+	c, err := decodeCursor(p.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.Values) != len(keyset.Fields) {
+		return nil, fmt.Errorf("wrong cursor for the sort of the request: %s", p.Cursor)
+	}
+	keyset.Values = make([]interface{}, len(c.Values))
+	for i, field := range keyset.Fields {
+		value := reflect.New(field.IndirectFieldType)
+		if err := json.Unmarshal(c.Values[i], value.Interface()); err != nil {
+			return nil, fmt.Errorf("wrong cursor value of %s: %w", field.Name, err)
+		}
+		keyset.Values[i] = value.Elem().Interface()
+	}
+	keyset.Before = c.Before
+	return keyset, nil
+}
+
+// Greater reports whether the records read have a greater value of field i than the cursor record, which
+// is the case for an ascending field after the cursor and a descending one before it.
+func (k *Keyset) Greater(i int) bool {
+	return k.Desc[i] == k.Before
+}
+
+// Cursor returns the cursor of the records after item, or with before of the records before it.
+func (k *Keyset) Cursor(item interface{}, before bool) string {
+	value := reflect.Indirect(reflect.ValueOf(item))
+	values := make([]interface{}, len(k.Fields))
+	for i, field := range k.Fields {
+		values[i], _ = field.ValueOf(context.Background(), value)
+	}
+	return EncodeCursor(values, before)
+}
+
+type Page struct {
+	Items      []interface{} `json:"items"`
+	Total      int64         `json:"total"`
+	Limit      int           `json:"limit"`
+	Offset     int           `json:"offset"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+	PrevCursor string        `json:"prev_cursor,omitempty"`
+}
+
+// NewPage wraps a page of items, read with params, with the cursors of the pages next to it. Without a cursor
+// the page position is known from the offset and total, after a cursor a full page is taken to have a next
+// one, so the last page may be empty.
+func NewPage(items []interface{}, total int64, params ParamRequest) (*Page, error) {
+	limit, offset, err := params.Window()
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []interface{}{}
+	}
+
+	page := &Page{
+		Items:  items,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	}
+	if len(items) == 0 {
+		return page, nil
+	}
+
+	s, err := schema.Parse(items[0], &pageSchemas, schema.NamingStrategy{})
+	if err != nil {
+		return nil, fmt.Errorf("schema.Parse(): %w", err)
+	}
+	keyset, err := params.Keyset(s)
+	if err != nil {
+		return nil, err
+	}
+
+	full := limit > 0 && len(items) == limit
+	var next, prev bool
+	switch {
+	case params.Cursor == "":
+		next, prev = limit > 0 && int64(offset+len(items)) < total, offset > 0
+	case keyset.Before:
+		next, prev = true, full
+	default:
+		next, prev = full, true
+	}
+	if next {
+		page.NextCursor = keyset.Cursor(items[len(items)-1], false)
+	}
+	if prev {
+		page.PrevCursor = keyset.Cursor(items[0], true)
+	}
+	return page, nil
+}
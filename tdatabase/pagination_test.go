@@ -0,0 +1,166 @@
+package tdatabase
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm/schema"
+)
+
+func TestParseSort(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []Sort
+	}{
+		{in: "", want: nil},
+		{in: "name", want: []Sort{{Field: "name"}}},
+		{in: "-created_at, +name,", want: []Sort{{Field: "created_at", Desc: true}, {Field: "name"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := ParseSort(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSort() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParamRequest_Window(t *testing.T) {
+	tests := []struct {
+		name       string
+		params     ParamRequest
+		wantLimit  int
+		wantOffset int
+		wantErr    bool
+	}{
+		{name: "no limit", params: ParamRequest{}, wantLimit: 0},
+		{name: "limit above the page maximum", params: ParamRequest{Limit: MaxLimit + 500}, wantLimit: MaxLimit + 500},
+		{name: "negative limit and offset", params: ParamRequest{Limit: -1, Offset: -5}, wantLimit: 0},
+		{name: "offset", params: ParamRequest{Limit: 10, Offset: 20}, wantLimit: 10, wantOffset: 20},
+		{name: "cursor replaces offset", params: ParamRequest{Limit: 10, Offset: 20, Cursor: EncodeCursor([]interface{}{30}, false)}, wantLimit: 10, wantOffset: 0},
+		{name: "wrong cursor", params: ParamRequest{Cursor: "nope"}, wantErr: true},
+		{name: "cursor without values", params: ParamRequest{Cursor: EncodeCursor(nil, false)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit, offset, err := tt.params.Window()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Window() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if limit != tt.wantLimit || offset != tt.wantOffset {
+				t.Errorf("Window() = %d, %d, want %d, %d", limit, offset, tt.wantLimit, tt.wantOffset)
+			}
+		})
+	}
+}
+
+type row struct {
+	ID        uint
+	Name      string
+	CreatedAt time.Time
+}
+
+func rowSchema(t *testing.T) *schema.Schema {
+	t.Helper()
+	s, err := schema.Parse(&row{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatalf("schema.Parse() error = %v", err)
+	}
+	return s
+}
+
+func TestParamRequest_Keyset(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		params     ParamRequest
+		wantFields string
+		wantDesc   []bool
+		wantValues []interface{}
+		wantBefore bool
+		wantErr    bool
+	}{
+		{name: "primary key without sort", params: ParamRequest{}, wantFields: "ID", wantDesc: []bool{false}},
+		{name: "primary key last", params: ParamRequest{Sort: ParseSort("-created_at,name")}, wantFields: "CreatedAt,Name,ID", wantDesc: []bool{true, false, false}},
+		{name: "primary key sorted once", params: ParamRequest{Sort: ParseSort("-id")}, wantFields: "ID", wantDesc: []bool{true}},
+		{name: "wrong sort field", params: ParamRequest{Sort: ParseSort("nope")}, wantErr: true},
+		{
+			name:       "cursor values typed by field",
+			params:     ParamRequest{Sort: ParseSort("created_at,name"), Cursor: EncodeCursor([]interface{}{created, "b", uint(7)}, true)},
+			wantFields: "CreatedAt,Name,ID",
+			wantDesc:   []bool{false, false, false},
+			wantValues: []interface{}{created, "b", uint(7)},
+			wantBefore: true,
+		},
+		{name: "cursor of another sort", params: ParamRequest{Sort: ParseSort("name"), Cursor: EncodeCursor([]interface{}{uint(7)}, false)}, wantErr: true},
+		{name: "cursor with a wrong value", params: ParamRequest{Cursor: EncodeCursor([]interface{}{"x"}, false)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyset, err := tt.params.Keyset(rowSchema(t))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Keyset() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var fields []string
+			for _, field := range keyset.Fields {
+				fields = append(fields, field.Name)
+			}
+			if got := strings.Join(fields, ","); got != tt.wantFields || !reflect.DeepEqual(keyset.Desc, tt.wantDesc) {
+				t.Errorf("Keyset() fields = %s %v, want %s %v", got, keyset.Desc, tt.wantFields, tt.wantDesc)
+			}
+			if !reflect.DeepEqual(keyset.Values, tt.wantValues) || keyset.Before != tt.wantBefore {
+				t.Errorf("Keyset() values = %v before %v, want %v before %v", keyset.Values, keyset.Before, tt.wantValues, tt.wantBefore)
+			}
+		})
+	}
+}
+
+func TestNewPage(t *testing.T) {
+	rows := func(ids ...uint) []interface{} {
+		items := make([]interface{}, len(ids))
+		for i, id := range ids {
+			items[i] = &row{ID: id, Name: string(rune('a' + id))}
+		}
+		return items
+	}
+	after := func(values ...interface{}) string { return EncodeCursor(values, false) }
+	before := func(values ...interface{}) string { return EncodeCursor(values, true) }
+
+	tests := []struct {
+		name     string
+		items    []interface{}
+		total    int64
+		params   ParamRequest
+		wantNext string
+		wantPrev string
+	}{
+		{name: "first page", items: rows(1, 2), total: 5, params: ParamRequest{Limit: 2}, wantNext: after(uint(2))},
+		{name: "middle page", items: rows(3, 4), total: 5, params: ParamRequest{Limit: 2, Offset: 2}, wantNext: after(uint(4)), wantPrev: before(uint(3))},
+		{name: "last page", items: rows(5), total: 5, params: ParamRequest{Limit: 2, Offset: 4}, wantPrev: before(uint(5))},
+		{name: "no limit", items: rows(1, 2, 3), total: 3, params: ParamRequest{}},
+		{name: "empty", items: nil, total: 5, params: ParamRequest{Limit: 2, Offset: 9}},
+		{name: "sorted", items: rows(4, 2), total: 5, params: ParamRequest{Limit: 2, Sort: ParseSort("-name")}, wantNext: after("c", uint(2))},
+		{name: "after a cursor", items: rows(3, 4), total: 5, params: ParamRequest{Limit: 2, Cursor: after(uint(2))}, wantNext: after(uint(4)), wantPrev: before(uint(3))},
+		{name: "after a cursor, last page", items: rows(5), total: 5, params: ParamRequest{Limit: 2, Cursor: after(uint(4))}, wantPrev: before(uint(5))},
+		{name: "before a cursor", items: rows(2, 3), total: 5, params: ParamRequest{Limit: 2, Cursor: before(uint(4))}, wantNext: after(uint(3)), wantPrev: before(uint(2))},
+		{name: "before a cursor, first page", items: rows(1), total: 5, params: ParamRequest{Limit: 2, Cursor: before(uint(2))}, wantNext: after(uint(1))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := NewPage(tt.items, tt.total, tt.params)
+			if err != nil {
+				t.Fatalf("NewPage() error = %v", err)
+			}
+			if page.NextCursor != tt.wantNext || page.PrevCursor != tt.wantPrev {
+				t.Errorf("NewPage() cursors = %q, %q, want %q, %q", page.NextCursor, page.PrevCursor, tt.wantNext, tt.wantPrev)
+			}
+		})
+	}
+}
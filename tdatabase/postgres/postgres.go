@@ -0,0 +1,267 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"github.com/WojciechWiderski/tofu/tconfig"
+	"github.com/WojciechWiderski/tofu/tdatabase"
+	"github.com/WojciechWiderski/tofu/tdatabase/tgorm"
+	"github.com/WojciechWiderski/tofu/terror"
+	"github.com/WojciechWiderski/tofu/tlogger"
+	"github.com/WojciechWiderski/tofu/tmodel"
+)
+
+type DB struct {
+	db     *gorm.DB
+	models *tmodel.Models
+	schema string
+}
+
+func New(conf tconfig.Postgres, models *tmodel.Models) *DB {
+
+	db, err := connectPostgres(conf)
+	if err != nil {
+		panic(err)
+	}
+
+	tlogger.Success("Postgres connected!")
+
+	return &DB{
+		db,
+		models,
+		conf.Schema,
+	}
+}
+
+func connectPostgres(conf tconfig.Postgres) (*gorm.DB, error) {
+	if conf.Port == 0 {
+		conf.Port = 5432
+	}
+	if conf.SSLMode == "" {
+		conf.SSLMode = "disable"
+	}
+
+	gormConfig := &gorm.Config{TranslateError: true}
+	if conf.Schema != "" {
+		gormConfig.NamingStrategy = schema.NamingStrategy{TablePrefix: conf.Schema + "."}
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn(conf)), gormConfig)
+	if err != nil {
+		tlogger.Error(fmt.Sprintf("Connect to postgres terror: %s", err))
+		return nil, terror.NewInternalf("gorm.Open()", err)
+	}
+	tlogger.Info("Connect to postgres...")
+	return db, nil
+}
+
+// dsn builds a postgres:// URL of conf, so the credentials may hold any character.
+func dsn(conf tconfig.Postgres) string {
+	query := url.Values{"sslmode": {conf.SSLMode}}
+	if len(conf.SearchPath) > 0 {
+		query.Set("search_path", strings.Join(conf.SearchPath, ","))
+	}
+
+	connection := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(conf.Username, conf.Password),
+		Host:     net.JoinHostPort(conf.Host, strconv.Itoa(conf.Port)),
+		Path:     "/" + conf.DatabaseName,
+		RawQuery: query.Encode(),
+	}
+	return connection.String()
+}
+
+// Gorm exposes the connection for tools working below DBOperations, such as migrations.
+func (m *DB) Gorm() *gorm.DB {
+	return m.db
+}
+
+func (m *DB) Ping(ctx context.Context) error {
+	return tgorm.Ping(ctx, m.db)
+}
+
+func (m *DB) Migrate() error {
+	if m.schema != "" {
+		if err := m.db.Exec("CREATE SCHEMA IF NOT EXISTS ?", clause.Table{Name: m.schema}).Error; err != nil {
+			tlogger.Error(fmt.Sprintf("Create schema terror for: %s, terror: %s", m.schema, err))
+			return terror.NewInternalf(fmt.Sprintf("db.Exec() - create schema: %s", m.schema), err)
+		}
+	}
+
+	for _, model := range m.models.All {
+		if err := m.db.AutoMigrate(model.In); err != nil {
+			tlogger.Error(fmt.Sprintf("Migrate terror for: %s, terror: %s", model.Name, err))
+			return terror.NewInternalf(fmt.Sprintf("db.AutoMigrate() - model: %s", model.Name), err)
+		}
+		tlogger.Success(fmt.Sprintf("Migrate success for: %s", model.Name))
+	}
+	return nil
+}
+
+// Add inserts in and reads the generated columns, such as serial ids, back with RETURNING.
+func (m *DB) Add(ctx context.Context, in interface{}) error {
+	if err := m.setUUIDPrimaryKey(in); err != nil {
+		return terror.Wrap("m.setUUIDPrimaryKey()", err)
+	}
+
+	tx := tgorm.Begin(ctx, m.db)
+
+	if result := tx.Clauses(clause.Returning{}).Create(in); result.Error != nil {
+		tx.Rollback()
+		return tgorm.Error("tx.Create()", result.Error)
+	}
+	tx.Commit()
+	return nil
+}
+
+func (m *DB) AddMany(ctx context.Context, in []interface{}) ([]tdatabase.Result, error) {
+	for i, item := range in {
+		if err := m.setUUIDPrimaryKey(item); err != nil {
+			return nil, terror.Wrap(fmt.Sprintf("m.setUUIDPrimaryKey() - item %d", i), err)
+		}
+	}
+
+	tx := tgorm.Begin(ctx, m.db)
+
+	results, err := tgorm.AddMany(tx.Clauses(clause.Returning{}), in)
+	if err != nil {
+		tx.Rollback()
+		return results, terror.Wrap("tgorm.AddMany()", err)
+	}
+	tx.Commit()
+	return results, nil
+}
+
+func (m *DB) GetOne(ctx context.Context, in interface{}, params tdatabase.ParamRequest) (interface{}, error) {
+	tx := tgorm.Begin(ctx, m.db)
+
+	query, err := tgorm.Where(tx.Model(in), params)
+	if err != nil {
+		tx.Rollback()
+		return nil, terror.Wrap("tgorm.Where()", err)
+	}
+
+	query = tgorm.Preload(query, params)
+	if result := query.First(in); result.Error != nil {
+		tx.Rollback()
+		return nil, tgorm.Error("tx.First()", result.Error)
+	}
+	tx.Commit()
+	return in, nil
+}
+
+func (m *DB) GetMany(ctx context.Context, in interface{}, params tdatabase.ParamRequest) ([]interface{}, error) {
+	tx := tgorm.Begin(ctx, m.db)
+	query, err := tgorm.Where(tx.Model(in), params)
+	if err != nil {
+		tx.Rollback()
+		return nil, terror.Wrap("tgorm.Where()", err)
+	}
+	result, err := tgorm.FindPage(query, in, params)
+	if err != nil {
+		tx.Rollback()
+		return nil, terror.Wrap("tgorm.FindPage()", err)
+	}
+
+	tx.Commit()
+	return result, nil
+}
+
+func (m *DB) Count(ctx context.Context, in interface{}, params tdatabase.ParamRequest) (int64, error) {
+	db := m.db.WithContext(ctx)
+	if tx := tgorm.TxFromCtx(ctx, m.db); tx != nil {
+		db = tx.WithContext(ctx)
+	}
+
+	query, err := tgorm.Where(db.Model(in), params)
+	if err != nil {
+		return 0, terror.Wrap("tgorm.Where()", err)
+	}
+
+	var total int64
+	if result := query.Count(&total); result.Error != nil {
+		return 0, tgorm.Error("db.Model().Count()", result.Error)
+	}
+	return total, nil
+}
+
+func (m *DB) Update(ctx context.Context, update interface{}, in interface{}, id interface{}) error {
+	tx := tgorm.Begin(ctx, m.db)
+	if err := tgorm.Update(tx.DB, update, in, id); err != nil {
+		tx.Rollback()
+		return terror.Wrap("tgorm.Update()", err)
+	}
+	tx.Commit()
+	return nil
+}
+
+// Delete removes the record id, or marks it deleted for a model with gorm.DeletedAt, a missing record is NotFound.
+func (m *DB) Delete(ctx context.Context, in interface{}, id interface{}) error {
+	tx := tgorm.Begin(ctx, m.db)
+	result := tx.Where(tgorm.ByID(id)).Delete(in)
+	if result.Error != nil {
+		tx.Rollback()
+		return tgorm.Error("tx.Delete()", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return terror.NewNotFound(fmt.Sprintf("record with id %v not found", id))
+	}
+	tx.Commit()
+	return nil
+}
+
+// setUUIDPrimaryKey fills an empty uuid.UUID or string primary key, serial keys are left to the database.
+func (m *DB) setUUIDPrimaryKey(in interface{}) error {
+	stmt := &gorm.Statement{DB: m.db}
+	if err := stmt.Parse(in); err != nil {
+		return terror.NewInternalf("stmt.Parse()", err)
+	}
+
+	field := stmt.Schema.PrioritizedPrimaryField
+	if field == nil {
+		return nil
+	}
+
+	value := reflect.Indirect(reflect.ValueOf(in))
+	if _, isZero := field.ValueOf(context.Background(), value); !isZero {
+		return nil
+	}
+
+	switch field.FieldType {
+	case reflect.TypeOf(uuid.UUID{}):
+		return field.Set(context.Background(), value, uuid.New())
+	case reflect.TypeOf(""):
+		return field.Set(context.Background(), value, uuid.New().String())
+	}
+	return nil
+}
+
+func (m *DB) DeleteMany(ctx context.Context, in interface{}, params tdatabase.ParamRequest) ([]tdatabase.Result, error) {
+	tx := tgorm.Begin(ctx, m.db)
+
+	results, err := tgorm.DeleteMany(tx.DB, in, params)
+	if err != nil {
+		tx.Rollback()
+		return nil, terror.Wrap("tgorm.DeleteMany()", err)
+	}
+	tx.Commit()
+	return results, nil
+}
+
+func (m *DB) WithTx(ctx context.Context, fn func(ctx context.Context, tx tdatabase.DBOperations) error) error {
+	return tgorm.WithTx(ctx, m.db, m, fn)
+}
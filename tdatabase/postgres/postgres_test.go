@@ -0,0 +1,322 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/WojciechWiderski/tofu/tconfig"
+	"github.com/WojciechWiderski/tofu/tdatabase"
+	"github.com/WojciechWiderski/tofu/terror"
+	"github.com/WojciechWiderski/tofu/tmodel"
+)
+
+func TestDsn(t *testing.T) {
+	tests := []struct {
+		name string
+		conf tconfig.Postgres
+	}{
+		{name: "plain", conf: tconfig.Postgres{Host: "localhost", Port: 5432, Username: "tofu", Password: "secret", DatabaseName: "tofu", SSLMode: "disable"}},
+		{name: "password with spaces and quotes", conf: tconfig.Postgres{Host: "db", Port: 6432, Username: "to fu", Password: `p a's"s@/:?#%`, DatabaseName: "app", SSLMode: "disable"}},
+		{name: "search path", conf: tconfig.Postgres{Host: "db", Port: 5432, Username: "tofu", DatabaseName: "app", SSLMode: "require", SearchPath: []string{"app", "public"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := pgconn.ParseConfig(dsn(tt.conf))
+			if err != nil {
+				t.Fatalf("pgconn.ParseConfig() error = %v", err)
+			}
+			if config.Host != tt.conf.Host || int(config.Port) != tt.conf.Port {
+				t.Errorf("host = %s:%d, want %s:%d", config.Host, config.Port, tt.conf.Host, tt.conf.Port)
+			}
+			if config.User != tt.conf.Username || config.Password != tt.conf.Password {
+				t.Errorf("credentials = %q/%q, want %q/%q", config.User, config.Password, tt.conf.Username, tt.conf.Password)
+			}
+			if config.Database != tt.conf.DatabaseName {
+				t.Errorf("database = %s, want %s", config.Database, tt.conf.DatabaseName)
+			}
+			if len(tt.conf.SearchPath) > 0 && config.RuntimeParams["search_path"] != "app,public" {
+				t.Errorf("search_path = %s, want app,public", config.RuntimeParams["search_path"])
+			}
+		})
+	}
+}
+
+type item struct {
+	ID   uint
+	Name string `gorm:"uniqueIndex"`
+}
+
+// TestDB runs against the postgres configured by TOFU_TEST_POSTGRES_HOST, TOFU_TEST_POSTGRES_USERNAME,
+// TOFU_TEST_POSTGRES_PASSWORD and TOFU_TEST_POSTGRES_DATABASE_NAME, e.g. one started by docker compose.
+func TestDB(t *testing.T) {
+	if os.Getenv("TOFU_TEST_POSTGRES_HOST") == "" {
+		t.Skip("TOFU_TEST_POSTGRES_HOST not set")
+	}
+	var conf struct{ Postgres tconfig.Postgres }
+	if err := tconfig.Load(&conf, tconfig.WithEnv("TOFU_TEST")); err != nil {
+		t.Fatalf("tconfig.Load() error = %v", err)
+	}
+	conf.Postgres.Schema = "tofu test"
+
+	ctx := context.Background()
+	db := New(conf.Postgres, tmodel.NewModels(tmodel.NewModel(&item{}, "item")))
+	t.Cleanup(func() {
+		db.Gorm().Exec("DROP SCHEMA IF EXISTS ? CASCADE", clause.Table{Name: conf.Postgres.Schema})
+	})
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		run  func() error
+		kind terror.Kind
+	}{
+		{name: "add", run: func() error { return db.Add(ctx, &item{Name: "a"}) }},
+		{name: "add duplicated", run: func() error { return db.Add(ctx, &item{Name: "a"}) }, kind: terror.Conflict},
+		{name: "get one", run: func() error {
+			_, err := db.GetOne(ctx, &item{}, tdatabase.ParamRequest{By: "name", Value: "a"})
+			return err
+		}},
+		{name: "update", run: func() error { return db.Update(ctx, &item{Name: "b"}, &item{}, 1) }},
+		{name: "update missing", run: func() error { return db.Update(ctx, &item{Name: "c"}, &item{}, 99) }, kind: terror.NotFound},
+		{name: "delete", run: func() error { return db.Delete(ctx, &item{}, 1) }},
+		{name: "delete again", run: func() error { return db.Delete(ctx, &item{}, 1) }, kind: terror.NotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.run()
+			if tt.kind == (terror.Kind{}) && err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if tt.kind != (terror.Kind{}) && !errors.Is(err, tt.kind) {
+				t.Errorf("error = %v, want %s", err, tt.kind)
+			}
+		})
+	}
+}
+
+// recorder is a database/sql connector which records every statement and answers every query with its
+// row, so the SQL built for postgres is checked without a server.
+type recorder struct {
+	mu         sync.Mutex
+	statements []statement
+	columns    []string
+	row        []driver.Value
+}
+
+type statement struct {
+	query string
+	args  []interface{}
+}
+
+func (r *recorder) Connect(ctx context.Context) (driver.Conn, error) { return r, nil }
+func (r *recorder) Driver() driver.Driver                            { return nil }
+func (r *recorder) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepare not supported")
+}
+func (r *recorder) Close() error              { return nil }
+func (r *recorder) Begin() (driver.Tx, error) { return r, nil }
+func (r *recorder) Commit() error             { return nil }
+func (r *recorder) Rollback() error           { return nil }
+
+func (r *recorder) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	r.record(query, args)
+	return driver.RowsAffected(1), nil
+}
+
+func (r *recorder) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	r.record(query, args)
+	return &rows{columns: r.columns, row: r.row}, nil
+}
+
+func (r *recorder) record(query string, args []driver.NamedValue) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	r.statements = append(r.statements, statement{query: query, args: values})
+}
+
+// find returns the first recorded statement starting with prefix.
+func (r *recorder) find(t *testing.T, prefix string) statement {
+	t.Helper()
+	for _, s := range r.statements {
+		if strings.HasPrefix(s.query, prefix) {
+			return s
+		}
+	}
+	t.Fatalf("no %s statement in %+v", prefix, r.statements)
+	return statement{}
+}
+
+type rows struct {
+	columns []string
+	row     []driver.Value
+	done    bool
+}
+
+func (r *rows) Columns() []string { return r.columns }
+func (r *rows) Close() error      { return nil }
+func (r *rows) Next(dest []driver.Value) error {
+	if r.done || r.row == nil {
+		return io.EOF
+	}
+	r.done = true
+	copy(dest, r.row)
+	return nil
+}
+
+// newRecordedDB returns a DB on a recorder which answers every query with row.
+func newRecordedDB(t *testing.T, columns []string, row []driver.Value) (*DB, *recorder) {
+	t.Helper()
+	rec := &recorder{columns: columns, row: row}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sql.OpenDB(rec)}), &gorm.Config{TranslateError: true})
+	if err != nil {
+		t.Fatalf("gorm.Open() error = %v", err)
+	}
+	return &DB{db: db}, rec
+}
+
+type uuidItem struct {
+	ID   uuid.UUID
+	Name string
+}
+
+type codeItem struct {
+	Code string `gorm:"primaryKey"`
+	Name string
+}
+
+func TestDB_SQL(t *testing.T) {
+	ctx := context.Background()
+	id := uuid.New()
+
+	tests := []struct {
+		name    string
+		columns []string
+		row     []driver.Value
+		run     func(db *DB) (interface{}, error)
+		check   func(t *testing.T, rec *recorder, out interface{})
+	}{
+		{
+			name:    "add reads a serial id back",
+			columns: []string{"id"},
+			row:     []driver.Value{int64(7)},
+			run: func(db *DB) (interface{}, error) {
+				in := &item{Name: "a"}
+				return in, db.Add(ctx, in)
+			},
+			check: func(t *testing.T, rec *recorder, out interface{}) {
+				if insert := rec.find(t, "INSERT"); !strings.Contains(insert.query, "RETURNING") {
+					t.Errorf("insert = %s, want RETURNING", insert.query)
+				}
+				if got := out.(*item).ID; got != 7 {
+					t.Errorf("ID = %d, want 7", got)
+				}
+			},
+		},
+		{
+			name: "add fills a uuid key",
+			run: func(db *DB) (interface{}, error) {
+				in := &uuidItem{Name: "a"}
+				return in, db.Add(ctx, in)
+			},
+			check: func(t *testing.T, rec *recorder, out interface{}) {
+				got := out.(*uuidItem).ID
+				if got == uuid.Nil {
+					t.Fatalf("ID not set")
+				}
+				if insert := rec.find(t, "INSERT"); insert.args[0] != got.String() {
+					t.Errorf("insert args = %v, want %s first", insert.args, got)
+				}
+			},
+		},
+		{
+			name: "add many fills string keys",
+			run: func(db *DB) (interface{}, error) {
+				in := []interface{}{&codeItem{Name: "a"}, &codeItem{Name: "b"}}
+				_, err := db.AddMany(ctx, in)
+				return in, err
+			},
+			check: func(t *testing.T, rec *recorder, out interface{}) {
+				items := out.([]interface{})
+				a, b := items[0].(*codeItem).Code, items[1].(*codeItem).Code
+				if _, err := uuid.Parse(a); err != nil || a == b {
+					t.Errorf("codes = %q, %q, want two uuids", a, b)
+				}
+			},
+		},
+		{
+			name:    "update by uuid",
+			columns: []string{"id", "name"},
+			row:     []driver.Value{id.String(), "a"},
+			run: func(db *DB) (interface{}, error) {
+				out := &uuidItem{}
+				return out, db.Update(ctx, &uuidItem{ID: uuid.New(), Name: "b"}, out, id.String())
+			},
+			check: func(t *testing.T, rec *recorder, out interface{}) {
+				if query := rec.find(t, "SELECT"); !strings.Contains(query.query, `WHERE "uuid_items"."id" = $1`) || query.args[0] != id.String() {
+					t.Errorf("select = %s %v, want the uuid as a parameter", query.query, query.args)
+				}
+				update := rec.find(t, "UPDATE")
+				if !strings.HasPrefix(update.query, `UPDATE "uuid_items" SET "name"=$1 WHERE`) {
+					t.Errorf("update = %s, want only the name set", update.query)
+				}
+				if got := update.args[len(update.args)-1]; got != id.String() {
+					t.Errorf("update args = %v, want %s last", update.args, id)
+				}
+			},
+		},
+		{
+			name: "get many after a cursor",
+			run: func(db *DB) (interface{}, error) {
+				params := tdatabase.ParamRequest{Limit: 2, Sort: tdatabase.ParseSort("-name"), Cursor: tdatabase.EncodeCursor([]interface{}{"b", 4}, false)}
+				return db.GetMany(ctx, &item{}, params)
+			},
+			check: func(t *testing.T, rec *recorder, out interface{}) {
+				query := rec.find(t, "SELECT")
+				want := `WHERE ("items"."name" < $1 OR ("items"."name" = $2 AND "items"."id" > $3)) ORDER BY "items"."name" DESC,"items"."id" LIMIT 2`
+				if !strings.Contains(query.query, want) {
+					t.Errorf("select = %s, want %s", query.query, want)
+				}
+			},
+		},
+		{
+			name: "delete by uuid",
+			run: func(db *DB) (interface{}, error) {
+				return nil, db.Delete(ctx, &uuidItem{}, id.String())
+			},
+			check: func(t *testing.T, rec *recorder, out interface{}) {
+				if query := rec.find(t, "DELETE"); !strings.Contains(query.query, `WHERE "uuid_items"."id" = $1`) || query.args[0] != id.String() {
+					t.Errorf("delete = %s %v, want the uuid as a parameter", query.query, query.args)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, rec := newRecordedDB(t, tt.columns, tt.row)
+			out, err := tt.run(db)
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			tt.check(t, rec, out)
+		})
+	}
+}
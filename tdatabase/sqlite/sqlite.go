@@ -0,0 +1,206 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/WojciechWiderski/tofu/tconfig"
+	"github.com/WojciechWiderski/tofu/tdatabase"
+	"github.com/WojciechWiderski/tofu/tdatabase/tgorm"
+	"github.com/WojciechWiderski/tofu/terror"
+	"github.com/WojciechWiderski/tofu/tlogger"
+	"github.com/WojciechWiderski/tofu/tmodel"
+)
+
+type DB struct {
+	db     *gorm.DB
+	models *tmodel.Models
+}
+
+// inMemoryCount names the in-memory databases, each DB gets its own one shared by the connections of its
+// pool only.
+var inMemoryCount atomic.Uint64
+
+func inMemoryDsn() string {
+	return fmt.Sprintf("file:tofu_%d?mode=memory&cache=shared", inMemoryCount.Add(1))
+}
+
+func New(conf tconfig.SQLite, models *tmodel.Models) *DB {
+
+	db, err := connectSQLite(conf)
+	if err != nil {
+		panic(err)
+	}
+
+	tlogger.Success("SQLite connected!")
+
+	return &DB{
+		db,
+		models,
+	}
+}
+
+func connectSQLite(conf tconfig.SQLite) (*gorm.DB, error) {
+	dsn := conf.Path
+	if dsn == "" || conf.InMemory {
+		dsn = inMemoryDsn()
+	}
+
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{TranslateError: true})
+	if err != nil {
+		tlogger.Error(fmt.Sprintf("Connect to sqlite terror: %s", err))
+		return nil, terror.NewInternalf("gorm.Open()", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, terror.NewInternalf("db.DB()", err)
+	}
+	// SQLite allows a single writer, so all operations share one connection.
+	sqlDB.SetMaxOpenConns(1)
+
+	tlogger.Info("Connect to sqlite...")
+	return db, nil
+}
+
+// Gorm exposes the connection for tools working below DBOperations, such as migrations.
+func (m *DB) Gorm() *gorm.DB {
+	return m.db
+}
+
+func (m *DB) Ping(ctx context.Context) error {
+	return tgorm.Ping(ctx, m.db)
+}
+
+func (m *DB) Migrate() error {
+	for _, model := range m.models.All {
+		if err := m.db.AutoMigrate(model.In); err != nil {
+			tlogger.Error(fmt.Sprintf("Migrate terror for: %s, terror: %s", model.Name, err))
+			return terror.NewInternalf(fmt.Sprintf("db.AutoMigrate() - model: %s", model.Name), err)
+		}
+		tlogger.Success(fmt.Sprintf("Migrate success for: %s", model.Name))
+	}
+	return nil
+}
+
+func (m *DB) Add(ctx context.Context, in interface{}) error {
+	tx := tgorm.Begin(ctx, m.db)
+
+	if result := tx.Create(in); result.Error != nil {
+		tx.Rollback()
+		return tgorm.Error("tx.Create()", result.Error)
+	}
+	tx.Commit()
+	return nil
+}
+
+func (m *DB) AddMany(ctx context.Context, in []interface{}) ([]tdatabase.Result, error) {
+	tx := tgorm.Begin(ctx, m.db)
+
+	results, err := tgorm.AddMany(tx.DB, in)
+	if err != nil {
+		tx.Rollback()
+		return results, terror.Wrap("tgorm.AddMany()", err)
+	}
+	tx.Commit()
+	return results, nil
+}
+
+func (m *DB) GetOne(ctx context.Context, in interface{}, params tdatabase.ParamRequest) (interface{}, error) {
+	tx := tgorm.Begin(ctx, m.db)
+
+	query, err := tgorm.Where(tx.Model(in), params)
+	if err != nil {
+		tx.Rollback()
+		return nil, terror.Wrap("tgorm.Where()", err)
+	}
+
+	query = tgorm.Preload(query, params)
+	if result := query.First(in); result.Error != nil {
+		tx.Rollback()
+		return nil, tgorm.Error("tx.First()", result.Error)
+	}
+	tx.Commit()
+	return in, nil
+}
+
+func (m *DB) GetMany(ctx context.Context, in interface{}, params tdatabase.ParamRequest) ([]interface{}, error) {
+	tx := tgorm.Begin(ctx, m.db)
+	query, err := tgorm.Where(tx.Model(in), params)
+	if err != nil {
+		tx.Rollback()
+		return nil, terror.Wrap("tgorm.Where()", err)
+	}
+	result, err := tgorm.FindPage(query, in, params)
+	if err != nil {
+		tx.Rollback()
+		return nil, terror.Wrap("tgorm.FindPage()", err)
+	}
+
+	tx.Commit()
+	return result, nil
+}
+
+func (m *DB) Count(ctx context.Context, in interface{}, params tdatabase.ParamRequest) (int64, error) {
+	db := m.db.WithContext(ctx)
+	if tx := tgorm.TxFromCtx(ctx, m.db); tx != nil {
+		db = tx.WithContext(ctx)
+	}
+
+	query, err := tgorm.Where(db.Model(in), params)
+	if err != nil {
+		return 0, terror.Wrap("tgorm.Where()", err)
+	}
+
+	var total int64
+	if result := query.Count(&total); result.Error != nil {
+		return 0, tgorm.Error("db.Model().Count()", result.Error)
+	}
+	return total, nil
+}
+
+func (m *DB) Update(ctx context.Context, update interface{}, in interface{}, id interface{}) error {
+	tx := tgorm.Begin(ctx, m.db)
+	if err := tgorm.Update(tx.DB, update, in, id); err != nil {
+		tx.Rollback()
+		return terror.Wrap("tgorm.Update()", err)
+	}
+	tx.Commit()
+	return nil
+}
+
+// Delete removes the record id, or marks it deleted for a model with gorm.DeletedAt, a missing record is NotFound.
+func (m *DB) Delete(ctx context.Context, in interface{}, id interface{}) error {
+	tx := tgorm.Begin(ctx, m.db)
+	result := tx.Where(tgorm.ByID(id)).Delete(in)
+	if result.Error != nil {
+		tx.Rollback()
+		return tgorm.Error("tx.Delete()", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return terror.NewNotFound(fmt.Sprintf("record with id %v not found", id))
+	}
+	tx.Commit()
+	return nil
+}
+
+func (m *DB) DeleteMany(ctx context.Context, in interface{}, params tdatabase.ParamRequest) ([]tdatabase.Result, error) {
+	tx := tgorm.Begin(ctx, m.db)
+
+	results, err := tgorm.DeleteMany(tx.DB, in, params)
+	if err != nil {
+		tx.Rollback()
+		return nil, terror.Wrap("tgorm.DeleteMany()", err)
+	}
+	tx.Commit()
+	return results, nil
+}
+
+func (m *DB) WithTx(ctx context.Context, fn func(ctx context.Context, tx tdatabase.DBOperations) error) error {
+	return tgorm.WithTx(ctx, m.db, m, fn)
+}
@@ -0,0 +1,727 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"github.com/WojciechWiderski/tofu/tconfig"
+	"github.com/WojciechWiderski/tofu/tdatabase"
+	"github.com/WojciechWiderski/tofu/tdatabase/tgorm"
+	"github.com/WojciechWiderski/tofu/terror"
+	"github.com/WojciechWiderski/tofu/tmodel"
+)
+
+type item struct {
+	ID    uint
+	Name  string `gorm:"uniqueIndex"`
+	Count int
+}
+
+func newDB(t *testing.T) *DB {
+	t.Helper()
+	db := New(tconfig.SQLite{Path: filepath.Join(t.TempDir(), "test.db")}, tmodel.NewModels(tmodel.NewModel(&item{}, "item")))
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	return db
+}
+
+func TestDB_InMemory(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		conf tconfig.SQLite
+	}{
+		{name: "in memory", conf: tconfig.SQLite{InMemory: true, Path: filepath.Join(t.TempDir(), "unused.db")}},
+		{name: "no path", conf: tconfig.SQLite{}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			stores := make([]*DB, 2)
+			for i := range stores {
+				stores[i] = New(tt.conf, tmodel.NewModels(tmodel.NewModel(&item{}, "item")))
+				if err := stores[i].Migrate(); err != nil {
+					t.Fatalf("Migrate() error = %v", err)
+				}
+			}
+			if err := stores[0].Add(ctx, &item{Name: "a"}); err != nil {
+				t.Fatalf("Add() error = %v", err)
+			}
+
+			for i, want := range []int64{1, 0} {
+				count, err := stores[i].Count(ctx, &item{}, tdatabase.ParamRequest{})
+				if err != nil {
+					t.Fatalf("Count() error = %v", err)
+				}
+				if count != want {
+					t.Errorf("store %d Count() = %d, want %d", i, count, want)
+				}
+			}
+			if tt.conf.Path != "" {
+				if _, err := os.Stat(tt.conf.Path); !os.IsNotExist(err) {
+					t.Errorf("os.Stat(%s) error = %v, want the file not to exist", tt.conf.Path, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDB_Add(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(t)
+	if err := db.Add(ctx, &item{Name: "a"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		in   *item
+		kind terror.Kind
+	}{
+		{name: "new record", in: &item{Name: "b"}},
+		{name: "duplicated unique field", in: &item{Name: "a"}, kind: terror.Conflict},
+		{name: "duplicated id", in: &item{ID: 1, Name: "c"}, kind: terror.Conflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := db.Add(ctx, tt.in)
+			if tt.kind == (terror.Kind{}) {
+				if err != nil {
+					t.Fatalf("Add() error = %v", err)
+				}
+				if tt.in.ID == 0 {
+					t.Errorf("Add() did not set the id")
+				}
+				return
+			}
+			if !errors.Is(err, tt.kind) {
+				t.Errorf("Add() error = %v, want %s", err, tt.kind)
+			}
+		})
+	}
+}
+
+func TestDB_GetOne(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(t)
+	for _, name := range []string{"a", "b"} {
+		if err := db.Add(ctx, &item{Name: name}); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		params tdatabase.ParamRequest
+		want   string
+		kind   terror.Kind
+	}{
+		{name: "by id", params: tdatabase.ParamRequest{By: "id", Value: 2}, want: "b"},
+		{name: "by field", params: tdatabase.ParamRequest{By: "name", Value: "a"}, want: "a"},
+		{name: "missing record", params: tdatabase.ParamRequest{By: "id", Value: 9}, kind: terror.NotFound},
+		{name: "wrong field", params: tdatabase.ParamRequest{By: "nope", Value: 1}, kind: terror.BadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := db.GetOne(ctx, &item{}, tt.params)
+			if tt.kind != (terror.Kind{}) {
+				if !errors.Is(err, tt.kind) {
+					t.Errorf("GetOne() error = %v, want %s", err, tt.kind)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetOne() error = %v", err)
+			}
+			if got := out.(*item).Name; got != tt.want {
+				t.Errorf("GetOne() name = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDB_Update(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(t)
+	for _, name := range []string{"a", "b"} {
+		if err := db.Add(ctx, &item{Name: name, Count: 1}); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		id     int
+		update *item
+		want   item
+		kind   terror.Kind
+	}{
+		{name: "non-zero fields only", id: 1, update: &item{Count: 5}, want: item{ID: 1, Name: "a", Count: 5}},
+		{name: "payload id ignored", id: 2, update: &item{ID: 9, Count: 7}, want: item{ID: 2, Name: "b", Count: 7}},
+		{name: "missing record", id: 9, update: &item{Count: 5}, kind: terror.NotFound},
+		{name: "duplicated unique field", id: 2, update: &item{Name: "a"}, kind: terror.Conflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &item{}
+			err := db.Update(ctx, tt.update, out, tt.id)
+			if tt.kind != (terror.Kind{}) {
+				if !errors.Is(err, tt.kind) {
+					t.Errorf("Update() error = %v, want %s", err, tt.kind)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Update() error = %v", err)
+			}
+			if *out != tt.want {
+				t.Errorf("Update() = %+v, want %+v", *out, tt.want)
+			}
+			stored, err := db.GetOne(ctx, &item{}, tdatabase.ParamRequest{By: "id", Value: tt.id})
+			if err != nil {
+				t.Fatalf("GetOne() error = %v", err)
+			}
+			if *stored.(*item) != tt.want {
+				t.Errorf("stored = %+v, want %+v", *stored.(*item), tt.want)
+			}
+		})
+	}
+}
+
+func TestDB_UpdateInTx(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(t)
+	if err := db.Add(ctx, &item{Name: "a", Count: 1}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	rollback := errors.New("rollback")
+	err := db.WithTx(ctx, func(ctx context.Context, tx tdatabase.DBOperations) error {
+		if err := tx.Update(ctx, &item{Count: 7}, &item{}, 1); err != nil {
+			return err
+		}
+		return rollback
+	})
+	if !errors.Is(err, rollback) {
+		t.Fatalf("WithTx() error = %v, want %v", err, rollback)
+	}
+
+	out, err := db.GetOne(ctx, &item{}, tdatabase.ParamRequest{By: "id", Value: 1})
+	if err != nil {
+		t.Fatalf("GetOne() error = %v", err)
+	}
+	if got := out.(*item).Count; got != 1 {
+		t.Errorf("Count after rollback = %d, want 1", got)
+	}
+}
+
+func TestDB_GetMany(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(t)
+	for i := 0; i < 150; i++ {
+		if err := db.Add(ctx, &item{Name: fmt.Sprintf("item-%03d", i), Count: i}); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		params    tdatabase.ParamRequest
+		wantLen   int
+		wantFirst int
+	}{
+		{name: "no limit reads every record", params: tdatabase.ParamRequest{}, wantLen: 150, wantFirst: 0},
+		{name: "offset without limit", params: tdatabase.ParamRequest{Offset: 140}, wantLen: 10, wantFirst: 140},
+		{name: "limit and offset", params: tdatabase.ParamRequest{Limit: 5, Offset: 10}, wantLen: 5, wantFirst: 10},
+		{name: "sorted descending", params: tdatabase.ParamRequest{Limit: 1, Sort: []tdatabase.Sort{{Field: "count", Desc: true}}}, wantLen: 1, wantFirst: 149},
+		{name: "filter with a typed slice", params: tdatabase.ParamRequest{Filter: tdatabase.Filter{{Field: "count", Operator: tdatabase.OpIn, Value: []int{3, 4}}}}, wantLen: 2, wantFirst: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := db.GetMany(ctx, &item{}, tt.params)
+			if err != nil {
+				t.Fatalf("GetMany() error = %v", err)
+			}
+			if len(out) != tt.wantLen {
+				t.Fatalf("GetMany() len = %d, want %d", len(out), tt.wantLen)
+			}
+			if got := out[0].(*item).Count; got != tt.wantFirst {
+				t.Errorf("GetMany() first = %d, want %d", got, tt.wantFirst)
+			}
+		})
+	}
+}
+
+func TestDB_GetManyCursor(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name         string
+		sort         string
+		insert       int
+		wantForward  string
+		wantBackward string
+	}{
+		{name: "primary key", insert: 0, wantForward: "abc def gx", wantBackward: "abcdefgx"},
+		{name: "ties broken by primary key", sort: "count", insert: -1, wantForward: "bdg cfa e", wantBackward: "xbdgcfae"},
+		{name: "descending", sort: "-count", insert: 3, wantForward: "aec fbd g", wantBackward: "xaecfbdg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newDB(t)
+			for i, count := range []int{2, 0, 1, 0, 2, 1, 0} {
+				if err := db.Add(ctx, &item{Name: string(rune('a' + i)), Count: count}); err != nil {
+					t.Fatalf("Add() error = %v", err)
+				}
+			}
+			read := func(cursor string) ([]string, *tdatabase.Page) {
+				params := tdatabase.ParamRequest{Limit: 3, Sort: tdatabase.ParseSort(tt.sort), Cursor: cursor}
+				items, err := db.GetMany(ctx, &item{}, params)
+				if err != nil {
+					t.Fatalf("GetMany() error = %v", err)
+				}
+				total, err := db.Count(ctx, &item{}, params)
+				if err != nil {
+					t.Fatalf("Count() error = %v", err)
+				}
+				page, err := tdatabase.NewPage(items, total, params)
+				if err != nil {
+					t.Fatalf("NewPage() error = %v", err)
+				}
+				var names []string
+				for _, found := range items {
+					names = append(names, found.(*item).Name)
+				}
+				return names, page
+			}
+
+			// A record added before the position of the next cursor is neither read nor shifts the pages.
+			var forward []string
+			names, page := read("")
+			forward = append(forward, strings.Join(names, ""))
+			if err := db.Add(ctx, &item{Name: "x", Count: tt.insert}); err != nil {
+				t.Fatalf("Add() error = %v", err)
+			}
+			for page.NextCursor != "" {
+				names, page = read(page.NextCursor)
+				forward = append(forward, strings.Join(names, ""))
+			}
+			if got := strings.TrimSpace(strings.Join(forward, " ")); got != tt.wantForward {
+				t.Errorf("forward pages = %s, want %s", got, tt.wantForward)
+			}
+
+			last := forward[len(forward)-1]
+			backward := last
+			for cursor := page.PrevCursor; cursor != ""; cursor = page.PrevCursor {
+				names, page = read(cursor)
+				backward = strings.Join(names, "") + backward
+			}
+			if backward != tt.wantBackward {
+				t.Errorf("backward pages = %s, want %s", backward, tt.wantBackward)
+			}
+		})
+	}
+}
+
+func TestDB_Delete(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(t)
+	if err := db.Add(ctx, &item{Name: "a"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		id   int
+		kind terror.Kind
+	}{
+		{name: "existing record", id: 1},
+		{name: "same record again", id: 1, kind: terror.NotFound},
+		{name: "missing record", id: 9, kind: terror.NotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := db.Delete(ctx, &item{}, tt.id)
+			if tt.kind == (terror.Kind{}) && err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			if tt.kind != (terror.Kind{}) && !errors.Is(err, tt.kind) {
+				t.Errorf("Delete() error = %v, want %s", err, tt.kind)
+			}
+		})
+	}
+}
+
+func TestDB_WithTxTwoStores(t *testing.T) {
+	rollback := errors.New("rollback")
+
+	tests := []struct {
+		name      string
+		fn        func(ctx context.Context, db *DB, other *DB) error
+		wantErr   error
+		wantDB    int64
+		wantOther int64
+	}{
+		{
+			name: "other store does not join",
+			fn: func(ctx context.Context, db *DB, other *DB) error {
+				if err := db.Add(ctx, &item{Name: "a"}); err != nil {
+					return err
+				}
+				if err := other.Add(ctx, &item{Name: "b"}); err != nil {
+					return err
+				}
+				return rollback
+			},
+			wantErr:   rollback,
+			wantDB:    0,
+			wantOther: 1,
+		},
+		{
+			name: "other store counts outside the transaction",
+			fn: func(ctx context.Context, db *DB, other *DB) error {
+				if err := db.Add(ctx, &item{Name: "a"}); err != nil {
+					return err
+				}
+				if n, err := other.Count(ctx, &item{}, tdatabase.ParamRequest{}); err != nil || n != 0 {
+					return fmt.Errorf("other.Count() = %d, %v", n, err)
+				}
+				return nil
+			},
+			wantDB:    1,
+			wantOther: 0,
+		},
+		{
+			name: "committed savepoint is released",
+			fn: func(ctx context.Context, db *DB, other *DB) error {
+				if err := db.WithTx(ctx, func(ctx context.Context, tx tdatabase.DBOperations) error {
+					return tx.Add(ctx, &item{Name: "a"})
+				}); err != nil {
+					return err
+				}
+				if err := tgorm.TxFromCtx(ctx, db.Gorm()).Exec("ROLLBACK TO SAVEPOINT tofu_sp_1").Error; err == nil {
+					return errors.New("savepoint tofu_sp_1 not released")
+				}
+				return nil
+			},
+			wantDB:    1,
+			wantOther: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db, other := newDB(t), newDB(t)
+			err := db.WithTx(ctx, func(ctx context.Context, tx tdatabase.DBOperations) error {
+				return tt.fn(ctx, db, other)
+			})
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("WithTx() error = %v, want %v", err, tt.wantErr)
+			}
+			for store, want := range map[*DB]int64{db: tt.wantDB, other: tt.wantOther} {
+				if got, err := store.Count(ctx, &item{}, tdatabase.ParamRequest{}); err != nil || got != want {
+					t.Errorf("Count() = %d, %v, want %d", got, err, want)
+				}
+			}
+		})
+	}
+}
+
+type code struct {
+	Code string `gorm:"primaryKey"`
+	Name string
+}
+
+func TestDB_StringKey(t *testing.T) {
+	ctx := context.Background()
+	db := New(tconfig.SQLite{}, tmodel.NewModels(tmodel.NewModel(&code{}, "code")))
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	for _, c := range []string{"a-1", "b-2"} {
+		if err := db.Add(ctx, &code{Code: c, Name: c}); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		run  func() error
+		kind terror.Kind
+	}{
+		{name: "update", run: func() error {
+			out := &code{}
+			if err := db.Update(ctx, &code{Name: "updated"}, out, "a-1"); err != nil {
+				return err
+			}
+			if out.Code != "a-1" || out.Name != "updated" {
+				return fmt.Errorf("Update() = %+v", *out)
+			}
+			return nil
+		}},
+		{name: "update missing", run: func() error { return db.Update(ctx, &code{Name: "x"}, &code{}, "c-3") }, kind: terror.NotFound},
+		{name: "id is not sql", run: func() error { return db.Delete(ctx, &code{}, "1 = 1 OR code") }, kind: terror.NotFound},
+		{name: "delete", run: func() error { return db.Delete(ctx, &code{}, "a-1") }},
+		{name: "delete again", run: func() error { return db.Delete(ctx, &code{}, "a-1") }, kind: terror.NotFound},
+		{name: "other record kept", run: func() error {
+			_, err := db.GetOne(ctx, &code{}, tdatabase.ParamRequest{By: "code", Value: "b-2"})
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.run()
+			if tt.kind == (terror.Kind{}) && err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if tt.kind != (terror.Kind{}) && !errors.Is(err, tt.kind) {
+				t.Errorf("error = %v, want %s", err, tt.kind)
+			}
+		})
+	}
+}
+
+func TestDB_WithTx(t *testing.T) {
+	rollback := errors.New("rollback")
+
+	tests := []struct {
+		name      string
+		fn        func(ctx context.Context, tx tdatabase.DBOperations) error
+		wantErr   error
+		wantPanic bool
+		want      []string
+	}{
+		{
+			name: "commit",
+			fn: func(ctx context.Context, tx tdatabase.DBOperations) error {
+				return tx.Add(ctx, &item{Name: "b"})
+			},
+			want: []string{"a", "b"},
+		},
+		{
+			name: "error rolls back add, update and delete",
+			fn: func(ctx context.Context, tx tdatabase.DBOperations) error {
+				if err := tx.Add(ctx, &item{Name: "b"}); err != nil {
+					return err
+				}
+				if err := tx.Update(ctx, &item{Name: "c"}, &item{}, 1); err != nil {
+					return err
+				}
+				if err := tx.Delete(ctx, &item{}, 1); err != nil {
+					return err
+				}
+				return rollback
+			},
+			wantErr: rollback,
+			want:    []string{"a"},
+		},
+		{
+			name: "panic rolls back",
+			fn: func(ctx context.Context, tx tdatabase.DBOperations) error {
+				if err := tx.Add(ctx, &item{Name: "b"}); err != nil {
+					return err
+				}
+				panic("boom")
+			},
+			wantPanic: true,
+			want:      []string{"a"},
+		},
+		{
+			name: "failed nested transaction is a savepoint",
+			fn: func(ctx context.Context, tx tdatabase.DBOperations) error {
+				if err := tx.Add(ctx, &item{Name: "b"}); err != nil {
+					return err
+				}
+				_ = tx.WithTx(ctx, func(ctx context.Context, tx tdatabase.DBOperations) error {
+					if err := tx.Add(ctx, &item{Name: "c"}); err != nil {
+						return err
+					}
+					return rollback
+				})
+				return tx.Add(ctx, &item{Name: "d"})
+			},
+			want: []string{"a", "b", "d"},
+		},
+		{
+			name: "committed nested transaction rolls back with the outer one",
+			fn: func(ctx context.Context, tx tdatabase.DBOperations) error {
+				if err := tx.WithTx(ctx, func(ctx context.Context, tx tdatabase.DBOperations) error {
+					return tx.Add(ctx, &item{Name: "c"})
+				}); err != nil {
+					return err
+				}
+				return rollback
+			},
+			wantErr: rollback,
+			want:    []string{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := newDB(t)
+			if err := db.Add(ctx, &item{Name: "a"}); err != nil {
+				t.Fatalf("Add() error = %v", err)
+			}
+
+			func() {
+				defer func() {
+					if p := recover(); (p != nil) != tt.wantPanic {
+						t.Errorf("WithTx() panic = %v, wantPanic %v", p, tt.wantPanic)
+					}
+				}()
+				if err := db.WithTx(ctx, tt.fn); !errors.Is(err, tt.wantErr) {
+					t.Errorf("WithTx() error = %v, want %v", err, tt.wantErr)
+				}
+			}()
+
+			out, err := db.GetMany(ctx, &item{}, tdatabase.ParamRequest{})
+			if err != nil {
+				t.Fatalf("GetMany() error = %v", err)
+			}
+			var got []string
+			for _, o := range out {
+				got = append(got, o.(*item).Name)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("records = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+type author struct {
+	ID    uint
+	Name  string
+	Books []book
+}
+
+type book struct {
+	ID       uint
+	Title    string
+	AuthorID uint
+	Author   *author
+	Tags     []tag `gorm:"many2many:book_tags"`
+}
+
+type tag struct {
+	ID   uint
+	Name string
+}
+
+// countQueries counts the select statements run on db from now on.
+func countQueries(t *testing.T, db *DB) *int {
+	t.Helper()
+	count := new(int)
+	err := db.Gorm().Callback().Query().After("gorm:query").Register("test:count", func(*gorm.DB) { *count++ })
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	return count
+}
+
+func TestDB_Include(t *testing.T) {
+	ctx := context.Background()
+	db := New(tconfig.SQLite{Path: filepath.Join(t.TempDir(), "test.db")},
+		tmodel.NewModels(tmodel.NewModel(&author{}, "author"), tmodel.NewModel(&book{}, "book"), tmodel.NewModel(&tag{}, "tag")))
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	for a := 1; a <= 3; a++ {
+		if err := db.Add(ctx, &author{Name: fmt.Sprintf("author-%d", a)}); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+		for b := 0; b < 2; b++ {
+			in := &book{Title: fmt.Sprintf("book-%d-%d", a, b), AuthorID: uint(a), Tags: []tag{{Name: fmt.Sprintf("tag-%d-%d", a, b)}}}
+			if err := db.Add(ctx, in); err != nil {
+				t.Fatalf("Add() error = %v", err)
+			}
+		}
+	}
+	queries := countQueries(t, db)
+
+	tests := []struct {
+		name        string
+		in          interface{}
+		include     []string
+		check       func(out []interface{}) string
+		want        string
+		wantQueries int
+	}{
+		{
+			name:        "no include",
+			in:          &author{},
+			check:       func(out []interface{}) string { return fmt.Sprint(len(out[0].(*author).Books)) },
+			want:        "0",
+			wantQueries: 1,
+		},
+		{
+			name:    "has many",
+			in:      &author{},
+			include: []string{"Books"},
+			check: func(out []interface{}) string {
+				return fmt.Sprint(len(out[0].(*author).Books), len(out[2].(*author).Books))
+			},
+			want:        "2 2",
+			wantQueries: 2,
+		},
+		{
+			name:        "belongs to",
+			in:          &book{},
+			include:     []string{"Author"},
+			check:       func(out []interface{}) string { return out[5].(*book).Author.Name },
+			want:        "author-3",
+			wantQueries: 2,
+		},
+		{
+			name:        "many to many",
+			in:          &book{},
+			include:     []string{"Tags"},
+			check:       func(out []interface{}) string { return out[1].(*book).Tags[0].Name },
+			want:        "tag-1-1",
+			wantQueries: 3,
+		},
+		{
+			name:    "nested",
+			in:      &author{},
+			include: []string{"Books.Tags"},
+			check: func(out []interface{}) string {
+				return out[1].(*author).Books[1].Tags[0].Name
+			},
+			want:        "tag-2-1",
+			wantQueries: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*queries = 0
+			out, err := db.GetMany(ctx, tt.in, tdatabase.ParamRequest{Include: tt.include})
+			if err != nil {
+				t.Fatalf("GetMany() error = %v", err)
+			}
+			if got := tt.check(out); got != tt.want {
+				t.Errorf("GetMany() = %s, want %s", got, tt.want)
+			}
+			if *queries != tt.wantQueries {
+				t.Errorf("GetMany() ran %d queries, want %d", *queries, tt.wantQueries)
+			}
+		})
+	}
+
+	one, err := db.GetOne(ctx, &author{}, tdatabase.ParamRequest{By: "id", Value: 2, Include: []string{"Books"}})
+	if err != nil {
+		t.Fatalf("GetOne() error = %v", err)
+	}
+	if got := len(one.(*author).Books); got != 2 {
+		t.Errorf("GetOne() books = %d, want 2", got)
+	}
+}
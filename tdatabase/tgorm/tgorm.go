@@ -0,0 +1,257 @@
+// Package tgorm holds the query building shared by the gorm based backends.
+package tgorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"github.com/WojciechWiderski/tofu/tdatabase"
+	"github.com/WojciechWiderski/tofu/terror"
+)
+
+// Ping pings the connection pool behind db.
+func Ping(ctx context.Context, db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return terror.NewInternalf("db.DB()", err)
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return terror.NewInternalf("sqlDB.PingContext()", err)
+	}
+	return nil
+}
+
+// Error maps gorm and driver errors onto terror kinds, missing records are NotFound and unique or foreign
+// key violations are Conflict. The backends open gorm with TranslateError so driver errors are translated.
+func Error(msg string, err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return terror.Newf(terror.NotFound, msg, err)
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return terror.Newf(terror.Conflict, msg, err).WithCode("duplicated_key")
+	case errors.Is(err, gorm.ErrForeignKeyViolated):
+		return terror.Newf(terror.Conflict, msg, err).WithCode("foreign_key_violated")
+	}
+	return terror.NewInternalf(msg, err)
+}
+
+// Where applies params.Conditions() to tx, which must already have a model set. Fields are looked up in the
+// model schema and every value is passed as a query parameter, nothing from params is put into the SQL text.
+func Where(tx *gorm.DB, params tdatabase.ParamRequest) (*gorm.DB, error) {
+	if err := tx.Statement.Parse(tx.Statement.Model); err != nil {
+		return nil, terror.NewInternalf("tx.Statement.Parse()", err)
+	}
+
+	var expressions []clause.Expression
+	for _, condition := range params.Conditions() {
+		field := tx.Statement.Schema.LookUpField(condition.Field)
+		if field == nil || field.DBName == "" {
+			return nil, terror.NewBadRequest(fmt.Sprintf("wrong filter field %s", condition.Field))
+		}
+		column := clause.Column{Table: clause.CurrentTable, Name: field.DBName}
+
+		switch condition.Operator {
+		case tdatabase.OpEq:
+			expressions = append(expressions, clause.Eq{Column: column, Value: condition.Value})
+		case tdatabase.OpNe:
+			expressions = append(expressions, clause.Neq{Column: column, Value: condition.Value})
+		case tdatabase.OpLt:
+			expressions = append(expressions, clause.Lt{Column: column, Value: condition.Value})
+		case tdatabase.OpLte:
+			expressions = append(expressions, clause.Lte{Column: column, Value: condition.Value})
+		case tdatabase.OpGt:
+			expressions = append(expressions, clause.Gt{Column: column, Value: condition.Value})
+		case tdatabase.OpGte:
+			expressions = append(expressions, clause.Gte{Column: column, Value: condition.Value})
+		case tdatabase.OpIn:
+			expressions = append(expressions, clause.IN{Column: column, Values: condition.Values()})
+		case tdatabase.OpNotIn:
+			expressions = append(expressions, clause.Not(clause.IN{Column: column, Values: condition.Values()}))
+		case tdatabase.OpLike:
+			expressions = append(expressions, clause.Like{Column: column, Value: condition.Value})
+		case tdatabase.OpNull:
+			if isNull, _ := condition.Value.(bool); isNull {
+				expressions = append(expressions, clause.Eq{Column: column, Value: nil})
+			} else {
+				expressions = append(expressions, clause.Neq{Column: column, Value: nil})
+			}
+		default:
+			return nil, terror.NewBadRequest(fmt.Sprintf("wrong filter operator %s", condition.Operator))
+		}
+	}
+
+	if len(expressions) == 0 {
+		return tx, nil
+	}
+	return tx.Clauses(clause.Where{Exprs: expressions}), nil
+}
+
+// FindPage reads the page of params from tx, which must already have a model set, with the includes of
+// params. The page is sorted by the keyset of params and starts after its cursor, or at the offset without
+// one. A zero limit reads every record.
+func FindPage(tx *gorm.DB, in interface{}, params tdatabase.ParamRequest) ([]interface{}, error) {
+	limit, offset, err := params.Window()
+	if err != nil {
+		return nil, terror.NewBadRequest(err.Error())
+	}
+	if err := tx.Statement.Parse(tx.Statement.Model); err != nil {
+		return nil, terror.NewInternalf("tx.Statement.Parse()", err)
+	}
+	keyset, err := params.Keyset(tx.Statement.Schema)
+	if err != nil {
+		return nil, terror.NewBadRequest(err.Error())
+	}
+
+	// The records before a cursor are the first ones in reverse order, they are put back in order below.
+	for i, field := range keyset.Fields {
+		tx = tx.Order(clause.OrderByColumn{Column: column(field), Desc: keyset.Desc[i] != keyset.Before})
+	}
+	if keyset.Values != nil {
+		tx = tx.Where(keysetWhere(keyset))
+	}
+
+	switch {
+	case limit > 0:
+		tx = tx.Limit(limit)
+	case offset > 0 && tx.Dialector.Name() == "mysql":
+		// MySQL has no OFFSET without LIMIT.
+		tx = tx.Limit(math.MaxInt64)
+	}
+
+	items, err := Find(Preload(tx.Offset(offset), params), in)
+	if err != nil {
+		return nil, terror.Wrap("Find()", err)
+	}
+	if keyset.Before {
+		slices.Reverse(items)
+	}
+	return items, nil
+}
+
+// keysetWhere matches the records past the cursor record of keyset, e.g. (name > ? OR (name = ? AND id > ?))
+// for an ascending sort by name.
+func keysetWhere(keyset *tdatabase.Keyset) clause.Expression {
+	var or []clause.Expression
+	for i, field := range keyset.Fields {
+		and := make([]clause.Expression, 0, i+1)
+		for j := 0; j < i; j++ {
+			and = append(and, clause.Eq{Column: column(keyset.Fields[j]), Value: keyset.Values[j]})
+		}
+		if keyset.Greater(i) {
+			and = append(and, clause.Gt{Column: column(field), Value: keyset.Values[i]})
+		} else {
+			and = append(and, clause.Lt{Column: column(field), Value: keyset.Values[i]})
+		}
+		or = append(or, clause.And(and...))
+	}
+	if len(or) == 1 {
+		return or[0]
+	}
+	return clause.Or(or...)
+}
+
+func column(field *schema.Field) clause.Column {
+	return clause.Column{Table: clause.CurrentTable, Name: field.DBName}
+}
+
+// Preload loads params.Include with the records queried by tx, gorm runs one query per relation for all
+// the records instead of one per record.
+func Preload(tx *gorm.DB, params tdatabase.ParamRequest) *gorm.DB {
+	for _, include := range params.Include {
+		tx = tx.Preload(include)
+	}
+	return tx
+}
+
+// Find returns every record matching tx as new values of the type of in.
+func Find(tx *gorm.DB, in interface{}) ([]interface{}, error) {
+	found := reflect.New(reflect.SliceOf(reflect.TypeOf(in)))
+	if result := tx.Find(found.Interface()); result.Error != nil {
+		return nil, Error("tx.Find()", result.Error)
+	}
+
+	var items []interface{}
+	for i := 0; i < found.Elem().Len(); i++ {
+		items = append(items, found.Elem().Index(i).Interface())
+	}
+	return items, nil
+}
+
+// ByID matches the primary key of the statement model to id, which may be an integer, a string or a uuid.
+// gorm takes a string passed to First or Delete as SQL, so the id always goes in as a query parameter.
+func ByID(id interface{}) clause.Expression {
+	return clause.Eq{Column: clause.PrimaryColumn, Value: id}
+}
+
+// Update reads the record id into in and writes the non-zero fields of update to it, both on tx so the
+// lookup and the write are atomic. The primary key and CreatedAt of update are never written, like in the
+// memory store.
+func Update(tx *gorm.DB, update interface{}, in interface{}, id interface{}) error {
+	if result := tx.Model(in).Where(ByID(id)).First(in); result.Error != nil {
+		return Error("tx.First()", result.Error)
+	}
+	query := tx.Model(in)
+	if err := query.Statement.Parse(in); err != nil {
+		return terror.NewInternalf("query.Statement.Parse()", err)
+	}
+	omit := append([]string{"CreatedAt"}, query.Statement.Schema.PrimaryFieldDBNames...)
+	if result := query.Omit(omit...).Updates(update); result.Error != nil {
+		return Error("tx.Model().Updates()", result.Error)
+	}
+	return nil
+}
+
+// AddMany creates every item inside tx. It stops on the first failing item and returns the results so far,
+// the caller is responsible for rolling tx back.
+func AddMany(tx *gorm.DB, in []interface{}) ([]tdatabase.Result, error) {
+	results := make([]tdatabase.Result, 0, len(in))
+	for i, item := range in {
+		results = append(results, tdatabase.Result{Index: i, Item: item})
+		if result := tx.Create(item); result.Error != nil {
+			results[i].Error = result.Error.Error()
+			return results, Error(fmt.Sprintf("tx.Create() - item %d", i), result.Error)
+		}
+	}
+	return results, nil
+}
+
+// DeleteMany deletes every record of in matching params and returns the deleted records. Params without
+// any condition are rejected so a missing filter never empties the table.
+func DeleteMany(tx *gorm.DB, in interface{}, params tdatabase.ParamRequest) ([]tdatabase.Result, error) {
+	if len(params.Conditions()) == 0 {
+		return nil, terror.NewBadRequest("delete many requires at least one filter")
+	}
+
+	query, err := Where(tx.Model(in), params)
+	if err != nil {
+		return nil, terror.Wrap("Where()", err)
+	}
+
+	found := reflect.New(reflect.SliceOf(reflect.TypeOf(in)))
+	if result := query.Find(found.Interface()); result.Error != nil {
+		return nil, Error("query.Find()", result.Error)
+	}
+
+	items := found.Elem()
+	if items.Len() == 0 {
+		return []tdatabase.Result{}, nil
+	}
+
+	if result := tx.Delete(items.Interface()); result.Error != nil {
+		return nil, Error("tx.Delete()", result.Error)
+	}
+
+	results := make([]tdatabase.Result, items.Len())
+	for i := 0; i < items.Len(); i++ {
+		results[i] = tdatabase.Result{Index: i, Item: items.Index(i).Interface()}
+	}
+	return results, nil
+}
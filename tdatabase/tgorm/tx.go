@@ -0,0 +1,127 @@
+package tgorm
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+
+	"github.com/WojciechWiderski/tofu/tdatabase"
+	"github.com/WojciechWiderski/tofu/terror"
+)
+
+// txCtxKey keys the transaction of one database in a context, so a backend on another database never
+// joins it.
+type txCtxKey struct {
+	db *gorm.DB
+}
+
+// txState is a transaction carried in a context, savepoints numbers the savepoints taken in it.
+type txState struct {
+	tx         *gorm.DB
+	savepoints atomic.Uint64
+}
+
+// Tx is a transaction used by a single DBOperations call. When the context already carries a transaction
+// started by WithTx the call joins it, Commit and Rollback are then left to WithTx.
+type Tx struct {
+	*gorm.DB
+	joined bool
+}
+
+// ContextWithTx returns ctx carrying tx as the transaction of db, the *gorm.DB the backend was opened with.
+func ContextWithTx(ctx context.Context, db *gorm.DB, tx *gorm.DB) context.Context {
+	return context.WithValue(ctx, txCtxKey{db: db}, &txState{tx: tx})
+}
+
+// TxFromCtx returns the transaction of db carried by ctx, nil without one.
+func TxFromCtx(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if state := txStateFromCtx(ctx, db); state != nil {
+		return state.tx
+	}
+	return nil
+}
+
+func txStateFromCtx(ctx context.Context, db *gorm.DB) *txState {
+	if state, ok := ctx.Value(txCtxKey{db: db}).(*txState); ok {
+		return state
+	}
+	return nil
+}
+
+// Begin joins the transaction from ctx or starts a new one on db.
+func Begin(ctx context.Context, db *gorm.DB) *Tx {
+	if tx := TxFromCtx(ctx, db); tx != nil {
+		return &Tx{DB: tx.WithContext(ctx), joined: true}
+	}
+	return &Tx{DB: db.WithContext(ctx).Begin()}
+}
+
+func (t *Tx) Commit() {
+	if !t.joined {
+		t.DB.Commit()
+	}
+}
+
+func (t *Tx) Rollback() {
+	if !t.joined {
+		t.DB.Rollback()
+	}
+}
+
+// WithTx runs fn in a transaction carried by the context passed to fn, so every DBOperations call made
+// with that context on db uses it. A nested WithTx creates a savepoint. The transaction, or the savepoint, is
+// rolled back when fn returns an error or panics and committed, or released, otherwise.
+func WithTx(ctx context.Context, db *gorm.DB, operations tdatabase.DBOperations, fn func(ctx context.Context, tx tdatabase.DBOperations) error) (err error) {
+	if state := txStateFromCtx(ctx, db); state != nil {
+		return withSavepoint(ctx, state, operations, fn)
+	}
+
+	tx := db.WithContext(ctx).Begin()
+	if tx.Error != nil {
+		return terror.NewInternalf("db.Begin()", tx.Error)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(ContextWithTx(ctx, db, tx), operations); err != nil {
+		tx.Rollback()
+		return terror.Wrap("fn()", err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return terror.NewInternalf("tx.Commit()", err)
+	}
+	return nil
+}
+
+func withSavepoint(ctx context.Context, state *txState, operations tdatabase.DBOperations, fn func(ctx context.Context, tx tdatabase.DBOperations) error) error {
+	tx := state.tx
+	name := fmt.Sprintf("tofu_sp_%d", state.savepoints.Add(1))
+	if err := tx.SavePoint(name).Error; err != nil {
+		return terror.NewInternalf("tx.SavePoint()", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.RollbackTo(name)
+			panic(p)
+		}
+	}()
+
+	if err := fn(ctx, operations); err != nil {
+		tx.RollbackTo(name)
+		return terror.Wrap("fn()", err)
+	}
+
+	if err := tx.Exec("RELEASE SAVEPOINT " + name).Error; err != nil {
+		return terror.NewInternalf("tx.Exec() - release savepoint", err)
+	}
+	return nil
+}
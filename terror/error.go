@@ -4,16 +4,178 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"runtime"
+	"strings"
 
 	"github.com/WojciechWiderski/tofu/tlogger"
 )
 
-const RecordNotFound error
+// CaptureStack makes every new error record the stack of its creation, see BetterError.Stack.
+var CaptureStack = false
 
+// BetterError is an error of a Kind with an optional machine readable code and details. It wraps its
+// cause, so errors.Is and errors.As see through it.
 type BetterError struct {
-	error
-	code int
+	kind    Kind
+	code    string
+	msg     string
+	err     error
+	details interface{}
+	stack   []uintptr
+}
+
+func (e BetterError) Error() string {
+	switch {
+	case e.msg == "" && e.err == nil:
+		return e.kind.Error()
+	case e.msg == "":
+		return e.err.Error()
+	case e.err == nil:
+		return e.msg
+	}
+	return fmt.Sprintf("%s: %s", e.msg, e.err)
+}
+
+// Message returns the message meant for the client, without the wrap messages that name the failing calls:
+// the cause of the innermost BetterError, or its msg when it has no cause. Error returns the whole chain
+// for the logs.
+func (e BetterError) Message() string {
+	var inner BetterError
+	if errors.As(e.err, &inner) {
+		return inner.Message()
+	}
+	switch {
+	case e.err != nil:
+		return e.err.Error()
+	case e.msg != "":
+		return e.msg
+	}
+	return e.kind.Error()
+}
+
+func (e BetterError) Unwrap() error {
+	return e.err
+}
+
+// Is reports whether target is the Kind of e.
+func (e BetterError) Is(target error) bool {
+	kind, ok := target.(Kind)
+	return ok && kind == e.kind
+}
+
+func (e BetterError) Kind() Kind {
+	return e.kind
+}
+
+func (e BetterError) Status() int {
+	return e.kind.status
+}
+
+// Code returns the code of e, or of the first wrapped error with one, and the kind name otherwise.
+func (e BetterError) Code() string {
+	if e.code != "" {
+		return e.code
+	}
+	var inner BetterError
+	if errors.As(e.err, &inner) {
+		return inner.Code()
+	}
+	return e.kind.name
+}
+
+// Details returns the details of e or of the first wrapped error with them.
+func (e BetterError) Details() interface{} {
+	if e.details != nil {
+		return e.details
+	}
+	var inner BetterError
+	if errors.As(e.err, &inner) {
+		return inner.Details()
+	}
+	return nil
+}
+
+// Stack returns the stack recorded when CaptureStack was enabled, of the deepest error that has one.
+func (e BetterError) Stack() string {
+	var inner BetterError
+	if errors.As(e.err, &inner) {
+		if stack := inner.Stack(); stack != "" {
+			return stack
+		}
+	}
+	if len(e.stack) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	frames := runtime.CallersFrames(e.stack)
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+func (e BetterError) WithCode(code string) BetterError {
+	e.code = code
+	return e
+}
+
+func (e BetterError) WithDetails(details interface{}) BetterError {
+	e.details = details
+	return e
+}
+
+// New returns an error of the given kind.
+func New(kind Kind, msg string) BetterError {
+	return BetterError{kind: kind, msg: msg, stack: callers()}
+}
+
+// Newf returns an error of the given kind wrapping err.
+func Newf(kind Kind, msg string, err error) BetterError {
+	return BetterError{kind: kind, msg: msg, err: err, stack: callers()}
+}
+
+func callers() []uintptr {
+	if !CaptureStack {
+		return nil
+	}
+	pc := make([]uintptr, 32)
+	n := runtime.Callers(3, pc)
+	return pc[:n]
+}
+
+// KindOf returns the Kind of the outermost BetterError in the chain of err, plain errors are Internal.
+func KindOf(err error) Kind {
+	var betterError BetterError
+	if errors.As(err, &betterError) {
+		return betterError.kind
+	}
+	return Internal
+}
+
+// FieldError describes a single field of a payload that failed validation.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (v ValidationError) Error() string {
+	messages := make([]string, len(v.Fields))
+	for i, field := range v.Fields {
+		messages[i] = fmt.Sprintf("%s: %s", field.Field, field.Message)
+	}
+	return fmt.Sprintf("validation failed: %s", strings.Join(messages, "; "))
 }
 
 func HttpApiHandleError(h func(http.ResponseWriter, *http.Request) (interface{}, error)) http.HandlerFunc {
@@ -21,32 +183,27 @@ func HttpApiHandleError(h func(http.ResponseWriter, *http.Request) (interface{},
 		resp, err := h(w, r)
 		if err == nil {
 			HttpApiHandleSuccess(w, r, http.StatusOK, resp)
+			return
 		}
 		HandleError(w, r, err)
 	}
 }
+
+// HandleError writes err as an RFC 7807 problem, errors without a Kind are Internal.
 func HandleError(w http.ResponseWriter, r *http.Request, err error) {
-	betterError := err.(BetterError)
-	if betterError.code == 0 {
-		betterError.code = http.StatusOK
-	}
+	problem := NewProblem(r, err)
 
-	tlogger.Error(betterError.error.Error())
-	handleStats(r, betterError.code)
-	writeJSON(w, r, betterError.code, betterError.error)
+	tlogger.Default().ErrorContext(r.Context(), fmt.Sprintf("%s %s", r.Method, r.URL.Path),
+		slog.Int("status", problem.Status),
+		slog.String("error", err.Error()),
+	)
+	writeProblem(w, problem)
 }
 
 func HttpApiHandleSuccess(w http.ResponseWriter, r *http.Request, statusCode int, body interface{}) {
-	handleStats(r, statusCode)
 	writeJSON(w, r, statusCode, body)
 }
 
-func handleStats(r *http.Request, statusCode int) {
-	if 0 == statusCode {
-		return
-	}
-}
-
 func writeJSON(w http.ResponseWriter, r *http.Request, statusCode int, body interface{}) {
 
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -60,38 +217,48 @@ func writeJSON(w http.ResponseWriter, r *http.Request, statusCode int, body inte
 	}
 }
 
+// Wrap adds msg to err keeping its kind, a plain error becomes Internal. Wrapping nil returns nil.
 func Wrap(msg string, err error) error {
-	betterError := err.(BetterError)
+	if err == nil {
+		return nil
+	}
 	return BetterError{
-		code:  betterError.code,
-		error: errors.Join(fmt.Errorf(msg), betterError.error),
+		kind: KindOf(err),
+		msg:  msg,
+		err:  err,
 	}
 }
 
 func NewForbidden(msg string) error {
-	return BetterError{
-		code:  403,
-		error: fmt.Errorf(msg),
-	}
+	return New(Forbidden, msg)
+}
+
+func NewUnauthorized(msg string) error {
+	return New(Unauthorized, msg)
 }
 
 func NewBadRequest(msg string) error {
-	return BetterError{
-		code:  400,
-		error: fmt.Errorf(msg),
-	}
+	return New(BadRequest, msg)
+}
+
+func NewNotFound(msg string) error {
+	return New(NotFound, msg)
+}
+
+func NewConflict(msg string) error {
+	return New(Conflict, msg)
+}
+
+// NewValidation returns a 422 error, the failing fields are written as the response body.
+func NewValidation(fields []FieldError) error {
+	validationError := ValidationError{Fields: fields}
+	return Newf(Validation, "", validationError).WithDetails(validationError)
 }
 
 func NewInternalf(msg string, err error) error {
-	return BetterError{
-		code:  500,
-		error: fmt.Errorf("%s -> %s", msg, err),
-	}
+	return Newf(Internal, msg, err)
 }
 
 func NewInternal(msg string) error {
-	return BetterError{
-		code:  500,
-		error: fmt.Errorf(msg),
-	}
+	return New(Internal, msg)
 }
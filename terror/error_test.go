@@ -0,0 +1,115 @@
+package terror
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBetterError(t *testing.T) {
+	plain := errors.New("record not found")
+	notFound := Newf(NotFound, "tx.First()", plain)
+
+	tests := []struct {
+		name        string
+		err         error
+		wantKind    Kind
+		wantError   string
+		wantMessage string
+		wantCode    string
+	}{
+		{name: "new", err: NewBadRequest("wrong id"), wantKind: BadRequest, wantError: "wrong id", wantMessage: "wrong id", wantCode: "bad_request"},
+		{name: "new with a cause", err: notFound, wantKind: NotFound, wantError: "tx.First(): record not found", wantMessage: "record not found", wantCode: "not_found"},
+		{name: "wrapped", err: Wrap("a.Database.GetOne", Wrap("fn()", notFound)), wantKind: NotFound, wantError: "a.Database.GetOne: fn(): tx.First(): record not found", wantMessage: "record not found", wantCode: "not_found"},
+		{name: "wrapped code", err: Wrap("fn()", NewConflict("duplicated key name").(BetterError).WithCode("duplicated_key")), wantKind: Conflict, wantError: "fn(): duplicated key name", wantMessage: "duplicated key name", wantCode: "duplicated_key"},
+		{name: "plain error wrapped", err: Wrap("fn()", plain), wantKind: Internal, wantError: "fn(): record not found", wantMessage: "record not found", wantCode: "internal"},
+		{name: "validation", err: NewValidation([]FieldError{{Field: "name", Rule: "required", Message: "is required"}}), wantKind: Validation, wantError: "validation failed: name: is required", wantMessage: "validation failed: name: is required", wantCode: "validation"},
+		{name: "kind only", err: New(Forbidden, ""), wantKind: Forbidden, wantError: "forbidden", wantMessage: "forbidden", wantCode: "forbidden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var betterError BetterError
+			if !errors.As(tt.err, &betterError) {
+				t.Fatalf("%v is not a BetterError", tt.err)
+			}
+			if !errors.Is(tt.err, tt.wantKind) || KindOf(tt.err) != tt.wantKind {
+				t.Errorf("KindOf() = %s, want %s", KindOf(tt.err), tt.wantKind)
+			}
+			if got := tt.err.Error(); got != tt.wantError {
+				t.Errorf("Error() = %q, want %q", got, tt.wantError)
+			}
+			if got := betterError.Message(); got != tt.wantMessage {
+				t.Errorf("Message() = %q, want %q", got, tt.wantMessage)
+			}
+			if got := betterError.Code(); got != tt.wantCode {
+				t.Errorf("Code() = %q, want %q", got, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Kind
+	}{
+		{name: "plain error", err: errors.New("boom"), want: Internal},
+		{name: "fmt wrapped", err: fmt.Errorf("outer: %w", NewNotFound("missing")), want: NotFound},
+		{name: "outermost kind wins", err: Newf(Forbidden, "authorizer", NewNotFound("missing")), want: Forbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := KindOf(tt.err); got != tt.want {
+				t.Errorf("KindOf() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrapNil(t *testing.T) {
+	if err := Wrap("fn()", nil); err != nil {
+		t.Errorf("Wrap(nil) = %v, want nil", err)
+	}
+}
+
+func TestBetterError_DetailsAndStack(t *testing.T) {
+	CaptureStack = true
+	t.Cleanup(func() { CaptureStack = false })
+
+	inner := NewConflict("duplicated key").(BetterError).WithDetails("inner")
+	tests := []struct {
+		name        string
+		err         BetterError
+		wantDetails interface{}
+		wantStack   bool
+	}{
+		{name: "own details", err: New(BadRequest, "x").WithDetails(1), wantDetails: 1, wantStack: true},
+		{name: "details of the wrapped error", err: Wrap("fn()", inner).(BetterError), wantDetails: "inner", wantStack: true},
+		{name: "outer details win", err: Wrap("fn()", inner).(BetterError).WithDetails("outer"), wantDetails: "outer", wantStack: true},
+		{name: "no stack without CaptureStack", err: BetterError{kind: Internal}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Details(); got != tt.wantDetails {
+				t.Errorf("Details() = %v, want %v", got, tt.wantDetails)
+			}
+			if got := tt.err.Stack(); (got != "") != tt.wantStack || (tt.wantStack && !strings.Contains(got, "TestBetterError_DetailsAndStack")) {
+				t.Errorf("Stack() = %q, want a stack %v", got, tt.wantStack)
+			}
+		})
+	}
+}
+
+func TestErrorsAs(t *testing.T) {
+	err := fmt.Errorf("handler: %w", Wrap("fn()", NewValidation([]FieldError{{Field: "name", Rule: "required"}})))
+
+	var validationError ValidationError
+	if !errors.As(err, &validationError) || len(validationError.Fields) != 1 {
+		t.Errorf("errors.As(ValidationError) = %+v", validationError)
+	}
+	if !errors.Is(err, Validation) || errors.Is(err, NotFound) {
+		t.Errorf("errors.Is() does not match the kind of %v", err)
+	}
+}
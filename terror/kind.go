@@ -0,0 +1,33 @@
+package terror
+
+import "net/http"
+
+// Kind classifies an error and decides its HTTP status. The exported kinds are sentinels for errors.Is,
+// e.g. errors.Is(err, terror.NotFound).
+type Kind struct {
+	name   string
+	status int
+}
+
+var (
+	BadRequest   = Kind{name: "bad_request", status: http.StatusBadRequest}
+	Unauthorized = Kind{name: "unauthorized", status: http.StatusUnauthorized}
+	Forbidden    = Kind{name: "forbidden", status: http.StatusForbidden}
+	NotFound     = Kind{name: "not_found", status: http.StatusNotFound}
+	NotAllowed   = Kind{name: "method_not_allowed", status: http.StatusMethodNotAllowed}
+	Conflict     = Kind{name: "conflict", status: http.StatusConflict}
+	Validation   = Kind{name: "validation", status: http.StatusUnprocessableEntity}
+	Internal     = Kind{name: "internal", status: http.StatusInternalServerError}
+)
+
+func (k Kind) Error() string {
+	return k.name
+}
+
+func (k Kind) String() string {
+	return k.name
+}
+
+func (k Kind) Status() int {
+	return k.status
+}
@@ -0,0 +1,82 @@
+package terror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// ProblemTypeBase prefixes the kind name to build the problem type URI, with the default about:blank the
+// title is the HTTP status text as RFC 7807 requires.
+var ProblemTypeBase = "about:blank"
+
+// ExposeInternalErrors writes the message of Internal errors as the problem detail, which may leak
+// database or driver messages, so it is meant for development only.
+var ExposeInternalErrors = false
+
+// Problem is an RFC 7807 problem details object with the tofu extension members.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	Details   interface{}  `json:"details,omitempty"`
+}
+
+func NewProblem(r *http.Request, err error) Problem {
+	var betterError BetterError
+	if !errors.As(err, &betterError) {
+		betterError = Newf(Internal, "", err)
+	}
+	kind := betterError.Kind()
+
+	problem := Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(kind.Status()),
+		Status:    kind.Status(),
+		Detail:    Detail(err),
+		Instance:  r.URL.Path,
+		Code:      betterError.Code(),
+		RequestID: middleware.GetReqID(r.Context()),
+	}
+	if ProblemTypeBase != "" && ProblemTypeBase != "about:blank" {
+		problem.Type = ProblemTypeBase + kind.String()
+	}
+
+	switch details := betterError.Details().(type) {
+	case nil:
+	case ValidationError:
+		problem.Errors = details.Fields
+	default:
+		problem.Details = details
+	}
+	return problem
+}
+
+// Detail returns the message of err meant for the client, see BetterError.Message. It is empty for Internal
+// errors unless ExposeInternalErrors is set.
+func Detail(err error) string {
+	var betterError BetterError
+	if !errors.As(err, &betterError) {
+		betterError = Newf(Internal, "", err)
+	}
+	if betterError.Kind() == Internal && !ExposeInternalErrors {
+		return ""
+	}
+	return betterError.Message()
+}
+
+func writeProblem(w http.ResponseWriter, problem Problem) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(problem.Status)
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(true)
+	_ = enc.Encode(problem)
+}
@@ -0,0 +1,85 @@
+package terror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestNewProblem(t *testing.T) {
+	fields := []FieldError{{Field: "name", Rule: "required", Message: "is required"}}
+
+	tests := []struct {
+		name     string
+		err      error
+		expose   bool
+		typeBase string
+		want     Problem
+	}{
+		{
+			name: "wrapped not found",
+			err:  Wrap("a.Database.GetOne", Newf(NotFound, "tx.First()", errors.New("record not found"))),
+			want: Problem{Type: "about:blank", Title: "Not Found", Status: 404, Detail: "record not found", Instance: "/api/task", Code: "not_found"},
+		},
+		{
+			name: "validation",
+			err:  Wrap("a.validate", NewValidation(fields)),
+			want: Problem{Type: "about:blank", Title: "Unprocessable Entity", Status: 422, Detail: "validation failed: name: is required", Instance: "/api/task", Code: "validation", Errors: fields},
+		},
+		{
+			name: "details",
+			err:  Wrap("fn()", NewConflict("duplicated key").(BetterError).WithCode("duplicated_key").WithDetails([]int{1})),
+			want: Problem{Type: "about:blank", Title: "Conflict", Status: 409, Detail: "duplicated key", Instance: "/api/task", Code: "duplicated_key", Details: []int{1}},
+		},
+		{
+			name: "internal is hidden",
+			err:  Wrap("fn()", errors.New("dial tcp: connection refused")),
+			want: Problem{Type: "about:blank", Title: "Internal Server Error", Status: 500, Instance: "/api/task", Code: "internal"},
+		},
+		{
+			name:   "internal is exposed",
+			err:    NewInternalf("db.Exec()", errors.New("dial tcp: connection refused")),
+			expose: true,
+			want:   Problem{Type: "about:blank", Title: "Internal Server Error", Status: 500, Detail: "dial tcp: connection refused", Instance: "/api/task", Code: "internal"},
+		},
+		{
+			name:     "type base",
+			err:      NewForbidden("not yours"),
+			typeBase: "https://example.com/problems/",
+			want:     Problem{Type: "https://example.com/problems/forbidden", Title: "Forbidden", Status: 403, Detail: "not yours", Instance: "/api/task", Code: "forbidden"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ExposeInternalErrors, ProblemTypeBase = tt.expose, tt.typeBase
+			t.Cleanup(func() { ExposeInternalErrors, ProblemTypeBase = false, "about:blank" })
+
+			got := NewProblem(httptest.NewRequest(http.MethodGet, "/api/task", nil), tt.err)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewProblem() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleError(t *testing.T) {
+	w := httptest.NewRecorder()
+	HandleError(w, httptest.NewRequest(http.MethodGet, "/api/task", nil), Wrap("fn()", NewBadRequest("wrong id")))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/problem+json" {
+		t.Errorf("Content-Type = %s, want application/problem+json", got)
+	}
+	var problem Problem
+	if err := json.NewDecoder(w.Body).Decode(&problem); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if problem.Detail != "wrong id" {
+		t.Errorf("detail = %q, want %q", problem.Detail, "wrong id")
+	}
+}
@@ -0,0 +1,354 @@
+package thelpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/WojciechWiderski/tofu/terror"
+	"github.com/WojciechWiderski/tofu/tlogger"
+)
+
+// DefaultStopTimeout bounds the Stop of a component without its own timeout.
+const DefaultStopTimeout = 10 * time.Second
+
+// Component is a part of the app started and stopped by Lifecycle. Start returns once the component is
+// ready, long running work goes to goroutines which end on Stop.
+type Component interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// ComponentFuncs builds a Component from functions, a nil function does nothing.
+type ComponentFuncs struct {
+	StartFn func(ctx context.Context) error
+	StopFn  func(ctx context.Context) error
+}
+
+func (c ComponentFuncs) Start(ctx context.Context) error {
+	if c.StartFn == nil {
+		return nil
+	}
+	return c.StartFn(ctx)
+}
+
+func (c ComponentFuncs) Stop(ctx context.Context) error {
+	if c.StopFn == nil {
+		return nil
+	}
+	return c.StopFn(ctx)
+}
+
+type State uint8
+
+const (
+	StateNew State = iota
+	StateStarting
+	StateReady
+	StateStopping
+	StateStopped
+	StateFailed
+)
+
+var StateMap = map[State]string{
+	StateNew:      "new",
+	StateStarting: "starting",
+	StateReady:    "ready",
+	StateStopping: "stopping",
+	StateStopped:  "stopped",
+	StateFailed:   "failed",
+}
+
+func (s State) String() string {
+	return StateMap[s]
+}
+
+// Lifecycle starts components level by level, a component starts concurrently with the others whose
+// dependencies are ready, and stops them in reverse order.
+type Lifecycle struct {
+	StopTimeout time.Duration
+
+	mu         sync.RWMutex
+	components []*component
+	byName     map[string]*component
+	failed     chan error
+}
+
+type component struct {
+	Component
+	name        string
+	dependsOn   []string
+	stopTimeout time.Duration
+	state       State
+}
+
+func NewLifecycle() *Lifecycle {
+	return &Lifecycle{
+		StopTimeout: DefaultStopTimeout,
+		byName:      map[string]*component{},
+		failed:      make(chan error, 1),
+	}
+}
+
+type ComponentOption func(*component)
+
+// DependsOn starts the component after the named ones are ready and stops it before them.
+func DependsOn(names ...string) ComponentOption {
+	return func(c *component) {
+		c.dependsOn = append(c.dependsOn, names...)
+	}
+}
+
+// StopTimeout overrides Lifecycle.StopTimeout for the component.
+func StopTimeout(timeout time.Duration) ComponentOption {
+	return func(c *component) {
+		c.stopTimeout = timeout
+	}
+}
+
+func (l *Lifecycle) Add(name string, c Component, opts ...ComponentOption) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.byName[name]; ok {
+		return terror.NewConflict(fmt.Sprintf("component %s already added", name))
+	}
+
+	comp := &component{Component: c, name: name}
+	for _, opt := range opts {
+		opt(comp)
+	}
+	l.components = append(l.components, comp)
+	l.byName[name] = comp
+	return nil
+}
+
+// AddWorker adds a component running fn until Stop cancels its context. An error of fn other than
+// context.Canceled stops the app through Run.
+func (l *Lifecycle) AddWorker(name string, fn func(ctx context.Context) error, opts ...ComponentOption) error {
+	var (
+		cancel context.CancelFunc
+		done   chan struct{}
+	)
+	worker := ComponentFuncs{
+		StartFn: func(context.Context) error {
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			done = make(chan struct{})
+			go func() {
+				defer close(done)
+				if err := fn(ctx); err != nil && !errors.Is(err, context.Canceled) {
+					l.Fail(terror.Wrap(fmt.Sprintf("worker %s", name), err))
+				}
+			}()
+			return nil
+		},
+		StopFn: func(ctx context.Context) error {
+			cancel()
+			select {
+			case <-done:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	}
+	return l.Add(name, worker, opts...)
+}
+
+// Fail makes Run stop the components, the first error is returned by Run.
+func (l *Lifecycle) Fail(err error) {
+	select {
+	case l.failed <- err:
+	default:
+	}
+}
+
+// Run starts the components, waits for ctx, stop or a Fail and stops them.
+func (l *Lifecycle) Run(ctx context.Context, stop <-chan struct{}) error {
+	if err := l.Start(ctx); err != nil {
+		return err
+	}
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+	case <-stop:
+	case runErr = <-l.failed:
+		tlogger.Error(fmt.Sprintf("Lifecycle failed: %v", runErr))
+	}
+	return errors.Join(runErr, l.Stop(context.Background()))
+}
+
+// Start starts every component, on an error it stops the started ones.
+func (l *Lifecycle) Start(ctx context.Context) error {
+	levels, err := l.levels()
+	if err != nil {
+		return err
+	}
+
+	for _, level := range levels {
+		g, gctx := errgroup.WithContext(ctx)
+		for _, c := range level {
+			c := c
+			g.Go(func() error {
+				l.setState(c, StateStarting)
+				if err := c.Start(gctx); err != nil {
+					l.setState(c, StateFailed)
+					return terror.Wrap(fmt.Sprintf("start %s", c.name), err)
+				}
+				l.setState(c, StateReady)
+				tlogger.Info(fmt.Sprintf("Component %s started", c.name))
+				return nil
+			})
+		}
+		if err := g.Wait(); err != nil {
+			return errors.Join(err, l.Stop(context.Background()))
+		}
+	}
+	return nil
+}
+
+// Stop stops the ready components in reverse start order, each bounded by its stop timeout and ctx.
+func (l *Lifecycle) Stop(ctx context.Context) error {
+	levels, err := l.levels()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for i := len(levels) - 1; i >= 0; i-- {
+		var (
+			wg sync.WaitGroup
+			mu sync.Mutex
+		)
+		for _, c := range levels[i] {
+			if l.State(c.name) != StateReady {
+				continue
+			}
+			wg.Add(1)
+			go func(c *component) {
+				defer wg.Done()
+				if err := l.stop(ctx, c); err != nil {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+				}
+			}(c)
+		}
+		wg.Wait()
+	}
+	return errors.Join(errs...)
+}
+
+func (l *Lifecycle) stop(ctx context.Context, c *component) error {
+	timeout := c.stopTimeout
+	if timeout == 0 {
+		timeout = l.StopTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	l.setState(c, StateStopping)
+	if err := c.Stop(ctx); err != nil {
+		l.setState(c, StateFailed)
+		tlogger.Error(fmt.Sprintf("Component %s stop error: %v", c.name, err))
+		return terror.Wrap(fmt.Sprintf("stop %s", c.name), err)
+	}
+	l.setState(c, StateStopped)
+	tlogger.Info(fmt.Sprintf("Component %s stopped", c.name))
+	return nil
+}
+
+// Ready reports whether every component is ready.
+func (l *Lifecycle) Ready() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, c := range l.components {
+		if c.state != StateReady {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *Lifecycle) State(name string) State {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if c, ok := l.byName[name]; ok {
+		return c.state
+	}
+	return StateNew
+}
+
+// Status returns the state of every component by name.
+func (l *Lifecycle) Status() map[string]State {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	status := make(map[string]State, len(l.components))
+	for _, c := range l.components {
+		status[c.name] = c.state
+	}
+	return status
+}
+
+func (l *Lifecycle) setState(c *component, state State) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c.state = state
+}
+
+// levels groups the components by the length of their longest dependency chain, in the order they were
+// added within a level.
+func (l *Lifecycle) levels() ([][]*component, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	depth := map[string]int{}
+	visiting := map[string]bool{}
+	var visit func(c *component) (int, error)
+	visit = func(c *component) (int, error) {
+		if d, ok := depth[c.name]; ok {
+			return d, nil
+		}
+		if visiting[c.name] {
+			return 0, terror.NewInternal(fmt.Sprintf("component %s has a dependency cycle", c.name))
+		}
+		visiting[c.name] = true
+		d := 0
+		for _, name := range c.dependsOn {
+			dep, ok := l.byName[name]
+			if !ok {
+				return 0, terror.NewInternal(fmt.Sprintf("component %s depends on unknown %s", c.name, name))
+			}
+			depDepth, err := visit(dep)
+			if err != nil {
+				return 0, err
+			}
+			if depDepth+1 > d {
+				d = depDepth + 1
+			}
+		}
+		visiting[c.name] = false
+		depth[c.name] = d
+		return d, nil
+	}
+
+	var levels [][]*component
+	for _, c := range l.components {
+		d, err := visit(c)
+		if err != nil {
+			return nil, err
+		}
+		for len(levels) <= d {
+			levels = append(levels, nil)
+		}
+	}
+	for _, c := range l.components {
+		levels[depth[c.name]] = append(levels[depth[c.name]], c)
+	}
+	return levels, nil
+}
@@ -0,0 +1,184 @@
+package thelpers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder records the start and stop order of its components.
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) component(name string, startErr error) Component {
+	return ComponentFuncs{
+		StartFn: func(ctx context.Context) error {
+			r.add("start " + name)
+			return startErr
+		},
+		StopFn: func(ctx context.Context) error {
+			r.add("stop " + name)
+			return nil
+		},
+	}
+}
+
+type testComponent struct {
+	name      string
+	dependsOn []string
+	startErr  error
+}
+
+func TestLifecycle(t *testing.T) {
+	boom := errors.New("boom")
+
+	tests := []struct {
+		name       string
+		components []testComponent
+		wantEvents []string
+		wantErr    string
+		wantStates map[string]State
+	}{
+		{
+			name: "dependencies start first and stop last",
+			components: []testComponent{
+				{name: "http", dependsOn: []string{"db"}},
+				{name: "worker", dependsOn: []string{"http"}},
+				{name: "db"},
+			},
+			wantEvents: []string{"start db", "start http", "start worker", "stop worker", "stop http", "stop db"},
+			wantStates: map[string]State{"db": StateStopped, "http": StateStopped, "worker": StateStopped},
+		},
+		{
+			name: "failed start stops the started components",
+			components: []testComponent{
+				{name: "db"},
+				{name: "http", dependsOn: []string{"db"}, startErr: boom},
+				{name: "worker", dependsOn: []string{"http"}},
+			},
+			wantEvents: []string{"start db", "start http", "stop db"},
+			wantErr:    "start http: boom",
+			wantStates: map[string]State{"db": StateStopped, "http": StateFailed, "worker": StateNew},
+		},
+		{
+			name:       "unknown dependency",
+			components: []testComponent{{name: "http", dependsOn: []string{"db"}}},
+			wantErr:    "depends on unknown db",
+			wantStates: map[string]State{"http": StateNew},
+		},
+		{
+			name: "dependency cycle",
+			components: []testComponent{
+				{name: "a", dependsOn: []string{"b"}},
+				{name: "b", dependsOn: []string{"a"}},
+			},
+			wantErr:    "dependency cycle",
+			wantStates: map[string]State{"a": StateNew, "b": StateNew},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &recorder{}
+			l := NewLifecycle()
+			for _, c := range tt.components {
+				if err := l.Add(c.name, rec.component(c.name, c.startErr), DependsOn(c.dependsOn...)); err != nil {
+					t.Fatalf("Add() error = %v", err)
+				}
+			}
+
+			stop := make(chan struct{})
+			close(stop)
+			err := l.Run(context.Background(), stop)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Run() error = %v, want %q", err, tt.wantErr)
+			}
+			if strings.Join(rec.events, ", ") != strings.Join(tt.wantEvents, ", ") {
+				t.Errorf("events = %v, want %v", rec.events, tt.wantEvents)
+			}
+			for name, want := range tt.wantStates {
+				if got := l.State(name); got != want {
+					t.Errorf("State(%s) = %s, want %s", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLifecycle_AddTwice(t *testing.T) {
+	l := NewLifecycle()
+	if err := l.Add("db", ComponentFuncs{}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := l.Add("db", ComponentFuncs{}); err == nil {
+		t.Errorf("Add() of a duplicated name did not fail")
+	}
+}
+
+func TestLifecycle_Worker(t *testing.T) {
+	boom := errors.New("boom")
+
+	tests := []struct {
+		name    string
+		fn      func(ctx context.Context) error
+		wantErr error
+	}{
+		{name: "failing worker stops the app", fn: func(ctx context.Context) error { return boom }, wantErr: boom},
+		{name: "canceled worker", fn: func(ctx context.Context) error { <-ctx.Done(); return ctx.Err() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLifecycle()
+			if err := l.AddWorker("worker", tt.fn); err != nil {
+				t.Fatalf("AddWorker() error = %v", err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			if err := l.Run(ctx, nil); !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("Run() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := l.State("worker"); got != StateStopped {
+				t.Errorf("State() = %s, want stopped", got)
+			}
+		})
+	}
+}
+
+func TestLifecycle_StopTimeout(t *testing.T) {
+	l := NewLifecycle()
+	hang := ComponentFuncs{StopFn: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+	if err := l.Add("hang", hang, StopTimeout(10*time.Millisecond)); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := l.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if !l.Ready() {
+		t.Errorf("Ready() = false after Start")
+	}
+
+	start := time.Now()
+	if err := l.Stop(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stop() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Stop() took %s", elapsed)
+	}
+	if got := l.State("hang"); got != StateFailed {
+		t.Errorf("State() = %s, want failed", got)
+	}
+}
@@ -0,0 +1,348 @@
+package thttp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/WojciechWiderski/tofu/tcontext"
+	"github.com/WojciechWiderski/tofu/tdatabase"
+	"github.com/WojciechWiderski/tofu/terror"
+	"github.com/WojciechWiderski/tofu/tlogger"
+	"github.com/WojciechWiderski/tofu/tmodel"
+)
+
+const (
+	APIKeyModel  = "api_key"
+	APIKeyHeader = "X-API-Key"
+	// APIKeyPrefix starts every issued key, a key reads tofu_<prefix>_<secret>.
+	APIKeyPrefix = "tofu"
+)
+
+// LastUsedInterval limits the writes of APIKey.LastUsedAt to one per key and interval.
+var LastUsedInterval = time.Minute
+
+// APIKey is the stored form of an API key, the secret is kept as a salted SHA-256 hash and returned only
+// by Issue. Scopes become the roles of the caller checked by tmodel.Model.AllowRoles.
+type APIKey struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix" gorm:"uniqueIndex;size:32"`
+	Salt       string     `json:"-"`
+	Hash       string     `json:"-"`
+	Scopes     []string   `json:"scopes" gorm:"serializer:json;type:text"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Subject identifies the key in the claims and the logs.
+func (k *APIKey) Subject() string {
+	return fmt.Sprintf("api-key:%d", k.ID)
+}
+
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// APIKeys issues and verifies the keys stored in the internal api_key model.
+type APIKeys struct {
+	Model *tmodel.Model
+	// AdminRoles may issue, list and revoke keys through /api/api-keys.
+	AdminRoles []string
+}
+
+// NewAPIKeys adds the api_key model to models, it is migrated with them, or by tofu after the versioned
+// migrations, but gets no generic routes.
+// adminRoles default to admin.
+func NewAPIKeys(models *tmodel.Models, adminRoles ...string) *APIKeys {
+	if len(adminRoles) == 0 {
+		adminRoles = []string{"admin"}
+	}
+	model := models.Get(APIKeyModel)
+	if model == nil {
+		model = tmodel.NewModel(&APIKey{}, APIKeyModel)
+		model.Internal = true
+		models.Set(model)
+	}
+	return &APIKeys{Model: model, AdminRoles: adminRoles}
+}
+
+// WithAPIKeys accepts the keys of keys in the X-API-Key header or as "Authorization: ApiKey <key>" and
+// serves /api/api-keys. Without WithAuth a key is required on every /api route.
+func WithAPIKeys(keys *APIKeys) func(*HttpAPI) {
+	return func(api *HttpAPI) {
+		api.APIKeys = keys
+	}
+}
+
+func (k *APIKeys) store() (tdatabase.DBOperations, error) {
+	if k.Model.Store == nil {
+		return nil, terror.NewInternal("api keys have no database")
+	}
+	return k.Model.Store, nil
+}
+
+// Issue stores a new key and returns it, the key cannot be read again. A zero expiresAt never expires.
+func (k *APIKeys) Issue(ctx context.Context, name string, scopes []string, expiresAt time.Time) (string, *APIKey, error) {
+	store, err := k.store()
+	if err != nil {
+		return "", nil, err
+	}
+
+	prefix, err := randomString(6)
+	if err != nil {
+		return "", nil, terror.Wrap("randomString prefix", err)
+	}
+	secret, err := randomString(32)
+	if err != nil {
+		return "", nil, terror.Wrap("randomString secret", err)
+	}
+	salt, err := randomString(16)
+	if err != nil {
+		return "", nil, terror.Wrap("randomString salt", err)
+	}
+	prefix = strings.NewReplacer("-", "x", "_", "y").Replace(prefix)
+
+	key := &APIKey{
+		Name:   name,
+		Prefix: prefix,
+		Salt:   salt,
+		Hash:   hashAPIKey(salt, secret),
+		Scopes: scopes,
+	}
+	if key.Scopes == nil {
+		key.Scopes = []string{}
+	}
+	if !expiresAt.IsZero() {
+		key.ExpiresAt = &expiresAt
+	}
+	if err := store.Add(ctx, key); err != nil {
+		return "", nil, terror.Wrap("store.Add api key", err)
+	}
+	tlogger.Info(fmt.Sprintf("API key %s issued, id: %d, scopes: %v", name, key.ID, key.Scopes))
+	return fmt.Sprintf("%s_%s_%s", APIKeyPrefix, prefix, secret), key, nil
+}
+
+func (k *APIKeys) List(ctx context.Context, params tdatabase.ParamRequest) ([]*APIKey, error) {
+	store, err := k.store()
+	if err != nil {
+		return nil, err
+	}
+	items, err := store.GetMany(ctx, &APIKey{}, params)
+	if err != nil {
+		return nil, terror.Wrap("store.GetMany api keys", err)
+	}
+	keys := make([]*APIKey, 0, len(items))
+	for _, item := range items {
+		keys = append(keys, item.(*APIKey))
+	}
+	return keys, nil
+}
+
+// Revoke marks the key id as revoked, it is kept for the audit of LastUsedAt.
+func (k *APIKeys) Revoke(ctx context.Context, id int) (*APIKey, error) {
+	store, err := k.store()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	key := &APIKey{}
+	if err := store.Update(ctx, &APIKey{RevokedAt: &now}, key, id); err != nil {
+		return nil, terror.Wrap(fmt.Sprintf("store.Update api key %d", id), err)
+	}
+	tlogger.Info(fmt.Sprintf("API key %s revoked, id: %d", key.Name, key.ID))
+	return key, nil
+}
+
+// Authenticate returns the active key matching raw and records its use, errors are Unauthorized.
+func (k *APIKeys) Authenticate(ctx context.Context, raw string) (*APIKey, error) {
+	store, err := k.store()
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.SplitN(raw, "_", 3)
+	if len(parts) != 3 || parts[0] != APIKeyPrefix || parts[1] == "" || parts[2] == "" {
+		return nil, terror.NewUnauthorized("malformed api key")
+	}
+
+	found, err := store.GetOne(ctx, &APIKey{}, tdatabase.ParamRequest{By: "prefix", Value: parts[1]})
+	if err != nil {
+		if errors.Is(err, terror.NotFound) {
+			return nil, terror.NewUnauthorized("unknown api key")
+		}
+		return nil, terror.Wrap("store.GetOne api key", err)
+	}
+	key := found.(*APIKey)
+	if subtle.ConstantTimeCompare([]byte(hashAPIKey(key.Salt, parts[2])), []byte(key.Hash)) != 1 {
+		return nil, terror.NewUnauthorized("unknown api key")
+	}
+
+	now := time.Now()
+	if !key.Active(now) {
+		return nil, terror.NewUnauthorized("api key expired or revoked")
+	}
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= LastUsedInterval {
+		if err := store.Update(ctx, &APIKey{LastUsedAt: &now}, &APIKey{}, int(key.ID)); err != nil {
+			tlogger.Error(fmt.Sprintf("API key %d last used update error: %v", key.ID, err))
+		}
+		key.LastUsedAt = &now
+	}
+	return key, nil
+}
+
+func hashAPIKey(salt string, secret string) string {
+	sum := sha256.Sum256([]byte(salt + secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", terror.NewInternalf("rand.Read", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// APIKeyMiddleware puts the claims and the scopes of the key in the X-API-Key header or the ApiKey
+// Authorization scheme into the context. A route for which required reports true rejects a request
+// without a key, any route rejects an invalid key.
+func APIKeyMiddleware(keys *APIKeys, required func(r *http.Request) bool) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw, ok := apiKeyFromRequest(r)
+			if !ok {
+				if required(r) {
+					w.Header().Set("WWW-Authenticate", `ApiKey`)
+					terror.HandleError(w, r, terror.NewUnauthorized("missing api key"))
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key, err := keys.Authenticate(r.Context(), raw)
+			if err != nil {
+				if errors.Is(err, terror.Unauthorized) {
+					w.Header().Set("WWW-Authenticate", `ApiKey error="invalid_key"`)
+				}
+				terror.HandleError(w, r, err)
+				return
+			}
+			claims := tcontext.Claims{"sub": key.Subject(), "name": key.Name, "scope": key.Scopes}
+			ctx := tcontext.ContextWithClaims(r.Context(), claims)
+			ctx = tcontext.ContextWithRoles(ctx, key.Scopes)
+			ctx = tlogger.ContextWith(ctx, slog.String(tlogger.KeyUser, key.Subject()))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func apiKeyFromRequest(r *http.Request) (string, bool) {
+	if key := strings.TrimSpace(r.Header.Get(APIKeyHeader)); key != "" {
+		return key, true
+	}
+	scheme, key, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "ApiKey") || strings.TrimSpace(key) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(key), true
+}
+
+type issueAPIKeyRequest struct {
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type issueAPIKeyResponse struct {
+	Key    string  `json:"key"`
+	APIKey *APIKey `json:"api_key"`
+}
+
+// authorizeAPIKeys lets the admin roles of keys manage them.
+func (a *HttpAPI) authorizeAPIKeys(ctx context.Context) error {
+	roles, ok := tcontext.RolesFromCtx(ctx)
+	if !ok {
+		return terror.NewUnauthorized("api keys need authentication")
+	}
+	for _, role := range roles {
+		for _, admin := range a.APIKeys.AdminRoles {
+			if role == admin {
+				return nil
+			}
+		}
+	}
+	return terror.NewForbidden(fmt.Sprintf("api keys need one of the roles %v", a.APIKeys.AdminRoles))
+}
+
+func (a *HttpAPI) HandlerIssueAPIKey(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	if err := a.authorizeAPIKeys(r.Context()); err != nil {
+		return nil, terror.Wrap("a.authorizeAPIKeys", err)
+	}
+	var req issueAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, terror.Newf(terror.BadRequest, "json.Decode", err)
+	}
+	var fields []terror.FieldError
+	if strings.TrimSpace(req.Name) == "" {
+		fields = append(fields, terror.FieldError{Field: "name", Rule: "required", Message: "name is required"})
+	}
+	if !req.ExpiresAt.IsZero() && req.ExpiresAt.Before(time.Now()) {
+		fields = append(fields, terror.FieldError{Field: "expires_at", Rule: "future", Message: "expires_at must be in the future"})
+	}
+	if len(fields) > 0 {
+		return nil, terror.NewValidation(fields)
+	}
+
+	key, apiKey, err := a.APIKeys.Issue(r.Context(), req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		return nil, terror.Wrap("a.APIKeys.Issue", err)
+	}
+	return issueAPIKeyResponse{Key: key, APIKey: apiKey}, nil
+}
+
+func (a *HttpAPI) HandlerListAPIKeys(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	if err := a.authorizeAPIKeys(r.Context()); err != nil {
+		return nil, terror.Wrap("a.authorizeAPIKeys", err)
+	}
+	params, err := paramsFromQuery(r.URL.Query())
+	if err != nil {
+		return nil, terror.Wrap("paramsFromQuery", err)
+	}
+	keys, err := a.APIKeys.List(r.Context(), params)
+	if err != nil {
+		return nil, terror.Wrap("a.APIKeys.List", err)
+	}
+	return keys, nil
+}
+
+func (a *HttpAPI) HandlerRevokeAPIKey(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	if err := a.authorizeAPIKeys(r.Context()); err != nil {
+		return nil, terror.Wrap("a.authorizeAPIKeys", err)
+	}
+	keyID, err := strconv.Atoi(chi.URLParam(r, id))
+	if err != nil {
+		return nil, terror.Newf(terror.BadRequest, "strconv.Atoi", err)
+	}
+	key, err := a.APIKeys.Revoke(r.Context(), keyID)
+	if err != nil {
+		return nil, terror.Wrap("a.APIKeys.Revoke", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,139 @@
+package thttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WojciechWiderski/tofu/tdatabase/memory"
+	"github.com/WojciechWiderski/tofu/terror"
+	"github.com/WojciechWiderski/tofu/tmodel"
+)
+
+func newAPIKeys(t *testing.T) *APIKeys {
+	t.Helper()
+	models := tmodel.NewModels()
+	keys := NewAPIKeys(models)
+	db := memory.New(models)
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	keys.Model.Store = db
+	return keys
+}
+
+func TestAPIKeys_Authenticate(t *testing.T) {
+	ctx := context.Background()
+	keys := newAPIKeys(t)
+	issue := func(expiresAt time.Time) (string, *APIKey) {
+		raw, key, err := keys.Issue(ctx, "ci", []string{"reader"}, expiresAt)
+		if err != nil {
+			t.Fatalf("Issue() error = %v", err)
+		}
+		return raw, key
+	}
+
+	valid, stored := issue(time.Time{})
+	expired, _ := issue(time.Now().Add(-time.Minute))
+	revoked, revokedKey := issue(time.Time{})
+	if _, err := keys.Revoke(ctx, int(revokedKey.ID)); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	if strings.Contains(valid, stored.Hash) || stored.Hash == "" || stored.Salt == "" {
+		t.Fatalf("stored key = %+v, want a salted hash", stored)
+	}
+	parts := strings.SplitN(valid, "_", 3)
+
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr error
+	}{
+		{name: "valid", raw: valid},
+		{name: "malformed", raw: "not-a-key", wantErr: terror.Unauthorized},
+		{name: "other prefix", raw: "other_" + parts[1] + "_" + parts[2], wantErr: terror.Unauthorized},
+		{name: "unknown prefix", raw: APIKeyPrefix + "_unknown_" + parts[2], wantErr: terror.Unauthorized},
+		{name: "wrong secret", raw: APIKeyPrefix + "_" + parts[1] + "_wrong", wantErr: terror.Unauthorized},
+		{name: "expired", raw: expired, wantErr: terror.Unauthorized},
+		{name: "revoked", raw: revoked, wantErr: terror.Unauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := keys.Authenticate(ctx, tt.raw)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (key.ID != stored.ID || key.LastUsedAt == nil) {
+				t.Errorf("Authenticate() = %+v, want key %d with LastUsedAt", key, stored.ID)
+			}
+		})
+	}
+}
+
+func TestAPIKeyEndpoints(t *testing.T) {
+	models := tmodel.NewModels(tmodel.NewModel(&record{}, "record").AllowRoles(tmodel.RouteAddOne, "writer"))
+	keys := NewAPIKeys(models)
+	srv := newTestServer(t, models, WithAPIKeys(keys))
+	admin, _, err := keys.Issue(context.Background(), "admin", []string{"admin"}, time.Time{})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+
+	resp, body := doHeader(t, srv, http.MethodPost, "/api/api-keys/", `{"name":"reader","scopes":["reader"]}`, APIKeyHeader, admin)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("issue = %d %s", resp.StatusCode, body)
+	}
+	var issued issueAPIKeyResponse
+	if err := json.Unmarshal([]byte(body), &issued); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	reader := issued.Key
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		key        string
+		scheme     bool
+		wantStatus int
+		wantBody   string
+		notBody    string
+	}{
+		{name: "missing key", method: http.MethodGet, path: "/api/record/get-many/", wantStatus: http.StatusUnauthorized},
+		{name: "invalid key", method: http.MethodGet, path: "/api/record/get-many/", key: APIKeyPrefix + "_x_y", wantStatus: http.StatusUnauthorized},
+		{name: "header", method: http.MethodGet, path: "/api/record/get-many/", key: reader, wantStatus: http.StatusOK},
+		{name: "authorization scheme", method: http.MethodGet, path: "/api/record/get-many/", key: reader, scheme: true, wantStatus: http.StatusOK},
+		{name: "scope without role", method: http.MethodPost, path: "/api/record/add-one/", body: `{"name":"a","max":1}`, key: reader, wantStatus: http.StatusForbidden},
+		{name: "list", method: http.MethodGet, path: "/api/api-keys/", key: admin, wantStatus: http.StatusOK, wantBody: `"name":"reader"`, notBody: `"hash"`},
+		{name: "list without admin", method: http.MethodGet, path: "/api/api-keys/", key: reader, wantStatus: http.StatusForbidden},
+		{name: "issue without name", method: http.MethodPost, path: "/api/api-keys/", body: `{"scopes":["reader"]}`, key: admin, wantStatus: http.StatusUnprocessableEntity, wantBody: `"field":"name"`},
+		{name: "issue expired", method: http.MethodPost, path: "/api/api-keys/", body: `{"name":"old","expires_at":"2000-01-01T00:00:00Z"}`, key: admin, wantStatus: http.StatusUnprocessableEntity, wantBody: `"field":"expires_at"`},
+		{name: "revoke unknown", method: http.MethodDelete, path: "/api/api-keys/99", key: admin, wantStatus: http.StatusNotFound},
+		{name: "revoke", method: http.MethodDelete, path: "/api/api-keys/" + strconv.Itoa(int(issued.APIKey.ID)), key: admin, wantStatus: http.StatusOK, wantBody: `"revoked_at"`},
+		{name: "revoked key", method: http.MethodGet, path: "/api/record/get-many/", key: reader, wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, value := APIKeyHeader, tt.key
+			if tt.scheme {
+				header, value = "Authorization", "ApiKey "+tt.key
+			}
+			resp, body := doHeader(t, srv, tt.method, tt.path, tt.body, header, value)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", resp.StatusCode, tt.wantStatus, body)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", body, tt.wantBody)
+			}
+			if tt.notBody != "" && strings.Contains(body, tt.notBody) {
+				t.Errorf("body = %s, want it without %s", body, tt.notBody)
+			}
+		})
+	}
+}
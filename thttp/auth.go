@@ -0,0 +1,273 @@
+package thttp
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/WojciechWiderski/tofu/tconfig"
+	"github.com/WojciechWiderski/tofu/tcontext"
+	"github.com/WojciechWiderski/tofu/terror"
+	"github.com/WojciechWiderski/tofu/tlogger"
+	"github.com/WojciechWiderski/tofu/tmodel"
+)
+
+// Authenticator verifies bearer JWTs signed with HS256, RS256 or EdDSA.
+type Authenticator struct {
+	secret    []byte
+	publicKey interface{}
+	jwks      *jwks
+	parser    *jwt.Parser
+	// RolesClaim names the claim with the roles checked by tmodel.Model.AllowRoles.
+	RolesClaim string
+}
+
+func NewAuthenticator(config tconfig.Auth) (*Authenticator, error) {
+	auth := &Authenticator{RolesClaim: config.RolesClaim}
+	if auth.RolesClaim == "" {
+		auth.RolesClaim = "roles"
+	}
+	if config.Secret != "" {
+		auth.secret = []byte(config.Secret)
+	}
+	if config.PublicKeyFile != "" {
+		key, err := readPublicKey(config.PublicKeyFile)
+		if err != nil {
+			return nil, terror.Wrap("readPublicKey", err)
+		}
+		auth.publicKey = key
+	}
+	if config.JWKS != "" {
+		auth.jwks = newJWKS(config.JWKS, config.JWKSRefresh)
+	}
+	if auth.secret == nil && auth.publicKey == nil && auth.jwks == nil {
+		return nil, terror.NewBadRequest("auth needs a secret, a public key file or a jwks")
+	}
+
+	algorithms := config.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = []string{"HS256", "RS256", "EdDSA"}
+	}
+	for _, alg := range algorithms {
+		if alg != "HS256" && alg != "RS256" && alg != "EdDSA" {
+			return nil, terror.NewBadRequest(fmt.Sprintf("unsupported algorithm %s", alg))
+		}
+	}
+
+	opts := []jwt.ParserOption{jwt.WithValidMethods(algorithms), jwt.WithLeeway(config.Leeway), jwt.WithExpirationRequired()}
+	if config.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(config.Issuer))
+	}
+	if config.Audience != "" {
+		opts = append(opts, jwt.WithAudience(config.Audience))
+	}
+	auth.parser = jwt.NewParser(opts...)
+	return auth, nil
+}
+
+// Authenticate verifies token and returns its claims, errors are Unauthorized.
+func (a *Authenticator) Authenticate(ctx context.Context, token string) (tcontext.Claims, error) {
+	claims := jwt.MapClaims{}
+	_, err := a.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		return a.key(ctx, t)
+	})
+	if err != nil {
+		var betterError terror.BetterError
+		if errors.As(err, &betterError) && !errors.Is(err, terror.Unauthorized) {
+			return nil, terror.Wrap("a.parser.ParseWithClaims", err)
+		}
+		return nil, terror.Newf(terror.Unauthorized, "invalid token", err)
+	}
+	return tcontext.Claims(claims), nil
+}
+
+func (a *Authenticator) key(ctx context.Context, t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	if a.jwks != nil && kid != "" {
+		key, err := a.jwks.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		return keyForMethod(t.Method, key)
+	}
+
+	switch t.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if a.secret != nil {
+			return a.secret, nil
+		}
+	default:
+		if a.publicKey != nil {
+			return keyForMethod(t.Method, a.publicKey)
+		}
+	}
+	return nil, terror.NewUnauthorized(fmt.Sprintf("no key for %s", t.Method.Alg()))
+}
+
+// keyForMethod rejects a key of another type than the signing method, e.g. an RSA key for HS256.
+func keyForMethod(method jwt.SigningMethod, key interface{}) (interface{}, error) {
+	ok := false
+	switch method.(type) {
+	case *jwt.SigningMethodHMAC:
+		_, ok = key.([]byte)
+	case *jwt.SigningMethodRSA:
+		_, ok = key.(*rsa.PublicKey)
+	case *jwt.SigningMethodEd25519:
+		_, ok = key.(ed25519.PublicKey)
+	}
+	if !ok {
+		return nil, terror.NewUnauthorized(fmt.Sprintf("key does not match %s", method.Alg()))
+	}
+	return key, nil
+}
+
+func readPublicKey(path string) (interface{}, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, terror.NewInternalf("os.ReadFile", err)
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, terror.NewBadRequest("no PEM block in " + path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, terror.Newf(terror.BadRequest, "x509.ParsePKIXPublicKey", err)
+	}
+	switch key.(type) {
+	case *rsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	}
+	return nil, terror.NewBadRequest(fmt.Sprintf("unsupported public key %T", key))
+}
+
+// AuthScope protects the routes of a model, all of them without route types.
+type AuthScope struct {
+	Model      string
+	RouteTypes []tmodel.RouteType
+}
+
+func AuthModel(model string, routeTypes ...tmodel.RouteType) AuthScope {
+	return AuthScope{Model: model, RouteTypes: routeTypes}
+}
+
+// Auth decides which routes need a token, every /api route without scopes.
+type Auth struct {
+	Authenticator *Authenticator
+	Scopes        []AuthScope
+}
+
+// WithAuth requires a valid bearer token on the routes of scopes, or on every /api route without them.
+func WithAuth(authenticator *Authenticator, scopes ...AuthScope) func(*HttpAPI) {
+	return func(api *HttpAPI) {
+		api.Auth = &Auth{Authenticator: authenticator, Scopes: scopes}
+	}
+}
+
+func (a *Auth) Global() bool {
+	return len(a.Scopes) == 0
+}
+
+// Required reports whether the route type of model needs a token.
+func (a *Auth) Required(model string, routeType tmodel.RouteType) bool {
+	if a.Global() {
+		return true
+	}
+	for _, scope := range a.Scopes {
+		if scope.Model != model {
+			continue
+		}
+		if len(scope.RouteTypes) == 0 {
+			return true
+		}
+		for _, rt := range scope.RouteTypes {
+			if rt == routeType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AuthMiddleware puts the claims of the bearer token into the context. A route for which required
+// reports true rejects a request without a token, any route rejects an invalid token.
+func AuthMiddleware(authenticator *Authenticator, required func(r *http.Request) bool) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if !ok {
+				if required(r) {
+					w.Header().Set("WWW-Authenticate", `Bearer`)
+					terror.HandleError(w, r, terror.NewUnauthorized("missing bearer token"))
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			claims, err := authenticator.Authenticate(r.Context(), token)
+			if err != nil {
+				if errors.Is(err, terror.Unauthorized) {
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				}
+				terror.HandleError(w, r, err)
+				return
+			}
+			ctx := tcontext.ContextWithClaims(r.Context(), claims)
+			ctx = tcontext.ContextWithRoles(ctx, claims.Strings(authenticator.RolesClaim))
+			ctx = tlogger.ContextWith(ctx, slog.String(tlogger.KeyUser, claims.Subject()))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// authMiddleware accepts an API key first and a bearer token otherwise, without WithAuth every route
+// needs a key.
+func (a *HttpAPI) authMiddleware() func(next http.Handler) http.Handler {
+	if a.Auth == nil && a.APIKeys == nil {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	required := func(r *http.Request) bool {
+		if a.Auth == nil {
+			return true
+		}
+		model := tcontext.ModelFromCtx(r.Context())
+		if model == nil {
+			return a.Auth.Global()
+		}
+		return a.Auth.Required(model.Name, tcontext.RouteTypeFromCtx(r.Context()))
+	}
+	return func(next http.Handler) http.Handler {
+		if a.Auth != nil {
+			next = AuthMiddleware(a.Auth.Authenticator, func(r *http.Request) bool {
+				return tcontext.ClaimsFromCtx(r.Context()) == nil && required(r)
+			})(next)
+		}
+		if a.APIKeys != nil {
+			keyRequired := required
+			if a.Auth != nil {
+				keyRequired = func(*http.Request) bool { return false }
+			}
+			next = APIKeyMiddleware(a.APIKeys, keyRequired)(next)
+		}
+		return next
+	}
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
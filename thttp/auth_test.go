@@ -0,0 +1,319 @@
+package thttp
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/WojciechWiderski/tofu/tconfig"
+	"github.com/WojciechWiderski/tofu/terror"
+	"github.com/WojciechWiderski/tofu/tmodel"
+)
+
+const testSecret = "test-secret"
+
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatalf("SignedString() error = %v", err)
+	}
+	return token
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix(), "roles": []string{"admin"}}
+}
+
+// writePublicKey writes pub as a PEM file and returns its path.
+func writePublicKey(t *testing.T, pub ed25519.PublicKey) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatalf("x509.MarshalPKIXPublicKey() error = %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("os.WriteFile() error = %v", err)
+	}
+	return path
+}
+
+func TestNewAuthenticator(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  tconfig.Auth
+		wantErr bool
+	}{
+		{name: "secret", config: tconfig.Auth{Secret: testSecret}},
+		{name: "jwks", config: tconfig.Auth{JWKS: "https://example.com/jwks.json"}},
+		{name: "no key", config: tconfig.Auth{}, wantErr: true},
+		{name: "missing public key file", config: tconfig.Auth{PublicKeyFile: filepath.Join(t.TempDir(), "none.pem")}, wantErr: true},
+		{name: "unsupported algorithm", config: tconfig.Auth{Secret: testSecret, Algorithms: []string{"ES256"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, err := NewAuthenticator(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewAuthenticator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && auth.RolesClaim != "roles" {
+				t.Errorf("RolesClaim = %q, want roles", auth.RolesClaim)
+			}
+		})
+	}
+}
+
+func TestAuthenticator_Authenticate(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey() error = %v", err)
+	}
+	_, otherPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey() error = %v", err)
+	}
+	keyFile := writePublicKey(t, pub)
+
+	expired := validClaims()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	noExp := validClaims()
+	delete(noExp, "exp")
+	issued := validClaims()
+	issued["iss"] = "tofu"
+	issued["aud"] = "api"
+
+	tests := []struct {
+		name    string
+		config  tconfig.Auth
+		token   string
+		wantSub string
+		wantErr error
+	}{
+		{
+			name:    "HS256",
+			config:  tconfig.Auth{Secret: testSecret},
+			token:   sign(t, jwt.SigningMethodHS256, []byte(testSecret), validClaims()),
+			wantSub: "user-1",
+		},
+		{
+			name:    "EdDSA public key file",
+			config:  tconfig.Auth{PublicKeyFile: keyFile},
+			token:   sign(t, jwt.SigningMethodEdDSA, priv, validClaims()),
+			wantSub: "user-1",
+		},
+		{
+			name:    "issuer and audience",
+			config:  tconfig.Auth{Secret: testSecret, Issuer: "tofu", Audience: "api"},
+			token:   sign(t, jwt.SigningMethodHS256, []byte(testSecret), issued),
+			wantSub: "user-1",
+		},
+		{
+			name:    "wrong secret",
+			config:  tconfig.Auth{Secret: testSecret},
+			token:   sign(t, jwt.SigningMethodHS256, []byte("other"), validClaims()),
+			wantErr: terror.Unauthorized,
+		},
+		{
+			name:    "wrong key",
+			config:  tconfig.Auth{PublicKeyFile: keyFile},
+			token:   sign(t, jwt.SigningMethodEdDSA, otherPriv, validClaims()),
+			wantErr: terror.Unauthorized,
+		},
+		{
+			name:    "expired",
+			config:  tconfig.Auth{Secret: testSecret},
+			token:   sign(t, jwt.SigningMethodHS256, []byte(testSecret), expired),
+			wantErr: terror.Unauthorized,
+		},
+		{
+			name:    "expired within leeway",
+			config:  tconfig.Auth{Secret: testSecret, Leeway: 2 * time.Hour},
+			token:   sign(t, jwt.SigningMethodHS256, []byte(testSecret), expired),
+			wantSub: "user-1",
+		},
+		{
+			name:    "no expiry",
+			config:  tconfig.Auth{Secret: testSecret},
+			token:   sign(t, jwt.SigningMethodHS256, []byte(testSecret), noExp),
+			wantErr: terror.Unauthorized,
+		},
+		{
+			name:    "wrong issuer",
+			config:  tconfig.Auth{Secret: testSecret, Issuer: "other"},
+			token:   sign(t, jwt.SigningMethodHS256, []byte(testSecret), issued),
+			wantErr: terror.Unauthorized,
+		},
+		{
+			name:    "algorithm not allowed",
+			config:  tconfig.Auth{Secret: testSecret, PublicKeyFile: keyFile, Algorithms: []string{"HS256"}},
+			token:   sign(t, jwt.SigningMethodEdDSA, priv, validClaims()),
+			wantErr: terror.Unauthorized,
+		},
+		{
+			name:    "no key for algorithm",
+			config:  tconfig.Auth{Secret: testSecret},
+			token:   sign(t, jwt.SigningMethodEdDSA, priv, validClaims()),
+			wantErr: terror.Unauthorized,
+		},
+		{
+			name:    "none",
+			config:  tconfig.Auth{Secret: testSecret},
+			token:   sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, validClaims()),
+			wantErr: terror.Unauthorized,
+		},
+		{
+			name:    "malformed",
+			config:  tconfig.Auth{Secret: testSecret},
+			token:   "not.a.token",
+			wantErr: terror.Unauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, err := NewAuthenticator(tt.config)
+			if err != nil {
+				t.Fatalf("NewAuthenticator() error = %v", err)
+			}
+			claims, err := auth.Authenticate(context.Background(), tt.token)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && claims.Subject() != tt.wantSub {
+				t.Errorf("Subject() = %q, want %q", claims.Subject(), tt.wantSub)
+			}
+		})
+	}
+}
+
+func TestAuth_Required(t *testing.T) {
+	tests := []struct {
+		name      string
+		scopes    []AuthScope
+		model     string
+		routeType tmodel.RouteType
+		want      bool
+	}{
+		{name: "global", model: "record", routeType: tmodel.RouteGetMany, want: true},
+		{name: "model scope", scopes: []AuthScope{AuthModel("record")}, model: "record", routeType: tmodel.RouteGetMany, want: true},
+		{name: "other model", scopes: []AuthScope{AuthModel("user")}, model: "record", routeType: tmodel.RouteGetMany, want: false},
+		{name: "route scope", scopes: []AuthScope{AuthModel("record", tmodel.RouteAddOne)}, model: "record", routeType: tmodel.RouteAddOne, want: true},
+		{name: "other route", scopes: []AuthScope{AuthModel("record", tmodel.RouteAddOne)}, model: "record", routeType: tmodel.RouteGetMany, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := &Auth{Scopes: tt.scopes}
+			if got := auth.Required(tt.model, tt.routeType); got != tt.want {
+				t.Errorf("Required() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// doAuth sends a request with the Authorization header set to authorization unless it is empty.
+func doAuth(t *testing.T, srv *httptest.Server, method string, path string, body string, authorization string) (*http.Response, string) {
+	t.Helper()
+	return doHeader(t, srv, method, path, body, "Authorization", authorization)
+}
+
+// doHeader sends a request with header set to value unless it is empty.
+func doHeader(t *testing.T, srv *httptest.Server, method string, path string, body string, header string, value string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("http.NewRequest() error = %v", err)
+	}
+	if value != "" {
+		req.Header.Set(header, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("http.Do() error = %v", err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp, strings.TrimSpace(string(b))
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	auth, err := NewAuthenticator(tconfig.Auth{Secret: testSecret})
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v", err)
+	}
+	valid := "Bearer " + sign(t, jwt.SigningMethodHS256, []byte(testSecret), validClaims())
+	invalid := "Bearer " + sign(t, jwt.SigningMethodHS256, []byte("other"), validClaims())
+
+	tests := []struct {
+		name          string
+		scopes        []AuthScope
+		method        string
+		path          string
+		authorization string
+		wantStatus    int
+		wantChallenge string
+	}{
+		{name: "global valid", method: http.MethodGet, path: "/api/record/get-many/", authorization: valid, wantStatus: http.StatusOK},
+		{name: "global missing", method: http.MethodGet, path: "/api/record/get-many/", wantStatus: http.StatusUnauthorized, wantChallenge: "Bearer"},
+		{name: "global invalid", method: http.MethodGet, path: "/api/record/get-many/", authorization: invalid, wantStatus: http.StatusUnauthorized, wantChallenge: `Bearer error="invalid_token"`},
+		{name: "not bearer", method: http.MethodGet, path: "/api/record/get-many/", authorization: "Basic dXNlcjpwYXNz", wantStatus: http.StatusUnauthorized, wantChallenge: "Bearer"},
+		{name: "healthz is public", method: http.MethodGet, path: "/healthz", wantStatus: http.StatusOK},
+		{
+			name:       "scoped route missing",
+			scopes:     []AuthScope{AuthModel("record", tmodel.RouteAddOne)},
+			method:     http.MethodPost,
+			path:       "/api/record/add-one/",
+			wantStatus: http.StatusUnauthorized, wantChallenge: "Bearer",
+		},
+		{
+			name:          "scoped route valid",
+			scopes:        []AuthScope{AuthModel("record", tmodel.RouteAddOne)},
+			method:        http.MethodPost,
+			path:          "/api/record/add-one/",
+			authorization: valid,
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:       "unscoped route missing",
+			scopes:     []AuthScope{AuthModel("record", tmodel.RouteAddOne)},
+			method:     http.MethodGet,
+			path:       "/api/record/get-many/",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "unscoped route invalid",
+			scopes:        []AuthScope{AuthModel("record", tmodel.RouteAddOne)},
+			method:        http.MethodGet,
+			path:          "/api/record/get-many/",
+			authorization: invalid,
+			wantStatus:    http.StatusUnauthorized, wantChallenge: `Bearer error="invalid_token"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, tmodel.NewModels(tmodel.NewModel(&record{}, "record")), WithAuth(auth, tt.scopes...))
+			body := ""
+			if tt.method == http.MethodPost {
+				body = `{"name":"a","max":10}`
+			}
+			resp, got := doAuth(t, srv, tt.method, tt.path, body, tt.authorization)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", resp.StatusCode, tt.wantStatus, got)
+			}
+			if challenge := resp.Header.Get("WWW-Authenticate"); challenge != tt.wantChallenge {
+				t.Errorf("WWW-Authenticate = %q, want %q", challenge, tt.wantChallenge)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package thttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/WojciechWiderski/tofu/tcontext"
+	"github.com/WojciechWiderski/tofu/tdatabase"
+	"github.com/WojciechWiderski/tofu/terror"
+	"github.com/WojciechWiderski/tofu/tmodel"
+)
+
+// authorizeRoles rejects a caller without one of the roles the model allows on routeType, an
+// unauthenticated caller is Unauthorized and an authenticated one Forbidden.
+func authorizeRoles(ctx context.Context, model *tmodel.Model, routeType tmodel.RouteType) error {
+	allowed := model.RolesFor(routeType)
+	if len(allowed) == 0 {
+		return nil
+	}
+
+	roles, ok := tcontext.RolesFromCtx(ctx)
+	if !ok {
+		return terror.NewUnauthorized(fmt.Sprintf("%s on %s needs authentication", routeType, model.Name))
+	}
+	for _, role := range roles {
+		for _, allow := range allowed {
+			if role == allow {
+				return nil
+			}
+		}
+	}
+	return terror.NewForbidden(fmt.Sprintf("%s on %s needs one of the roles %v", routeType, model.Name, allowed))
+}
+
+// authorizeRecord runs the row level authorizer of the model, see tmodel.Authorizer for record.
+func authorizeRecord(ctx context.Context, model *tmodel.Model, routeType tmodel.RouteType, record interface{}) error {
+	if model.Authorizer == nil {
+		return nil
+	}
+	err := model.Authorizer.Authorize(ctx, routeType, record)
+	if err == nil {
+		return nil
+	}
+	var betterError terror.BetterError
+	if !errors.As(err, &betterError) {
+		return terror.Newf(terror.Forbidden, "authorizer", err)
+	}
+	return err
+}
+
+// authorizeStored loads the record id of the model and runs the authorizer on it.
+func authorizeStored(ctx context.Context, model *tmodel.Model, routeType tmodel.RouteType, id interface{}) error {
+	if model.Authorizer == nil {
+		return nil
+	}
+	record, err := model.Store.GetOne(ctx, model.NewIn(), tdatabase.ParamRequest{By: "id", Value: id})
+	if err != nil {
+		return terror.Wrap(fmt.Sprintf("model.Store.GetOne model - %v id - %v.", model.Name, id), err)
+	}
+	return authorizeRecord(ctx, model, routeType, record)
+}
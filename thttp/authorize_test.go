@@ -0,0 +1,203 @@
+package thttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/WojciechWiderski/tofu/tconfig"
+	"github.com/WojciechWiderski/tofu/tcontext"
+	"github.com/WojciechWiderski/tofu/terror"
+	"github.com/WojciechWiderski/tofu/tmodel"
+)
+
+func TestAuthorizeRoles(t *testing.T) {
+	model := tmodel.NewModel(&record{}, "record").
+		AllowRoles(tmodel.RouteAll, "admin").
+		AllowRoles(tmodel.RouteGetMany, "reader", "admin")
+
+	tests := []struct {
+		name      string
+		routeType tmodel.RouteType
+		roles     []string
+		anonymous bool
+		wantErr   error
+	}{
+		{name: "route roles", routeType: tmodel.RouteGetMany, roles: []string{"reader"}},
+		{name: "fallback to all", routeType: tmodel.RouteAddOne, roles: []string{"admin"}},
+		{name: "fallback to all without role", routeType: tmodel.RouteAddOne, roles: []string{"reader"}, wantErr: terror.Forbidden},
+		{name: "no roles", routeType: tmodel.RouteGetMany, roles: nil, wantErr: terror.Forbidden},
+		{name: "anonymous", routeType: tmodel.RouteGetMany, anonymous: true, wantErr: terror.Unauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if !tt.anonymous {
+				ctx = tcontext.ContextWithRoles(ctx, tt.roles)
+			}
+			err := authorizeRoles(ctx, model, tt.routeType)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Errorf("authorizeRoles() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := authorizeRoles(context.Background(), tmodel.NewModel(&record{}, "open"), tmodel.RouteGetMany); err != nil {
+		t.Errorf("authorizeRoles() without roles error = %v", err)
+	}
+}
+
+func TestAuthorizeRecord(t *testing.T) {
+	tests := []struct {
+		name       string
+		authorizer tmodel.AuthorizerFunc
+		wantErr    error
+	}{
+		{name: "no authorizer"},
+		{name: "allowed", authorizer: func(context.Context, tmodel.RouteType, interface{}) error { return nil }},
+		{name: "plain error is forbidden", authorizer: func(context.Context, tmodel.RouteType, interface{}) error { return errors.New("no") }, wantErr: terror.Forbidden},
+		{name: "kind kept", authorizer: func(context.Context, tmodel.RouteType, interface{}) error { return terror.NewNotFound("hidden") }, wantErr: terror.NotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := tmodel.NewModel(&record{}, "record")
+			if tt.authorizer != nil {
+				model.SetAuthorizer(tt.authorizer)
+			}
+			err := authorizeRecord(context.Background(), model, tmodel.RouteGetOne, &record{})
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Errorf("authorizeRecord() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	auth, err := NewAuthenticator(tconfig.Auth{Secret: testSecret})
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v", err)
+	}
+	bearer := func(roles ...string) string {
+		claims := validClaims()
+		claims["roles"] = roles
+		return "Bearer " + sign(t, jwt.SigningMethodHS256, []byte(testSecret), claims)
+	}
+
+	// Records named "secret" are only visible to admins and nobody removes "kept".
+	model := tmodel.NewModel(&record{}, "record").
+		AllowRoles(tmodel.RouteAll, "editor", "admin").
+		AllowRoles(tmodel.RouteGetOne, "reader", "editor", "admin").
+		SetAuthorizer(tmodel.AuthorizerFunc(func(ctx context.Context, routeType tmodel.RouteType, in interface{}) error {
+			rec, _ := in.(*record)
+			roles, _ := tcontext.RolesFromCtx(ctx)
+			switch {
+			case rec != nil && rec.Name == "secret" && !(len(roles) == 1 && roles[0] == "admin"):
+				return terror.NewForbidden("secret record")
+			case rec != nil && rec.Name == "kept" && routeType == tmodel.RouteDeleteOne:
+				return errors.New("kept record")
+			}
+			return nil
+		}))
+	srv := newTestServer(t, tmodel.NewModels(model), WithAuth(auth))
+	for _, name := range []string{"public", "secret", "kept"} {
+		if resp, body := doAuth(t, srv, http.MethodPost, "/api/record/add-one/", `{"name":"`+name+`","max":10}`, bearer("admin")); resp.StatusCode != http.StatusOK {
+			t.Fatalf("add-one %s = %d %s", name, resp.StatusCode, body)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		roles      []string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "reader gets public", method: http.MethodGet, path: "/api/record/get-one/1", roles: []string{"reader"}, wantStatus: http.StatusOK, wantBody: `"name":"public"`},
+		{name: "reader gets secret", method: http.MethodGet, path: "/api/record/get-one/2", roles: []string{"reader"}, wantStatus: http.StatusForbidden, wantBody: "secret record"},
+		{name: "admin gets secret", method: http.MethodGet, path: "/api/record/get-one/2", roles: []string{"admin"}, wantStatus: http.StatusOK, wantBody: `"name":"secret"`},
+		{name: "reader lists", method: http.MethodGet, path: "/api/record/get-many/", roles: []string{"reader"}, wantStatus: http.StatusForbidden},
+		{name: "no roles", method: http.MethodGet, path: "/api/record/get-one/1", wantStatus: http.StatusForbidden},
+		{name: "editor adds", method: http.MethodPost, path: "/api/record/add-one/", body: `{"name":"new","max":10}`, roles: []string{"editor"}, wantStatus: http.StatusOK},
+		{name: "editor adds secret", method: http.MethodPost, path: "/api/record/add-one/", body: `{"name":"secret","max":10}`, roles: []string{"editor"}, wantStatus: http.StatusForbidden},
+		{name: "editor updates secret", method: http.MethodPut, path: "/api/record/update/2", body: `{"min":1}`, roles: []string{"editor"}, wantStatus: http.StatusForbidden},
+		{name: "editor deletes kept", method: http.MethodDelete, path: "/api/record/delete-one/3", roles: []string{"editor"}, wantStatus: http.StatusForbidden, wantBody: "kept record"},
+		{name: "editor deletes public", method: http.MethodDelete, path: "/api/record/delete-one/1", roles: []string{"editor"}, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := doAuth(t, srv, tt.method, tt.path, tt.body, bearer(tt.roles...))
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", resp.StatusCode, tt.wantStatus, body)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+type owned struct {
+	ID    uint   `json:"id"`
+	Owner string `json:"owner"`
+	Name  string `json:"name"`
+}
+
+func TestAuthorization_UpdateOwner(t *testing.T) {
+	auth, err := NewAuthenticator(tconfig.Auth{Secret: testSecret})
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v", err)
+	}
+	bearer := func(subject string) string {
+		claims := validClaims()
+		claims["sub"] = subject
+		return "Bearer " + sign(t, jwt.SigningMethodHS256, []byte(testSecret), claims)
+	}
+
+	// Everybody reads the records, only their owner changes them.
+	model := tmodel.NewModel(&owned{}, "owned").
+		SetAuthorizer(tmodel.AuthorizerFunc(func(ctx context.Context, routeType tmodel.RouteType, in interface{}) error {
+			rec, ok := in.(*owned)
+			if ok && routeType != tmodel.RouteGetOne && rec.Owner != tcontext.ClaimsFromCtx(ctx).Subject() {
+				return terror.NewForbidden("not the owner")
+			}
+			return nil
+		}))
+	srv := newTestServer(t, tmodel.NewModels(model), WithAuth(auth))
+	for _, owner := range []string{"ann", "bob"} {
+		if resp, body := doAuth(t, srv, http.MethodPost, "/api/owned/add-one/", `{"owner":"`+owner+`","name":"a"}`, bearer(owner)); resp.StatusCode != http.StatusOK {
+			t.Fatalf("add-one %s = %d %s", owner, resp.StatusCode, body)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		subject    string
+		wantStatus int
+		wantStored string
+	}{
+		{name: "owner updates", path: "/api/owned/update/1", body: `{"name":"b"}`, subject: "ann", wantStatus: http.StatusOK, wantStored: `"owner":"ann","name":"b"`},
+		{name: "owner hands over", path: "/api/owned/update/1", body: `{"owner":"bob"}`, subject: "ann", wantStatus: http.StatusForbidden, wantStored: `"owner":"ann"`},
+		{name: "non-owner updates", path: "/api/owned/update/2", body: `{"name":"b"}`, subject: "ann", wantStatus: http.StatusForbidden, wantStored: `"owner":"bob","name":"a"`},
+		{name: "non-owner takes over", path: "/api/owned/update/2", body: `{"owner":"ann"}`, subject: "ann", wantStatus: http.StatusForbidden, wantStored: `"owner":"bob"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := doAuth(t, srv, http.MethodPut, tt.path, tt.body, bearer(tt.subject))
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", resp.StatusCode, tt.wantStatus, body)
+			}
+			getPath := strings.Replace(tt.path, "update", "get-one", 1)
+			if _, stored := doAuth(t, srv, http.MethodGet, getPath, "", bearer(tt.subject)); !strings.Contains(stored, tt.wantStored) {
+				t.Errorf("get-one = %s, want it to contain %s", stored, tt.wantStored)
+			}
+		})
+	}
+}
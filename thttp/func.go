@@ -3,17 +3,21 @@ package thttp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"reflect"
-	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
 	"github.com/WojciechWiderski/tofu/tcontext"
 	"github.com/WojciechWiderski/tofu/terror"
 	"github.com/WojciechWiderski/tofu/tlogger"
+	"github.com/WojciechWiderski/tofu/tmetrics"
+	"github.com/WojciechWiderski/tofu/ttrace"
+	"github.com/WojciechWiderski/tofu/tvalidate"
 
 	"github.com/WojciechWiderski/tofu/tdatabase"
 	"github.com/WojciechWiderski/tofu/tmodel"
@@ -22,6 +26,12 @@ import (
 type HttpAPI struct {
 	Database tdatabase.DBOperations
 	Models   *tmodel.Models
+	OpenAPI  OpenAPI
+	Health   Health
+	Metrics  bool
+	Tracing  bool
+	Auth     *Auth
+	APIKeys  *APIKeys
 }
 
 const (
@@ -42,6 +52,20 @@ func NewHttpApi(models *tmodel.Models, opts ...func(*HttpAPI)) *HttpAPI {
 	return api
 }
 
+// WithMetrics serves tmetrics at /metrics and records the requests.
+func WithMetrics() func(*HttpAPI) {
+	return func(api *HttpAPI) {
+		api.Metrics = true
+	}
+}
+
+// WithTracing starts a server span for every request, see TracingMiddleware.
+func WithTracing() func(*HttpAPI) {
+	return func(api *HttpAPI) {
+		api.Tracing = true
+	}
+}
+
 func WithDatabase(db tdatabase.DBOperations) func(*HttpAPI) {
 	if db == nil {
 		tlogger.Error("DB cannot be nil")
@@ -52,259 +76,440 @@ func WithDatabase(db tdatabase.DBOperations) func(*HttpAPI) {
 	}
 }
 
+// GetOne reads the record with the id from the route pattern, e.g. /api/task/get-one/5, or the first record
+// matching the by and filter params. A request without either is rejected rather than reading any record.
 func (a *HttpAPI) GetOne(ctx context.Context, params tdatabase.ParamRequest) (interface{}, error) {
-
-	var err error
 	modelFromCtx := tcontext.ModelFromCtx(ctx)
+	event := tcontext.EventFromCtx(ctx)
+	event.Params = params
+	if pattern := tcontext.PatternFromCtx(ctx); pattern != "" && fmt.Sprint(params.By) == "" {
+		event.Params.By, event.Params.Value = id, pattern
+	}
 
-	modelFromCtx.In, err = a.runFn(ctx, tmodel.FnBeforeDBO, modelFromCtx)
-	if err != nil {
-		return nil, terror.Wrap("a.runFn - FnBeforeDBO", err)
+	if err := a.runHooks(ctx, tmodel.FnBeforeSave); err != nil {
+		return nil, terror.Wrap("a.runHooks - before-save", err)
 	}
 
-	resp, err := modelFromCtx.Store.GetOne(ctx, modelFromCtx.In, params)
-	if err != nil {
-		return nil, terror.Wrap(fmt.Sprintf("a.Database.GetOne model - %v by - %v by value - %v.", modelFromCtx, by, params.By), err)
+	if len(event.Params.Conditions()) == 0 {
+		return nil, terror.NewBadRequest("get one requires an id or a filter")
 	}
 
-	modelFromCtx.In, err = a.runFn(ctx, tmodel.FnAfterDBO, modelFromCtx)
+	resp, err := modelFromCtx.Store.GetOne(ctx, event.In, event.Params)
 	if err != nil {
-		return nil, terror.Wrap("a.runFn - FnAfterDBO", err)
+		return nil, terror.Wrap(fmt.Sprintf("a.Database.GetOne model - %v by - %v by value - %v.", modelFromCtx.Name, event.Params.By, event.Params.Value), err)
+	}
+
+	if err := authorizeRecord(ctx, modelFromCtx, tmodel.RouteGetOne, resp); err != nil {
+		return nil, terror.Wrap("authorizeRecord", err)
 	}
 
-	return resp, nil
+	event.In, event.Response = resp, resp
+	if err := a.runHooks(ctx, tmodel.FnAfterSave); err != nil {
+		return nil, terror.Wrap("a.runHooks - after-save", err)
+	}
+
+	return event.Response, nil
 }
 
 func (a *HttpAPI) GetMany(ctx context.Context, params tdatabase.ParamRequest) (interface{}, error) {
-
-	var err error
 	modelFromCtx := tcontext.ModelFromCtx(ctx)
+	event := tcontext.EventFromCtx(ctx)
+	event.Params = params
+	event.Params.Limit = pageLimit(params.Limit)
 
-	modelFromCtx.In, err = a.runFn(ctx, tmodel.FnBeforeDBO, modelFromCtx)
-	if err != nil {
-		return nil, terror.Wrap("a.runFn - FnBeforeDBO", err)
+	if err := authorizeRecord(ctx, modelFromCtx, tmodel.RouteGetMany, nil); err != nil {
+		return nil, terror.Wrap("authorizeRecord", err)
 	}
 
-	resp, err := modelFromCtx.Store.GetMany(ctx, modelFromCtx.In, params)
+	if err := a.runHooks(ctx, tmodel.FnBeforeSave); err != nil {
+		return nil, terror.Wrap("a.runHooks - before-save", err)
+	}
 
+	items, err := modelFromCtx.Store.GetMany(ctx, event.In, event.Params)
 	if err != nil {
-		return nil, terror.Wrap(fmt.Sprintf("a.Database.GetMany model - %v by - %v by value - %v.", model, by, params.By), err)
+		return nil, terror.Wrap(fmt.Sprintf("a.Database.GetMany model - %v by - %v by value - %v.", modelFromCtx.Name, event.Params.By, event.Params.Value), err)
 	}
 
-	modelFromCtx.In, err = a.runFn(ctx, tmodel.FnAfterDBO, modelFromCtx)
+	total, err := modelFromCtx.Store.Count(ctx, event.In, event.Params)
 	if err != nil {
-		return nil, terror.Wrap("a.runFn - FnAfterDBO", err)
+		return nil, terror.Wrap(fmt.Sprintf("a.Database.Count model - %v.", modelFromCtx.Name), err)
 	}
 
-	return resp, nil
+	resp, err := tdatabase.NewPage(items, total, event.Params)
+	if err != nil {
+		return nil, terror.NewBadRequest(err.Error())
+	}
+
+	event.Response = resp
+	if err := a.runHooks(ctx, tmodel.FnAfterSave); err != nil {
+		return nil, terror.Wrap("a.runHooks - after-save", err)
+	}
+
+	return event.Response, nil
 }
 
-func (a *HttpAPI) GetOwn(ctx context.Context, w http.ResponseWriter, r *http.Request, params tdatabase.ParamRequest) (interface{}, error) {
-	var err error
+func (a *HttpAPI) AddOne(ctx context.Context, body io.Reader) (interface{}, error) {
 	modelFromCtx := tcontext.ModelFromCtx(ctx)
+	event := tcontext.EventFromCtx(ctx)
 
-	pattern := tcontext.PatternFromCtx(ctx)
-
-	resp, err := modelFromCtx.Routes[http.MethodGet][pattern].Fn(ctx, w, r, a.Database)
-	if err != nil {
-		return nil, terror.Wrap("%s", err)
+	if err := json.NewDecoder(body).Decode(&event.In); err != nil {
+		return nil, terror.NewBadRequest(fmt.Sprintf("malformed JSON body: %s", err))
 	}
 
-	return resp, nil
-}
+	if err := a.runHooks(ctx, tmodel.FnBeforeValidate); err != nil {
+		return nil, terror.Wrap("a.runHooks - before-validate", err)
+	}
 
-func (a *HttpAPI) AddOne(ctx context.Context, body io.Reader) error {
-	var err error
-	modelFromCtx := tcontext.ModelFromCtx(ctx)
+	if err := a.validate(ctx, modelFromCtx, event.In, false); err != nil {
+		return nil, terror.Wrap("a.validate", err)
+	}
 
-	if err := json.NewDecoder(body).Decode(&modelFromCtx.In); err != nil {
-		return terror.NewInternalf("json.NewDecoder(r.Body)", err)
+	if err := authorizeRecord(ctx, modelFromCtx, tmodel.RouteAddOne, event.In); err != nil {
+		return nil, terror.Wrap("authorizeRecord", err)
 	}
 
-	modelFromCtx.In, err = a.runFn(ctx, tmodel.FnBeforeDBO, modelFromCtx)
-	if err != nil {
-		return terror.Wrap("a.runFn - FnBeforeDBO", err)
+	if err := a.runHooks(ctx, tmodel.FnBeforeSave); err != nil {
+		return nil, terror.Wrap("a.runHooks - before-save", err)
 	}
 
-	if err := modelFromCtx.Store.Add(ctx, modelFromCtx.In); err != nil {
-		return terror.Wrap(fmt.Sprintf("a.Database.Add model - %v", model), err)
+	if err := modelFromCtx.Store.Add(ctx, event.In); err != nil {
+		return nil, terror.Wrap(fmt.Sprintf("a.Database.Add model - %v", modelFromCtx.Name), err)
 	}
 
-	modelFromCtx.In, err = a.runFn(ctx, tmodel.FnAfterDBO, modelFromCtx)
-	if err != nil {
-		return terror.Wrap("a.runFn - FnAfterDBO", err)
+	if err := a.runHooks(ctx, tmodel.FnAfterSave); err != nil {
+		return nil, terror.Wrap("a.runHooks - after-save", err)
 	}
 
-	return nil
+	return event.Response, nil
 }
 
-// TODO nie działa.
-func (a *HttpAPI) AddMany(w http.ResponseWriter, r *http.Request) error {
-	ctx := r.Context()
-	model, err := a.getModelFromURL(r)
-	if err != nil {
-		return terror.Wrap("a.getModelFromURL", err)
+// AddMany decodes a JSON array of the model and adds every item in one transaction.
+func (a *HttpAPI) AddMany(ctx context.Context, body io.Reader) (interface{}, error) {
+	modelFromCtx := tcontext.ModelFromCtx(ctx)
+	event := tcontext.EventFromCtx(ctx)
+
+	items := reflect.New(reflect.SliceOf(reflect.TypeOf(modelFromCtx.In)))
+	if err := json.NewDecoder(body).Decode(items.Interface()); err != nil {
+		return nil, terror.NewBadRequest(fmt.Sprintf("malformed JSON body: %s", err))
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&model.In); err != nil {
-		return terror.NewInternalf("json.NewDecoder(r.Body)", err)
+	event.Items = make([]interface{}, items.Elem().Len())
+	for i := range event.Items {
+		event.Items[i] = items.Elem().Index(i).Interface()
 	}
 
-	ctx = tcontext.ContextWithModel(ctx, model)
+	if err := a.runHooks(ctx, tmodel.FnBeforeValidate); err != nil {
+		return nil, terror.Wrap("a.runHooks - before-validate", err)
+	}
 
-	model.In, err = a.runFn(ctx, tmodel.FnBeforeDBO, model)
-	if err != nil {
-		return terror.Wrap("a.runFn - FnBeforeDBO", err)
+	if err := a.validate(ctx, modelFromCtx, event.Items, false); err != nil {
+		return nil, terror.Wrap("a.validate", err)
+	}
+
+	for i, item := range event.Items {
+		if err := authorizeRecord(ctx, modelFromCtx, tmodel.RouteAddMany, item); err != nil {
+			return nil, terror.Wrap(fmt.Sprintf("authorizeRecord - item %d", i), err)
+		}
 	}
 
-	if err := a.Database.Add(ctx, model.In); err != nil {
-		return terror.Wrap(fmt.Sprintf("a.Database.Add model - %v", model), err)
+	if err := a.runHooks(ctx, tmodel.FnBeforeSave); err != nil {
+		return nil, terror.Wrap("a.runHooks - before-save", err)
 	}
 
-	model.In, err = a.runFn(ctx, tmodel.FnAfterDBO, model)
+	resp, err := modelFromCtx.Store.AddMany(ctx, event.Items)
 	if err != nil {
-		return terror.Wrap("a.runFn - FnAfterDBO", err)
+		return nil, terror.Newf(terror.KindOf(err), fmt.Sprintf("a.Database.AddMany model - %v", modelFromCtx.Name), err).
+			WithDetails(batchResults(event.Items, resp, err))
 	}
 
-	terror.HttpApiHandleSuccess(w, r, http.StatusOK, nil)
-	return nil
+	event.Response = resp
+	if err := a.runHooks(ctx, tmodel.FnAfterSave); err != nil {
+		return nil, terror.Wrap("a.runHooks - after-save", err)
+	}
+
+	return event.Response, nil
 }
 
-func (a *HttpAPI) Update(ctx context.Context, r *http.Request) (interface{}, error) {
+// batchResults returns a result for every item of a failed batch, the items without an error of their own
+// are reported as well since the whole batch is rolled back. The failing item gets the client message of
+// err rather than the raw store message.
+func batchResults(items []interface{}, results []tdatabase.Result, err error) []tdatabase.Result {
+	out := make([]tdatabase.Result, len(items))
+	for i, item := range items {
+		out[i] = tdatabase.Result{Index: i, Item: item, Error: "not added, the batch was rolled back"}
+	}
+	detail := terror.Detail(err)
+	if detail == "" {
+		detail = "not added, internal error"
+	}
+	for _, result := range results {
+		if result.Error != "" && result.Index < len(out) {
+			out[result.Index].Error = detail
+		}
+	}
+	return out
+}
 
+func (a *HttpAPI) Update(ctx context.Context, r *http.Request) (interface{}, error) {
 	modelFromCtx := tcontext.ModelFromCtx(ctx)
+	event := tcontext.EventFromCtx(ctx)
 
-	update, err := a.getModelFromURL(r)
+	id, err := idFromRequest(r, modelFromCtx)
 	if err != nil {
-		return nil, terror.Wrap("a.getModelFromURL", err)
+		return nil, terror.Wrap("idFromRequest", err)
 	}
+	event.ID = id
 
-	id, err := strconv.Atoi(chi.URLParam(r, "id"))
-	if err != nil {
-		return nil, terror.NewInternalf("strconv.Atoi()", err)
+	if err := json.NewDecoder(r.Body).Decode(&event.In); err != nil {
+		return nil, terror.NewBadRequest(fmt.Sprintf("malformed JSON body: %s", err))
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&update.In); err != nil {
-		return nil, terror.NewInternalf("json.NewDecoder(r.Body)", err)
+	if err := a.runHooks(ctx, tmodel.FnBeforeValidate); err != nil {
+		return nil, terror.Wrap("a.runHooks - before-validate", err)
 	}
 
-	modelFromCtx.In, err = a.runFn(ctx, tmodel.FnBeforeDBO, modelFromCtx)
+	stored, err := modelFromCtx.Store.GetOne(ctx, modelFromCtx.NewIn(), tdatabase.ParamRequest{By: "id", Value: event.ID})
 	if err != nil {
-		return nil, terror.Wrap("a.runFn - FnBeforeDBO", err)
+		return nil, terror.Wrap(fmt.Sprintf("a.Database.GetOne model - %v id - %v.", modelFromCtx.Name, event.ID), err)
 	}
 
-	err = a.Database.Update(ctx, update.In, modelFromCtx.In, id)
-	if err != nil {
-		return nil, terror.Wrap(fmt.Sprintf("a.Database.Update update - %v model - %v id - %v.", update, modelFromCtx, id), err)
+	// The stores write only the non-zero fields of the payload, so the record is validated as it will be
+	// saved: the payload merged onto the stored record.
+	merged := merge(stored, event.In)
+	if err := a.validate(ctx, modelFromCtx, merged, false); err != nil {
+		return nil, terror.Wrap("a.validate", err)
+	}
+
+	// The authorizer sees the record before and after the update, so a caller allowed to change a record
+	// cannot hand it over, for example by setting its owner, to a record it is not allowed to hold.
+	if err := authorizeRecord(ctx, modelFromCtx, tmodel.RouteUpdate, stored); err != nil {
+		return nil, terror.Wrap("authorizeRecord - stored", err)
+	}
+	if err := authorizeRecord(ctx, modelFromCtx, tmodel.RouteUpdate, merged); err != nil {
+		return nil, terror.Wrap("authorizeRecord - updated", err)
 	}
 
-	modelFromCtx.In, err = a.runFn(ctx, tmodel.FnAfterDBO, modelFromCtx)
+	if err := a.runHooks(ctx, tmodel.FnBeforeSave); err != nil {
+		return nil, terror.Wrap("a.runHooks - before-save", err)
+	}
+
+	updated := modelFromCtx.NewIn()
+	err = modelFromCtx.Store.Update(ctx, event.In, updated, event.ID)
 	if err != nil {
-		return nil, terror.Wrap("a.runFn - FnAfterDBO", err)
+		return nil, terror.Wrap(fmt.Sprintf("a.Database.Update model - %v id - %v.", modelFromCtx.Name, event.ID), err)
+	}
+
+	event.In = updated
+	if err := a.runHooks(ctx, tmodel.FnAfterSave); err != nil {
+		return nil, terror.Wrap("a.runHooks - after-save", err)
 	}
 
-	return nil, nil
+	return event.Response, nil
 }
 
-func (a *HttpAPI) DeleteOne(w http.ResponseWriter, r *http.Request) error {
-	ctx := r.Context()
-	model, err := a.getModelFromURL(r)
+func (a *HttpAPI) DeleteOne(ctx context.Context, r *http.Request) (interface{}, error) {
+	modelFromCtx := tcontext.ModelFromCtx(ctx)
+	event := tcontext.EventFromCtx(ctx)
+
+	id, err := idFromRequest(r, modelFromCtx)
 	if err != nil {
-		return terror.Wrap("a.getModelFromURL", err)
+		return nil, terror.Wrap("idFromRequest", err)
 	}
+	event.ID = id
 
-	id, err := strconv.Atoi(chi.URLParam(r, "id"))
-	if err != nil {
-		return terror.NewInternalf("strconv.Atoi()", err)
+	if err := authorizeStored(ctx, modelFromCtx, tmodel.RouteDeleteOne, event.ID); err != nil {
+		return nil, terror.Wrap("authorizeStored", err)
 	}
 
-	model.In, err = a.runFn(ctx, tmodel.FnBeforeDBO, model)
-	if err != nil {
-		return terror.Wrap("a.runFn - FnBeforeDBO", err)
+	if err := a.runHooks(ctx, tmodel.FnBeforeSave); err != nil {
+		return nil, terror.Wrap("a.runHooks - before-save", err)
 	}
 
-	err = a.Database.Delete(ctx, model.In, id)
+	err = modelFromCtx.Store.Delete(ctx, event.In, event.ID)
 	if err != nil {
-		return terror.Wrap(fmt.Sprintf("a.Database.Delete in - %v id - %v.", model, id), err)
+		return nil, terror.Wrap(fmt.Sprintf("a.Database.Delete in - %v id - %v.", modelFromCtx.Name, event.ID), err)
 	}
 
-	model.In, err = a.runFn(ctx, tmodel.FnAfterDBO, model)
-	if err != nil {
-		return terror.Wrap("a.runFn - FnAfterDBO", err)
+	event.Response = []tdatabase.Result{{Index: 0, Item: event.ID}}
+	if err := a.runHooks(ctx, tmodel.FnAfterSave); err != nil {
+		return nil, terror.Wrap("a.runHooks - after-save", err)
 	}
 
-	terror.HttpApiHandleSuccess(w, r, http.StatusNoContent, nil)
-	return nil
+	return event.Response, nil
 }
 
-func (a *HttpAPI) DeleteMany(w http.ResponseWriter, r *http.Request) error {
-	ctx := r.Context()
-	model, err := a.getModelFromURL(r)
-	if err != nil {
-		return terror.Wrap("a.getModelFromURL", err)
+// DeleteMany deletes every record matching the filter from params and returns the deleted records.
+func (a *HttpAPI) DeleteMany(ctx context.Context, params tdatabase.ParamRequest) (interface{}, error) {
+	modelFromCtx := tcontext.ModelFromCtx(ctx)
+	event := tcontext.EventFromCtx(ctx)
+	event.Params = params
+
+	if err := authorizeRecord(ctx, modelFromCtx, tmodel.RouteDeleteMany, nil); err != nil {
+		return nil, terror.Wrap("authorizeRecord", err)
 	}
 
-	id, err := strconv.Atoi(chi.URLParam(r, "id"))
-	if err != nil {
-		return terror.NewInternalf("strconv.Atoi()", err)
+	if err := a.runHooks(ctx, tmodel.FnBeforeSave); err != nil {
+		return nil, terror.Wrap("a.runHooks - before-save", err)
 	}
 
-	model.In, err = a.runFn(ctx, tmodel.FnBeforeDBO, model)
+	resp, err := modelFromCtx.Store.DeleteMany(ctx, event.In, event.Params)
 	if err != nil {
-		return terror.Wrap("a.runFn - FnBeforeDBO", err)
+		return nil, terror.Wrap(fmt.Sprintf("a.Database.DeleteMany model - %v.", modelFromCtx.Name), err)
 	}
 
-	err = a.Database.Delete(ctx, model.In, id)
-	if err != nil {
-		return terror.Wrap(fmt.Sprintf("a.Database.Delete in - %v id - %v.", model, id), err)
+	event.Response = resp
+	if err := a.runHooks(ctx, tmodel.FnAfterSave); err != nil {
+		return nil, terror.Wrap("a.runHooks - after-save", err)
 	}
 
-	model.In, err = a.runFn(ctx, tmodel.FnAfterDBO, model)
+	return event.Response, nil
+}
+
+// pageLimit applies tdatabase.DefaultLimit to a get-many request without a limit and caps the limit at
+// tdatabase.MaxLimit, Go callers of the store read every record without a limit.
+func pageLimit(limit int) int {
+	switch {
+	case limit <= 0:
+		return tdatabase.DefaultLimit
+	case limit > tdatabase.MaxLimit:
+		return tdatabase.MaxLimit
+	}
+	return limit
+}
+
+// idFromRequest reads the record id from the route pattern, e.g. /api/task/delete-one/5, or from the id query
+// param, and converts it to the primary key type of model.
+func idFromRequest(r *http.Request, model *tmodel.Model) (interface{}, error) {
+	value := tcontext.PatternFromCtx(r.Context())
+	if value == "" {
+		value = r.URL.Query().Get(id)
+	}
+
+	recordID, err := model.ParseID(value)
 	if err != nil {
-		return terror.Wrap("a.runFn - FnAfterDBO", err)
+		return nil, terror.Wrap("model.ParseID", err)
 	}
+	return recordID, nil
+}
+
+func (a *HttpAPI) getModelFromURL(r *http.Request) (*tmodel.Model, error) {
+	return a.Models.GetRawModel(chi.URLParam(r, "model"))
+}
 
-	terror.HttpApiHandleSuccess(w, r, http.StatusNoContent, nil)
+// validate runs the validate struct tags and the model validators on in, a slice of items is validated item by item.
+// Partial validation is used for updates which only write the non-zero fields.
+func (a *HttpAPI) validate(ctx context.Context, model *tmodel.Model, in interface{}, partial bool) error {
+	items, ok := in.([]interface{})
+	if !ok {
+		items = []interface{}{in}
+	}
+
+	var fields []terror.FieldError
+	for i, item := range items {
+		itemFields := tvalidate.Struct(item, partial)
+		for _, validator := range model.Validators {
+			itemFields = append(itemFields, validator(ctx, item)...)
+		}
+		for _, field := range itemFields {
+			if ok {
+				field.Field = fmt.Sprintf("[%d].%s", i, field.Field)
+			}
+			fields = append(fields, field)
+		}
+	}
+
+	if len(fields) > 0 {
+		return terror.NewValidation(fields)
+	}
 	return nil
 }
 
-func (a *HttpAPI) getModelFromURL(r *http.Request) (*tmodel.Model, error) {
-	for _, model := range a.Models.All {
-		if model.Name == chi.URLParam(r, "model") {
-			newModelIn := reflect.New(reflect.ValueOf(model.In).Elem().Type()).Interface()
-
-			return &tmodel.Model{
-				In:        newModelIn,
-				Name:      model.Name,
-				Functions: model.Functions,
-				Routes:    model.Routes,
-			}, nil
+// merge returns a copy of the stored record with the non-zero fields of update set on it, the fields of
+// embedded structs are merged one by one.
+func merge(stored interface{}, update interface{}) interface{} {
+	merged := reflect.New(reflect.TypeOf(stored).Elem())
+	merged.Elem().Set(reflect.ValueOf(stored).Elem())
+	mergeFields(merged.Elem(), reflect.Indirect(reflect.ValueOf(update)))
+	return merged.Interface()
+}
+
+func mergeFields(dst reflect.Value, src reflect.Value) {
+	if src.Kind() != reflect.Struct || src.Type() != dst.Type() {
+		return
+	}
+	for i := 0; i < src.NumField(); i++ {
+		field := src.Type().Field(i)
+		switch {
+		case !field.IsExported():
+		case field.Anonymous && field.Type.Kind() == reflect.Struct:
+			mergeFields(dst.Field(i), src.Field(i))
+		case !src.Field(i).IsZero():
+			dst.Field(i).Set(src.Field(i))
 		}
 	}
-	return nil, nil
 }
 
-func (a *HttpAPI) runFn(ctx context.Context, fnType tmodel.FunctionType, model *tmodel.Model) (interface{}, error) {
-	routeType := tcontext.RouteTypeFromCtx(ctx)
+// withEvent starts the hook event of the route of ctx with a new record of model.
+func (a *HttpAPI) withEvent(ctx context.Context, model *tmodel.Model) context.Context {
+	return tcontext.ContextWithEvent(ctx, &tmodel.Event{
+		Model:     model,
+		RouteType: tcontext.RouteTypeFromCtx(ctx),
+		In:        model.In,
+		DB:        a.Database,
+	})
+}
 
-	allFn, ok := model.Functions[tmodel.RouteAll]
-	if ok {
-		if allFn.FunctionType == fnType {
-			f, err := allFn.F(ctx, a.Database)
-			if err != nil {
-				return nil, terror.Wrap("allFn.f", err)
-			}
-			model.In = f
+// runHooks runs the stage chain of the route event in ctx, a hook error ends the chain.
+func (a *HttpAPI) runHooks(ctx context.Context, stage tmodel.FunctionType) error {
+	event := tcontext.EventFromCtx(ctx)
+	event.Stage = stage
+	for _, fn := range event.Model.Chain(event.RouteType, stage) {
+		if err := a.callFn(ctx, fn, event); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	routeTypeFn, ok := model.Functions[routeType]
-	if !ok {
-		return model.In, nil
+func (a *HttpAPI) callFn(ctx context.Context, fn tmodel.Fn, event *tmodel.Event) error {
+	ctx, span := ttrace.Start(ctx, "hook "+fn.FunctionType.String())
+	span.SetAttributes(ttrace.AttrModel.String(event.Model.Name), ttrace.AttrHook.String(fn.FunctionType.String()))
+	start := time.Now()
+
+	err := fn.Hook(ctx, event)
+	observed := err
+	if errors.Is(err, tmodel.ErrStop) {
+		observed = nil
+	}
+	tmetrics.ObserveHook(event.Model.Name, fn.FunctionType.String(), start, observed)
+	ttrace.End(span, observed)
+	return err
+}
+
+// respond runs the after-commit and before-respond chains once the route returned resp, a route ended by
+// tmodel.ErrStop responds with the event response right away.
+func (a *HttpAPI) respond(ctx context.Context, resp interface{}, err error) (interface{}, error) {
+	event := tcontext.EventFromCtx(ctx)
+	if errors.Is(err, tmodel.ErrStop) {
+		return event.Response, nil
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	event.Response = resp
+	if err := a.runHooks(ctx, tmodel.FnAfterCommit); err != nil {
+		return a.respondStopped(event, terror.Wrap("a.runHooks - after-commit", err))
+	}
+	if err := a.runHooks(ctx, tmodel.FnBeforeRespond); err != nil {
+		return a.respondStopped(event, terror.Wrap("a.runHooks - before-respond", err))
+	}
+	return event.Response, nil
+}
 
-	if routeTypeFn.FunctionType == fnType {
-		return routeTypeFn.F(ctx, a.Database)
+func (a *HttpAPI) respondStopped(event *tmodel.Event, err error) (interface{}, error) {
+	if errors.Is(err, tmodel.ErrStop) {
+		return event.Response, nil
 	}
-	return model.In, nil
+	return nil, err
 }
@@ -0,0 +1,27 @@
+package thttp
+
+import (
+	"testing"
+
+	"github.com/WojciechWiderski/tofu/tdatabase"
+)
+
+func TestPageLimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		want  int
+	}{
+		{name: "no limit", limit: 0, want: tdatabase.DefaultLimit},
+		{name: "negative limit", limit: -1, want: tdatabase.DefaultLimit},
+		{name: "limit", limit: 20, want: 20},
+		{name: "limit above the maximum", limit: tdatabase.MaxLimit + 1, want: tdatabase.MaxLimit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pageLimit(tt.limit); got != tt.want {
+				t.Errorf("pageLimit() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
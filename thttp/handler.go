@@ -1,7 +1,15 @@
 package thttp
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -11,38 +19,87 @@ import (
 	"github.com/WojciechWiderski/tofu/tcontext"
 	"github.com/WojciechWiderski/tofu/tdatabase"
 	"github.com/WojciechWiderski/tofu/terror"
+	"github.com/WojciechWiderski/tofu/tmetrics"
 	"github.com/WojciechWiderski/tofu/tmodel"
+	"github.com/WojciechWiderski/tofu/ttrace"
 )
 
 func (a *HttpAPI) GetHandler(corsConfig tconfig.Cors) http.Handler {
 	r := chi.NewRouter()
-	r.Use(middleware.Logger)
+	if a.Tracing {
+		r.Use(TracingMiddleware())
+	}
+	r.Use(middleware.RequestID)
+	r.Use(RequestIDHeaderMiddleware())
+	r.Use(LoggerMiddleware())
+	r.Use(RecoverMiddleware())
+	if a.Metrics {
+		r.Use(MetricsMiddleware(a.Models))
+	}
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		terror.HandleError(w, r, terror.NewNotFound("wrong path"))
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		terror.HandleError(w, r, terror.New(terror.NotAllowed, fmt.Sprintf("method %s not allowed", r.Method)))
+	})
 
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   corsConfig.AllowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PATCH", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", APIKeyHeader, middleware.RequestIDHeader},
+		ExposedHeaders:   []string{"Link", "WWW-Authenticate", middleware.RequestIDHeader},
 		AllowCredentials: corsConfig.AllowCredentials,
 		MaxAge:           300,
 	}))
 
+	r.Get("/healthz", a.HandlerHealthz)
+	r.Get("/readyz", a.HandlerReadyz)
+	if a.Metrics {
+		r.Handle("/metrics", tmetrics.Handler())
+	}
+
 	r.Route("/api", func(r chi.Router) {
-		r.With(ModelMiddleware(a.Models), RouteTypeMiddleware()).Route("/{model}/{route-type}", func(r chi.Router) {
-			r.With(PatternMiddleware()).Get("/{pattern}", terror.HttpApiHandleError(a.HandlerGet))
-			r.With(PatternMiddleware()).Get("/", terror.HttpApiHandleError(a.HandlerGet))
-			r.With(PatternMiddleware()).Post("/{pattern}", terror.HttpApiHandleError(a.HandlerPost))
-			r.With(PatternMiddleware()).Post("/", terror.HttpApiHandleError(a.HandlerPost))
-			r.With(PatternMiddleware()).Put("/{pattern}", terror.HttpApiHandleError(a.HandlerPut))
-			r.With(PatternMiddleware()).Put("/", terror.HttpApiHandleError(a.HandlerPut))
-			//r.With(PatternMiddleware()).Delete("/{pattern}", terror.HttpApiHandleError(a.HandlerDelete))
-			//r.With(PatternMiddleware()).Delete("/", terror.HttpApiHandleError(a.HandlerDelete))
+		r.With(a.authMiddleware()).Get("/openapi.json", handle(a.HandlerOpenAPI))
+		if a.OpenAPI.UI {
+			r.Get("/docs", a.HandlerDocs)
+		}
+		if a.APIKeys != nil {
+			r.With(a.authMiddleware()).Route("/api-keys", func(r chi.Router) {
+				r.Post("/", handle(a.HandlerIssueAPIKey))
+				r.Get("/", handle(a.HandlerListAPIKeys))
+				r.Delete("/{id}", handle(a.HandlerRevokeAPIKey))
+			})
+		}
+		a.ownRoutes(r)
+		r.With(ModelMiddleware(a.Models), RouteTypeMiddleware(), a.authMiddleware()).Route("/{model}/{route-type}", func(r chi.Router) {
+			r.With(PatternMiddleware()).Get("/{pattern}", handle(a.HandlerGet))
+			r.With(PatternMiddleware()).Get("/", handle(a.HandlerGet))
+			r.With(PatternMiddleware()).Post("/{pattern}", handle(a.HandlerPost))
+			r.With(PatternMiddleware()).Post("/", handle(a.HandlerPost))
+			r.With(PatternMiddleware()).Put("/{pattern}", handle(a.HandlerPut))
+			r.With(PatternMiddleware()).Put("/", handle(a.HandlerPut))
+			r.With(PatternMiddleware()).Delete("/{pattern}", handle(a.HandlerDelete))
+			r.With(PatternMiddleware()).Delete("/", handle(a.HandlerDelete))
 		})
 	})
 
 	return r
 }
 
+// handle writes the result of h as JSON or as a problem, the encoding runs in its own span.
+func handle(h func(http.ResponseWriter, *http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp, err := h(w, r)
+		if err != nil {
+			terror.HandleError(w, r, err)
+			return
+		}
+		_, span := ttrace.Start(r.Context(), "encode response")
+		defer span.End()
+		terror.HttpApiHandleSuccess(w, r, http.StatusOK, resp)
+	}
+}
+
 func (a *HttpAPI) HandlerGet(w http.ResponseWriter, r *http.Request) (interface{}, error) {
 	ctx := r.Context()
 	var resp interface{}
@@ -52,13 +109,18 @@ func (a *HttpAPI) HandlerGet(w http.ResponseWriter, r *http.Request) (interface{
 		return nil, terror.Wrap("a.getModelFromURL", err)
 	}
 	ctx = tcontext.ContextWithModel(ctx, model)
+	ctx = a.withEvent(ctx, model)
 
-	query := r.URL.Query()
-	params := tdatabase.ParamRequest{
-		By:    query.Get("by"),
-		Value: query.Get("value"),
-		From:  query.Get("from"),
-		To:    query.Get("to"),
+	if err := authorizeRoles(ctx, model, tcontext.RouteTypeFromCtx(ctx)); err != nil {
+		return nil, terror.Wrap("authorizeRoles", err)
+	}
+
+	params, err := paramsFromQuery(r.URL.Query())
+	if err != nil {
+		return nil, terror.Wrap("paramsFromQuery", err)
+	}
+	if params.Include, err = model.Includes(params.Include); err != nil {
+		return nil, terror.Wrap("model.Includes", err)
 	}
 
 	fn := tcontext.RouteTypeFromCtx(ctx)
@@ -67,12 +129,77 @@ func (a *HttpAPI) HandlerGet(w http.ResponseWriter, r *http.Request) (interface{
 		resp, err = a.GetOne(ctx, params)
 	case tmodel.RouteGetMany:
 		resp, err = a.GetMany(ctx, params)
-	case tmodel.RouteOwn:
-		resp, err = a.GetOwn(ctx, w, r, params)
+		if page, ok := resp.(*tdatabase.Page); ok && err == nil {
+			setLinkHeader(w, r, page)
+		}
 	default:
-		return nil, nil
+		return nil, routeNotFound(r)
+	}
+	return a.respond(ctx, resp, err)
+}
+
+// filterKey matches filter[field] and filter[field][operator] query keys.
+var filterKey = regexp.MustCompile(`^filter\[([^\]]+)\](?:\[([^\]]*)\])?$`)
+
+func paramsFromQuery(query url.Values) (tdatabase.ParamRequest, error) {
+	params := tdatabase.ParamRequest{
+		By:     query.Get("by"),
+		Value:  query.Get("value"),
+		From:   query.Get("from"),
+		To:     query.Get("to"),
+		Cursor: query.Get("cursor"),
+		Sort:   tdatabase.ParseSort(query.Get("sort")),
+	}
+
+	for _, include := range query["include"] {
+		params.Include = append(params.Include, strings.Split(include, ",")...)
+	}
+
+	for key, values := range query {
+		match := filterKey.FindStringSubmatch(key)
+		if match == nil {
+			continue
+		}
+		for _, value := range values {
+			condition, err := tdatabase.NewCondition(match[1], match[2], value)
+			if err != nil {
+				return params, terror.NewBadRequest(err.Error())
+			}
+			params.Filter = append(params.Filter, condition)
+		}
+	}
+
+	var err error
+	if limit := query.Get("limit"); limit != "" {
+		if params.Limit, err = strconv.Atoi(limit); err != nil {
+			return params, terror.NewBadRequest(fmt.Sprintf("wrong limit %s", limit))
+		}
+	}
+	if offset := query.Get("offset"); offset != "" {
+		if params.Offset, err = strconv.Atoi(offset); err != nil {
+			return params, terror.NewBadRequest(fmt.Sprintf("wrong offset %s", offset))
+		}
+	}
+	return params, nil
+}
+
+// setLinkHeader adds RFC 8288 next and prev links pointing at the same query with another cursor.
+func setLinkHeader(w http.ResponseWriter, r *http.Request, page *tdatabase.Page) {
+	var links []string
+	for rel, cursor := range map[string]string{"next": page.NextCursor, "prev": page.PrevCursor} {
+		if cursor == "" {
+			continue
+		}
+		query := r.URL.Query()
+		query.Del("offset")
+		query.Set("cursor", cursor)
+		link := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+		links = append(links, fmt.Sprintf("<%s>; rel=\"%s\"", link.String(), rel))
+	}
+	sort.Strings(links)
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
 	}
-	return resp, err
 }
 
 func (a *HttpAPI) HandlerPost(w http.ResponseWriter, r *http.Request) (interface{}, error) {
@@ -83,18 +210,27 @@ func (a *HttpAPI) HandlerPost(w http.ResponseWriter, r *http.Request) (interface
 		return nil, terror.Wrap("a.getModelFromURL", err)
 	}
 	ctx = tcontext.ContextWithModel(ctx, model)
+	ctx = a.withEvent(ctx, model)
 
+	if err := authorizeRoles(ctx, model, tcontext.RouteTypeFromCtx(ctx)); err != nil {
+		return nil, terror.Wrap("authorizeRoles", err)
+	}
+
+	var resp interface{}
 	fn := tcontext.RouteTypeFromCtx(ctx)
 	switch fn {
 	case tmodel.RouteAddOne:
-		err = a.AddOne(ctx, r.Body)
+		resp, err = a.inTx(ctx, func(ctx context.Context) (interface{}, error) {
+			return a.AddOne(ctx, r.Body)
+		})
 	case tmodel.RouteAddMany:
-		err = a.AddMany(w, r)
-	case tmodel.RouteOwn:
+		resp, err = a.inTx(ctx, func(ctx context.Context) (interface{}, error) {
+			return a.AddMany(ctx, r.Body)
+		})
 	default:
-		return nil, nil
+		return nil, routeNotFound(r)
 	}
-	return nil, nil
+	return a.respond(ctx, resp, err)
 }
 
 func (a *HttpAPI) HandlerPut(w http.ResponseWriter, r *http.Request) (interface{}, error) {
@@ -106,26 +242,82 @@ func (a *HttpAPI) HandlerPut(w http.ResponseWriter, r *http.Request) (interface{
 		return nil, terror.Wrap("a.getModelFromURL", err)
 	}
 	ctx = tcontext.ContextWithModel(ctx, model)
+	ctx = a.withEvent(ctx, model)
+
+	if err := authorizeRoles(ctx, model, tcontext.RouteTypeFromCtx(ctx)); err != nil {
+		return nil, terror.Wrap("authorizeRoles", err)
+	}
 
 	fn := tcontext.RouteTypeFromCtx(r.Context())
 	switch fn {
 	case tmodel.RouteUpdate:
-		resp, err = a.Update(ctx, r)
+		resp, err = a.inTx(ctx, func(ctx context.Context) (interface{}, error) {
+			return a.Update(ctx, r)
+		})
 	default:
-		return nil, nil
+		return nil, routeNotFound(r)
 	}
-	return resp, err
+	return a.respond(ctx, resp, err)
 }
 
-func (a *HttpAPI) HandlerDelete(w http.ResponseWriter, r *http.Request) error {
-	fn := tcontext.RouteTypeFromCtx(r.Context())
+func (a *HttpAPI) HandlerDelete(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	var resp interface{}
+
+	model, err := a.getModelFromURL(r)
+	if err != nil {
+		return nil, terror.Wrap("a.getModelFromURL", err)
+	}
+	ctx = tcontext.ContextWithModel(ctx, model)
+	ctx = a.withEvent(ctx, model)
+
+	if err := authorizeRoles(ctx, model, tcontext.RouteTypeFromCtx(ctx)); err != nil {
+		return nil, terror.Wrap("authorizeRoles", err)
+	}
+
+	fn := tcontext.RouteTypeFromCtx(ctx)
 	switch fn {
 	case tmodel.RouteDeleteOne:
-		return a.DeleteMany(w, r)
+		resp, err = a.inTx(ctx, func(ctx context.Context) (interface{}, error) {
+			return a.DeleteOne(ctx, r)
+		})
 	case tmodel.RouteDeleteMany:
-		return a.DeleteMany(w, r)
-
+		var params tdatabase.ParamRequest
+		if params, err = paramsFromQuery(r.URL.Query()); err != nil {
+			return nil, terror.Wrap("paramsFromQuery", err)
+		}
+		resp, err = a.inTx(ctx, func(ctx context.Context) (interface{}, error) {
+			return a.DeleteMany(ctx, params)
+		})
 	default:
-		return nil
+		return nil, routeNotFound(r)
+	}
+	return a.respond(ctx, resp, err)
+}
+
+// routeNotFound rejects a route type without a route for the method, own routes are registered apart.
+func routeNotFound(r *http.Request) error {
+	return terror.NewNotFound(fmt.Sprintf("no %s route %s for model %s", r.Method, chi.URLParam(r, "route-type"), chi.URLParam(r, "model")))
+}
+
+// inTx runs a write route in one transaction of the model store, so hooks and database calls made with
+// the given context are committed or rolled back together. A route ended by tmodel.ErrStop is committed.
+func (a *HttpAPI) inTx(ctx context.Context, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	var (
+		resp    interface{}
+		stopErr error
+	)
+	err := tcontext.ModelFromCtx(ctx).Store.WithTx(ctx, func(ctx context.Context, _ tdatabase.DBOperations) error {
+		var err error
+		resp, err = fn(ctx)
+		if errors.Is(err, tmodel.ErrStop) {
+			stopErr = err
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
+	return resp, stopErr
 }
@@ -0,0 +1,371 @@
+package thttp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/WojciechWiderski/tofu/tconfig"
+	"github.com/WojciechWiderski/tofu/tdatabase"
+	"github.com/WojciechWiderski/tofu/tdatabase/memory"
+	"github.com/WojciechWiderski/tofu/tdatabase/sqlite"
+	"github.com/WojciechWiderski/tofu/terror"
+	"github.com/WojciechWiderski/tofu/tmodel"
+)
+
+type record struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name" gorm:"uniqueIndex" validate:"required"`
+	Min  int    `json:"min" validate:"ltefield=Max"`
+	Max  int    `json:"max"`
+}
+
+// newTestServer serves models from a memory store, opts are applied after WithDatabase.
+func newTestServer(t *testing.T, models *tmodel.Models, opts ...func(*HttpAPI)) *httptest.Server {
+	t.Helper()
+	db := memory.New(models)
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	for _, model := range models.All {
+		model.Store = db
+	}
+
+	api := NewHttpApi(models, append([]func(*HttpAPI){WithDatabase(db)}, opts...)...)
+	srv := httptest.NewServer(api.GetHandler(tconfig.Cors{}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newRecordServer(t *testing.T, names ...string) *httptest.Server {
+	t.Helper()
+	srv := newTestServer(t, tmodel.NewModels(tmodel.NewModel(&record{}, "record")))
+	for _, name := range names {
+		if status, body := do(t, srv, http.MethodPost, "/api/record/add-one/", `{"name":"`+name+`","max":10}`); status != http.StatusOK {
+			t.Fatalf("add-one %s = %d %s", name, status, body)
+		}
+	}
+	return srv
+}
+
+func do(t *testing.T, srv *httptest.Server, method string, path string, body string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("http.NewRequest() error = %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("http.Do() error = %v", err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, strings.TrimSpace(string(b))
+}
+
+func TestHandlerGet_GetOne(t *testing.T) {
+	srv := newRecordServer(t, "a", "b", "c")
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "id from the pattern", path: "/api/record/get-one/2", wantStatus: http.StatusOK, wantBody: `"name":"b"`},
+		{name: "missing id from the pattern", path: "/api/record/get-one/9", wantStatus: http.StatusNotFound},
+		{name: "by and value", path: "/api/record/get-one/?by=name&value=c", wantStatus: http.StatusOK, wantBody: `"name":"c"`},
+		{name: "filter", path: "/api/record/get-one/?filter[name]=a", wantStatus: http.StatusOK, wantBody: `"name":"a"`},
+		{name: "no conditions", path: "/api/record/get-one/", wantStatus: http.StatusBadRequest},
+		{name: "by without a value", path: "/api/record/get-one/?by=name", wantStatus: http.StatusBadRequest},
+		{name: "wrong filter field", path: "/api/record/get-one/?filter[nope]=1", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := do(t, srv, http.MethodGet, tt.path, "")
+			if status != tt.wantStatus {
+				t.Fatalf("GET %s = %d %s, want %d", tt.path, status, body, tt.wantStatus)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("GET %s body = %s, want %s", tt.path, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestHandlerGet_GetMany(t *testing.T) {
+	srv := newRecordServer(t, "a", "b", "c")
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "default limit", path: "/api/record/get-many/", wantStatus: http.StatusOK, wantBody: `"total":3,"limit":100`},
+		{name: "limit", path: "/api/record/get-many/?limit=2", wantStatus: http.StatusOK, wantBody: `"next_cursor"`},
+		{name: "filter in", path: "/api/record/get-many/?filter[name][in]=a,c", wantStatus: http.StatusOK, wantBody: `"total":2`},
+		{name: "sort", path: "/api/record/get-many/?sort=-name&limit=1", wantStatus: http.StatusOK, wantBody: `"name":"c"`},
+		{name: "wrong operator", path: "/api/record/get-many/?filter[name][nope]=a", wantStatus: http.StatusBadRequest},
+		{name: "wrong limit", path: "/api/record/get-many/?limit=x", wantStatus: http.StatusBadRequest},
+		{name: "cursor", path: "/api/record/get-many/?limit=1&cursor=" + tdatabase.EncodeCursor([]interface{}{1}, false), wantStatus: http.StatusOK, wantBody: `"name":"b"`},
+		{name: "cursor of another sort", path: "/api/record/get-many/?sort=name&cursor=" + tdatabase.EncodeCursor([]interface{}{1}, false), wantStatus: http.StatusBadRequest},
+		{name: "wrong cursor", path: "/api/record/get-many/?cursor=nope", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := do(t, srv, http.MethodGet, tt.path, "")
+			if status != tt.wantStatus {
+				t.Fatalf("GET %s = %d %s, want %d", tt.path, status, body, tt.wantStatus)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("GET %s body = %s, want %s", tt.path, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestHandlerDelete(t *testing.T) {
+	srv := newRecordServer(t, "a", "b", "c")
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "delete one", path: "/api/record/delete-one/1", wantStatus: http.StatusOK, wantBody: `[{"index":0,"item":1}]`},
+		{name: "delete the same id again", path: "/api/record/delete-one/1", wantStatus: http.StatusNotFound},
+		{name: "delete a missing id", path: "/api/record/delete-one/9", wantStatus: http.StatusNotFound},
+		{name: "delete one with a wrong id", path: "/api/record/delete-one/x", wantStatus: http.StatusBadRequest},
+		{name: "delete many without a filter", path: "/api/record/delete-many/", wantStatus: http.StatusBadRequest},
+		{name: "delete many", path: "/api/record/delete-many/?filter[name][in]=b,c", wantStatus: http.StatusOK, wantBody: `"name":"c"`},
+		{name: "nothing left", method: http.MethodGet, path: "/api/record/get-many/", wantStatus: http.StatusOK, wantBody: `"total":0`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodDelete
+			}
+			status, body := do(t, srv, method, tt.path, "")
+			if status != tt.wantStatus {
+				t.Fatalf("%s %s = %d %s, want %d", method, tt.path, status, body, tt.wantStatus)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("%s %s body = %s, want %s", method, tt.path, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestHandlerPost_AddOne(t *testing.T) {
+	srv := newRecordServer(t, "a")
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "new record", body: `{"name":"b","max":1}`, wantStatus: http.StatusOK},
+		{name: "duplicated name", body: `{"name":"a","max":1}`, wantStatus: http.StatusConflict, wantBody: `"detail":"duplicated key name","instance":"/api/record/add-one/","code":"duplicated_key"`},
+		{name: "missing required field", body: `{"max":1}`, wantStatus: http.StatusUnprocessableEntity, wantBody: `"errors":[{"field":"name","rule":"required"`},
+		{name: "malformed body", body: `{"name":`, wantStatus: http.StatusBadRequest, wantBody: `"detail":"malformed JSON body: unexpected EOF"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := do(t, srv, http.MethodPost, "/api/record/add-one/", tt.body)
+			if status != tt.wantStatus {
+				t.Fatalf("add-one = %d %s, want %d", status, body, tt.wantStatus)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("add-one body = %s, want %s", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestHandlerPost_AddMany(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantBody   []string
+		wantTotal  string
+	}{
+		{
+			name:       "every item added",
+			body:       `[{"name":"b","max":1},{"name":"c","max":1}]`,
+			wantStatus: http.StatusOK,
+			wantBody:   []string{`{"index":0,"item":{"id":2,`, `{"index":1,"item":{"id":3,`},
+			wantTotal:  `"total":3`,
+		},
+		{
+			name:       "duplicated item rolls the batch back",
+			body:       `[{"name":"b","max":1},{"name":"a","max":1},{"name":"c","max":1}]`,
+			wantStatus: http.StatusConflict,
+			wantBody: []string{
+				`"details":[`,
+				`"name":"b","min":0,"max":1},"error":"not added, the batch was rolled back"}`,
+				`{"index":1,"item":{"id":0,"name":"a","min":0,"max":1},"error":"duplicated key name"}`,
+				`"detail":"duplicated key name"`,
+				`"name":"c","min":0,"max":1},"error":"not added, the batch was rolled back"}`,
+			},
+			wantTotal: `"total":1`,
+		},
+		{name: "malformed body", body: `{"name":"b"}`, wantStatus: http.StatusBadRequest, wantTotal: `"total":1`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newRecordServer(t, "a")
+			status, body := do(t, srv, http.MethodPost, "/api/record/add-many/", tt.body)
+			if status != tt.wantStatus {
+				t.Fatalf("add-many = %d %s, want %d", status, body, tt.wantStatus)
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(body, want) {
+					t.Errorf("add-many body = %s, want %s", body, want)
+				}
+			}
+			if _, body := do(t, srv, http.MethodGet, "/api/record/get-many/", ""); !strings.Contains(body, tt.wantTotal) {
+				t.Errorf("get-many body = %s, want %s", body, tt.wantTotal)
+			}
+		})
+	}
+}
+
+// TestHandlerPost_ConcurrentRollback sends add-one requests at the same time while a hook rejects every
+// second one, the rejected requests must not undo the others.
+func TestHandlerPost_ConcurrentRollback(t *testing.T) {
+	for _, stage := range []tmodel.FunctionType{tmodel.FnBeforeSave, tmodel.FnAfterSave} {
+		t.Run(stage.String(), func(t *testing.T) {
+			model := tmodel.NewModel(&record{}, "record")
+			model.AddHook(tmodel.RouteAddOne, stage, func(ctx context.Context, e *tmodel.Event) error {
+				if e.In.(*record).Max%2 == 0 {
+					return terror.NewBadRequest("even max")
+				}
+				return nil
+			})
+			srv := newTestServer(t, tmodel.NewModels(model))
+
+			const n = 200
+			var wg sync.WaitGroup
+			statuses := make([]int, n)
+			for i := 0; i < n; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					resp, err := http.Post(srv.URL+"/api/record/add-one/", "application/json", strings.NewReader(fmt.Sprintf(`{"name":"%d","max":%d}`, i, i)))
+					if err != nil {
+						t.Errorf("http.Post() error = %v", err)
+						return
+					}
+					resp.Body.Close()
+					statuses[i] = resp.StatusCode
+				}(i)
+			}
+			wg.Wait()
+
+			succeeded := 0
+			for _, status := range statuses {
+				if status == http.StatusOK {
+					succeeded++
+				}
+			}
+			_, body := do(t, srv, http.MethodGet, "/api/record/get-many/?limit=1", "")
+			if want := fmt.Sprintf(`"total":%d`, n/2); succeeded != n/2 || !strings.Contains(body, want) {
+				t.Errorf("%d requests succeeded and get-many = %s, want %d and %s", succeeded, body, n/2, want)
+			}
+		})
+	}
+}
+
+func TestHandlerPut_Update(t *testing.T) {
+	srv := newRecordServer(t, "a", "b")
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+		wantStored string
+	}{
+		{name: "partial update", path: "/api/record/update/1", body: `{"min":5}`, wantStatus: http.StatusOK, wantStored: `"name":"a","min":5,"max":10`},
+		{name: "partial update breaking a stored field", path: "/api/record/update/1", body: `{"min":500}`, wantStatus: http.StatusUnprocessableEntity, wantBody: `"field":"min","rule":"ltefield"`, wantStored: `"min":5,"max":10`},
+		{name: "both fields of the rule", path: "/api/record/update/1", body: `{"min":500,"max":600}`, wantStatus: http.StatusOK, wantStored: `"min":500,"max":600`},
+		{name: "duplicated name", path: "/api/record/update/2", body: `{"name":"a"}`, wantStatus: http.StatusConflict},
+		{name: "missing record", path: "/api/record/update/9", body: `{"min":1}`, wantStatus: http.StatusNotFound},
+		{name: "malformed body", path: "/api/record/update/1", body: `{"min":`, wantStatus: http.StatusBadRequest, wantBody: `"detail":"malformed JSON body: unexpected EOF"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := do(t, srv, http.MethodPut, tt.path, tt.body)
+			if status != tt.wantStatus {
+				t.Fatalf("PUT %s = %d %s, want %d", tt.path, status, body, tt.wantStatus)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("PUT %s body = %s, want %s", tt.path, body, tt.wantBody)
+			}
+			if _, body := do(t, srv, http.MethodGet, "/api/record/get-one/1", ""); !strings.Contains(body, tt.wantStored) {
+				t.Errorf("get-one = %s, want %s", body, tt.wantStored)
+			}
+		})
+	}
+}
+
+type label struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestHandler_StringKey(t *testing.T) {
+	models := tmodel.NewModels(tmodel.NewModel(&label{}, "label"))
+	db := sqlite.New(tconfig.SQLite{}, models)
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	for _, model := range models.All {
+		model.Store = db
+	}
+	srv := httptest.NewServer(NewHttpApi(models, WithDatabase(db)).GetHandler(tconfig.Cors{}))
+	t.Cleanup(srv.Close)
+
+	id := "3f1c2a9e-7b4d-4c2e-9a51-0d6f8e2b7c10"
+	if status, body := do(t, srv, http.MethodPost, "/api/label/add-one/", `{"id":"`+id+`","name":"a"}`); status != http.StatusOK {
+		t.Fatalf("add-one = %d %s", status, body)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "update", method: http.MethodPut, path: "/api/label/update/" + id, body: `{"name":"b"}`, wantStatus: http.StatusOK},
+		{name: "updated", method: http.MethodGet, path: "/api/label/get-one/" + id, wantStatus: http.StatusOK, wantBody: `"name":"b"`},
+		{name: "update a missing id", method: http.MethodPut, path: "/api/label/update/nope", body: `{"name":"c"}`, wantStatus: http.StatusNotFound},
+		{name: "delete", method: http.MethodDelete, path: "/api/label/delete-one/" + id, wantStatus: http.StatusOK, wantBody: `"item":"` + id + `"`},
+		{name: "delete again", method: http.MethodDelete, path: "/api/label/delete-one/" + id, wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := do(t, srv, tt.method, tt.path, tt.body)
+			if status != tt.wantStatus {
+				t.Fatalf("%s %s = %d %s, want %d", tt.method, tt.path, status, body, tt.wantStatus)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("%s %s body = %s, want %s", tt.method, tt.path, body, tt.wantBody)
+			}
+		})
+	}
+}
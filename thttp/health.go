@@ -0,0 +1,146 @@
+package thttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CheckTimeout bounds every health check of a probe.
+var CheckTimeout = 5 * time.Second
+
+// Check reports a problem of a subsystem, nil means healthy.
+type Check func(ctx context.Context) error
+
+// Health holds the checks behind /healthz and /readyz. Liveness checks fail only when the process must be
+// restarted, readiness checks also fail while a dependency such as the database is unavailable.
+type Health struct {
+	Liveness  map[string]Check
+	Readiness map[string]Check
+}
+
+type CheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+const (
+	statusOK   = "ok"
+	statusFail = "fail"
+)
+
+// WithHealthCheck adds a readiness check served by /readyz.
+func WithHealthCheck(name string, check Check) func(*HttpAPI) {
+	return func(api *HttpAPI) {
+		if api.Health.Readiness == nil {
+			api.Health.Readiness = map[string]Check{}
+		}
+		api.Health.Readiness[name] = check
+	}
+}
+
+// WithLivenessCheck adds a liveness check served by /healthz, readiness includes it as well.
+func WithLivenessCheck(name string, check Check) func(*HttpAPI) {
+	return func(api *HttpAPI) {
+		if api.Health.Liveness == nil {
+			api.Health.Liveness = map[string]Check{}
+		}
+		api.Health.Liveness[name] = check
+	}
+}
+
+// HandlerHealthz answers the liveness probe.
+func (a *HttpAPI) HandlerHealthz(w http.ResponseWriter, r *http.Request) {
+	a.writeHealth(w, r, a.Health.Liveness)
+}
+
+// HandlerReadyz answers the readiness probe with the database ping, the liveness and the added checks.
+func (a *HttpAPI) HandlerReadyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]Check{}
+	if a.Database != nil {
+		checks["database"] = a.Database.Ping
+	}
+	for name, check := range a.Health.Liveness {
+		checks[name] = check
+	}
+	for name, check := range a.Health.Readiness {
+		checks[name] = check
+	}
+	a.writeHealth(w, r, checks)
+}
+
+func (a *HttpAPI) writeHealth(w http.ResponseWriter, r *http.Request, checks map[string]Check) {
+	report := RunChecks(r.Context(), checks)
+	status := http.StatusOK
+	if report.Status != statusOK {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+// RunChecks runs checks concurrently, each bounded by CheckTimeout.
+func RunChecks(ctx context.Context, checks map[string]Check) HealthReport {
+	report := HealthReport{Status: statusOK, Checks: make(map[string]CheckResult, len(checks))}
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			result := runCheck(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if result.Status != statusOK {
+				report.Status = statusFail
+			}
+		}(name, check)
+	}
+	wg.Wait()
+	return report
+}
+
+func runCheck(ctx context.Context, check Check) (result CheckResult) {
+	ctx, cancel := context.WithTimeout(ctx, CheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				done <- fmt.Errorf("panic: %v", rec)
+			}
+		}()
+		done <- check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result = CheckResult{Status: statusOK, Duration: time.Since(start).String()}
+	if err != nil {
+		result.Status, result.Error = statusFail, err.Error()
+	}
+	return result
+}
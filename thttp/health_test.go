@@ -0,0 +1,88 @@
+package thttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WojciechWiderski/tofu/tmodel"
+)
+
+func TestHealth(t *testing.T) {
+	ok := func(ctx context.Context) error { return nil }
+	failing := func(ctx context.Context) error { return errors.New("queue down") }
+
+	tests := []struct {
+		name       string
+		opts       []func(*HttpAPI)
+		path       string
+		wantStatus int
+		wantBody   []string
+	}{
+		{name: "liveness without checks", path: "/healthz", wantStatus: http.StatusOK, wantBody: []string{`"status":"ok","checks":{}`}},
+		{name: "readiness pings the database", path: "/readyz", wantStatus: http.StatusOK, wantBody: []string{`"database":{"status":"ok"`}},
+		{
+			name:       "failing readiness check",
+			opts:       []func(*HttpAPI){WithHealthCheck("queue", failing)},
+			path:       "/readyz",
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   []string{`"status":"fail"`, `"queue":{"status":"fail","error":"queue down"`},
+		},
+		{
+			name:       "failing readiness check keeps the process alive",
+			opts:       []func(*HttpAPI){WithHealthCheck("queue", failing)},
+			path:       "/healthz",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "liveness checks are part of the readiness",
+			opts:       []func(*HttpAPI){WithLivenessCheck("loop", failing), WithHealthCheck("queue", ok)},
+			path:       "/readyz",
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   []string{`"loop":{"status":"fail"`, `"queue":{"status":"ok"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, tmodel.NewModels(tmodel.NewModel(&record{}, "record")), tt.opts...)
+			status, body := do(t, srv, http.MethodGet, tt.path, "")
+			if status != tt.wantStatus {
+				t.Fatalf("GET %s = %d %s, want %d", tt.path, status, body, tt.wantStatus)
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(body, want) {
+					t.Errorf("GET %s body = %s, want %s", tt.path, body, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunChecks(t *testing.T) {
+	timeout := CheckTimeout
+	CheckTimeout = 20 * time.Millisecond
+	t.Cleanup(func() { CheckTimeout = timeout })
+
+	tests := []struct {
+		name      string
+		check     Check
+		wantError string
+	}{
+		{name: "ok", check: func(ctx context.Context) error { return nil }},
+		{name: "error", check: func(ctx context.Context) error { return errors.New("down") }, wantError: "down"},
+		{name: "panic", check: func(ctx context.Context) error { panic("boom") }, wantError: "panic: boom"},
+		{name: "timeout", check: func(ctx context.Context) error { time.Sleep(time.Second); return nil }, wantError: context.DeadlineExceeded.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := RunChecks(context.Background(), map[string]Check{tt.name: tt.check})
+			result := report.Checks[tt.name]
+			if result.Error != tt.wantError || (tt.wantError == "") != (report.Status == statusOK) {
+				t.Errorf("RunChecks() = %+v, want error %q", report, tt.wantError)
+			}
+		})
+	}
+}
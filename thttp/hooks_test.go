@@ -0,0 +1,199 @@
+package thttp
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/WojciechWiderski/tofu/tdatabase"
+	"github.com/WojciechWiderski/tofu/terror"
+	"github.com/WojciechWiderski/tofu/tmodel"
+)
+
+// hookLog records the hooks that ran, the routes of a server run one at a time in the tests.
+type hookLog struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (l *hookLog) hook(name string, err error) tmodel.Hook {
+	return func(ctx context.Context, e *tmodel.Event) error {
+		l.mu.Lock()
+		l.names = append(l.names, name)
+		l.mu.Unlock()
+		return err
+	}
+}
+
+func (l *hookLog) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return strings.Join(l.names, ",")
+}
+
+func TestHooks(t *testing.T) {
+	tests := []struct {
+		name       string
+		setup      func(m *tmodel.Model, log *hookLog)
+		body       string
+		wantStatus int
+		wantBody   string
+		wantLog    string
+		wantTotal  string
+	}{
+		{
+			name: "stage order",
+			setup: func(m *tmodel.Model, log *hookLog) {
+				m.AddHook(tmodel.RouteAddOne, tmodel.FnBeforeRespond, log.hook("before-respond", nil)).
+					AddHook(tmodel.RouteAddOne, tmodel.FnAfterCommit, log.hook("after-commit", nil)).
+					AddHook(tmodel.RouteAddOne, tmodel.FnAfterSave, log.hook("after-save", nil)).
+					AddHook(tmodel.RouteAddOne, tmodel.FnBeforeSave, log.hook("before-save", nil)).
+					AddHook(tmodel.RouteAddOne, tmodel.FnBeforeValidate, log.hook("before-validate", nil))
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    "before-validate,before-save,after-save,after-commit,before-respond",
+			wantTotal:  `"total":1`,
+		},
+		{
+			name: "chain order",
+			setup: func(m *tmodel.Model, log *hookLog) {
+				m.AddHook(tmodel.RouteAddOne, tmodel.FnBeforeSave, log.hook("first", nil)).
+					AddHook(tmodel.RouteAll, tmodel.FnBeforeSave, log.hook("all", nil)).
+					AddHook(tmodel.RouteAddOne, tmodel.FnBeforeSave, log.hook("second", nil)).
+					AddHook(tmodel.RouteUpdate, tmodel.FnBeforeSave, log.hook("update", nil))
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    "all,first,second",
+			wantTotal:  `"total":1`,
+		},
+		{
+			name: "mutate entity",
+			setup: func(m *tmodel.Model, log *hookLog) {
+				m.AddHook(tmodel.RouteAddOne, tmodel.FnBeforeValidate, func(ctx context.Context, e *tmodel.Event) error {
+					e.In.(*record).Name = strings.ToUpper(e.In.(*record).Name)
+					return nil
+				})
+			},
+			wantStatus: http.StatusOK,
+			wantTotal:  `"name":"A"`,
+		},
+		{
+			name: "reject before save",
+			setup: func(m *tmodel.Model, log *hookLog) {
+				m.AddHook(tmodel.RouteAddOne, tmodel.FnBeforeSave, log.hook("reject", terror.NewConflict("rejected"))).
+					AddHook(tmodel.RouteAddOne, tmodel.FnBeforeSave, log.hook("skipped", nil))
+			},
+			wantStatus: http.StatusConflict,
+			wantBody:   "rejected",
+			wantLog:    "reject",
+			wantTotal:  `"total":0`,
+		},
+		{
+			name: "reject after save rolls back",
+			setup: func(m *tmodel.Model, log *hookLog) {
+				m.AddHook(tmodel.RouteAddOne, tmodel.FnAfterSave, func(ctx context.Context, e *tmodel.Event) error {
+					if err := e.DB.Add(ctx, &record{Name: "audit", Max: 1}); err != nil {
+						return err
+					}
+					return terror.NewBadRequest("rejected")
+				})
+			},
+			wantStatus: http.StatusBadRequest,
+			wantTotal:  `"total":0`,
+		},
+		{
+			name: "hook writes in the route transaction",
+			setup: func(m *tmodel.Model, log *hookLog) {
+				m.AddHook(tmodel.RouteAddOne, tmodel.FnAfterSave, func(ctx context.Context, e *tmodel.Event) error {
+					return e.DB.Add(ctx, &record{Name: "audit", Max: 1})
+				})
+			},
+			wantStatus: http.StatusOK,
+			wantTotal:  `"total":2`,
+		},
+		{
+			name: "reject after commit keeps the write",
+			setup: func(m *tmodel.Model, log *hookLog) {
+				m.AddHook(tmodel.RouteAddOne, tmodel.FnAfterCommit, log.hook("after-commit", terror.NewBadRequest("too late"))).
+					AddHook(tmodel.RouteAddOne, tmodel.FnBeforeRespond, log.hook("before-respond", nil))
+			},
+			wantStatus: http.StatusBadRequest,
+			wantLog:    "after-commit",
+			wantTotal:  `"total":1`,
+		},
+		{
+			name: "stop before save",
+			setup: func(m *tmodel.Model, log *hookLog) {
+				m.AddHook(tmodel.RouteAddOne, tmodel.FnBeforeSave, func(ctx context.Context, e *tmodel.Event) error {
+					e.Response = map[string]string{"status": "queued"}
+					return tmodel.ErrStop
+				}).AddHook(tmodel.RouteAddOne, tmodel.FnAfterSave, log.hook("after-save", nil))
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"status":"queued"}`,
+			wantTotal:  `"total":0`,
+		},
+		{
+			name: "stop after save commits",
+			setup: func(m *tmodel.Model, log *hookLog) {
+				m.AddHook(tmodel.RouteAddOne, tmodel.FnAfterSave, log.hook("after-save", tmodel.ErrStop)).
+					AddHook(tmodel.RouteAddOne, tmodel.FnAfterCommit, log.hook("after-commit", nil))
+			},
+			wantStatus: http.StatusOK,
+			wantLog:    "after-save",
+			wantTotal:  `"total":1`,
+		},
+		{
+			name: "replace response",
+			setup: func(m *tmodel.Model, log *hookLog) {
+				m.AddHook(tmodel.RouteAddOne, tmodel.FnBeforeRespond, func(ctx context.Context, e *tmodel.Event) error {
+					e.Response = map[string]string{"name": e.In.(*record).Name}
+					return nil
+				})
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"name":"a"}`,
+			wantTotal:  `"total":1`,
+		},
+		{
+			name: "former signature",
+			setup: func(m *tmodel.Model, log *hookLog) {
+				m.AddFunc(tmodel.RouteAddOne, tmodel.FnBeforeDBO, func(ctx context.Context, db tdatabase.DBOperations) (interface{}, error) {
+					return &record{Name: "replaced", Max: 1}, nil
+				}).AddFunc(tmodel.RouteAddOne, tmodel.FnBeforeDBO, func(ctx context.Context, db tdatabase.DBOperations) (interface{}, error) {
+					return nil, nil
+				})
+			},
+			wantStatus: http.StatusOK,
+			wantTotal:  `"name":"replaced"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := &hookLog{}
+			model := tmodel.NewModel(&record{}, "record")
+			tt.setup(model, log)
+			srv := newTestServer(t, tmodel.NewModels(model))
+
+			body := tt.body
+			if body == "" {
+				body = `{"name":"a","max":10}`
+			}
+			status, got := do(t, srv, http.MethodPost, "/api/record/add-one/", body)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", status, tt.wantStatus, got)
+			}
+			if !strings.Contains(got, tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", got, tt.wantBody)
+			}
+			if tt.wantLog != "" && log.String() != tt.wantLog {
+				t.Errorf("hooks = %s, want %s", log.String(), tt.wantLog)
+			}
+			if _, list := do(t, srv, http.MethodGet, "/api/record/get-many/", ""); !strings.Contains(list, tt.wantTotal) {
+				t.Errorf("get-many = %s, want it to contain %s", list, tt.wantTotal)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package thttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/WojciechWiderski/tofu/tconfig"
+	"github.com/WojciechWiderski/tofu/tdatabase/sqlite"
+	"github.com/WojciechWiderski/tofu/tmodel"
+)
+
+type author struct {
+	ID    uint   `json:"id"`
+	Name  string `json:"name"`
+	Books []book `json:"books"`
+}
+
+type book struct {
+	ID       uint    `json:"id"`
+	Title    string  `json:"title"`
+	AuthorID uint    `json:"author_id"`
+	Author   *author `json:"author,omitempty"`
+}
+
+func TestParamsFromQuery_Include(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "none", query: "", want: ""},
+		{name: "comma separated", query: "include=books,author", want: "books|author"},
+		{name: "repeated", query: "include=books&include=author.books", want: "books|author.books"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("url.ParseQuery() error = %v", err)
+			}
+			params, err := paramsFromQuery(query)
+			if err != nil {
+				t.Fatalf("paramsFromQuery() error = %v", err)
+			}
+			if got := strings.Join(params.Include, "|"); got != tt.want {
+				t.Errorf("Include = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerGet_Include(t *testing.T) {
+	models := tmodel.NewModels(tmodel.NewModel(&author{}, "author"), tmodel.NewModel(&book{}, "book"))
+	db := sqlite.New(tconfig.SQLite{Path: filepath.Join(t.TempDir(), "test.db")}, models)
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	for _, model := range models.All {
+		model.Store = db
+	}
+	srv := httptest.NewServer(NewHttpApi(models, WithDatabase(db)).GetHandler(tconfig.Cors{}))
+	t.Cleanup(srv.Close)
+
+	for _, add := range []struct{ path, body string }{
+		{"/api/author/add-one/", `{"name":"ann"}`},
+		{"/api/book/add-one/", `{"title":"first","author_id":1}`},
+		{"/api/book/add-one/", `{"title":"second","author_id":1}`},
+	} {
+		if status, body := do(t, srv, http.MethodPost, add.path, add.body); status != http.StatusOK {
+			t.Fatalf("POST %s = %d %s", add.path, status, body)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "without include", path: "/api/author/get-one/1", wantStatus: http.StatusOK, wantBody: `"books":null`},
+		{name: "has many", path: "/api/author/get-one/1?include=books", wantStatus: http.StatusOK, wantBody: `"title":"second"`},
+		{name: "get many", path: "/api/author/get-many/?include=books", wantStatus: http.StatusOK, wantBody: `"title":"first"`},
+		{name: "belongs to", path: "/api/book/get-many/?include=author", wantStatus: http.StatusOK, wantBody: `"author":{"id":1,"name":"ann"`},
+		{name: "nested", path: "/api/book/get-one/2?include=author.books", wantStatus: http.StatusOK, wantBody: `"books":[{"id":1`},
+		{name: "unknown relation", path: "/api/author/get-one/1?include=reviews", wantStatus: http.StatusBadRequest, wantBody: "no relation reviews"},
+		{name: "too deep", path: "/api/book/get-one/1?include=author.books.author", wantStatus: http.StatusBadRequest, wantBody: "deeper than 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := do(t, srv, http.MethodGet, tt.path, "")
+			if status != tt.wantStatus {
+				t.Fatalf("GET %s = %d %s, want %d", tt.path, status, body, tt.wantStatus)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("GET %s body = %s, want it to contain %s", tt.path, body, tt.wantBody)
+			}
+		})
+	}
+}
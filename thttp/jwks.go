@@ -0,0 +1,193 @@
+package thttp
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/WojciechWiderski/tofu/terror"
+)
+
+// jwksMinRefresh limits refetching the set for an unknown kid.
+const jwksMinRefresh = time.Minute
+
+// jwksFailureBackoff limits refetching the set after a failed fetch.
+const jwksFailureBackoff = 10 * time.Second
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	K   string `json:"k"`
+}
+
+// jwks caches the keys of a JSON Web Key Set read from a URL or a file. Concurrent refetches share one
+// request and the lock is not held during it.
+type jwks struct {
+	source  string
+	refresh time.Duration
+	client  *http.Client
+	group   singleflight.Group
+
+	mu       sync.Mutex
+	keys     map[string]interface{}
+	fetched  time.Time
+	failed   time.Time
+	fetchErr error
+}
+
+func newJWKS(source string, refresh time.Duration) *jwks {
+	return &jwks{source: source, refresh: refresh, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// key returns the key of kid, it refetches the set once it is older than refresh or, rate limited, when
+// kid is unknown. After a failed fetch the cached key, if any, is used until jwksFailureBackoff passes.
+func (j *jwks) key(ctx context.Context, kid string) (interface{}, error) {
+	j.mu.Lock()
+	age := time.Since(j.fetched)
+	key, ok := j.keys[kid]
+	loaded := j.keys != nil
+	backoff := time.Since(j.failed) < jwksFailureBackoff
+	fetchErr := j.fetchErr
+	j.mu.Unlock()
+
+	switch {
+	case ok && (j.refresh <= 0 || age < j.refresh):
+		return key, nil
+	case loaded && !ok && age < jwksMinRefresh:
+		return nil, terror.NewUnauthorized(fmt.Sprintf("unknown key id %q", kid))
+	case backoff && ok:
+		return key, nil
+	case backoff:
+		return nil, terror.Wrap("j.fetch - backing off", fetchErr)
+	}
+
+	// The fetch is shared by the waiting callers, so it does not end with the context of the first one.
+	_, err, _ := j.group.Do(j.source, func() (interface{}, error) {
+		keys, err := j.fetch(context.WithoutCancel(ctx))
+
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if err != nil {
+			j.failed, j.fetchErr = time.Now(), err
+			return nil, err
+		}
+		j.keys, j.fetched, j.failed, j.fetchErr = keys, time.Now(), time.Time{}, nil
+		return nil, nil
+	})
+	if err != nil {
+		if ok {
+			return key, nil
+		}
+		return nil, terror.Wrap("j.fetch", err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if key, ok = j.keys[kid]; !ok {
+		return nil, terror.NewUnauthorized(fmt.Sprintf("unknown key id %q", kid))
+	}
+	return key, nil
+}
+
+func (j *jwks) fetch(ctx context.Context) (map[string]interface{}, error) {
+	var (
+		body []byte
+		err  error
+	)
+	if strings.HasPrefix(j.source, "http://") || strings.HasPrefix(j.source, "https://") {
+		body, err = j.get(ctx)
+	} else {
+		body, err = os.ReadFile(strings.TrimPrefix(j.source, "file://"))
+	}
+	if err != nil {
+		return nil, terror.NewInternalf("read jwks", err)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &set); err != nil {
+		return nil, terror.NewInternalf("json.Unmarshal jwks", err)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, terror.Wrap(fmt.Sprintf("key %q", k.Kid), err)
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func (j *jwks) get(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBase64URL(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBase64URL(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, terror.NewBadRequest(fmt.Sprintf("unsupported curve %s", k.Crv))
+		}
+		x, err := decodeBase64URL(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, terror.NewBadRequest("wrong Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	case "oct":
+		return decodeBase64URL(k.K)
+	}
+	return nil, terror.NewBadRequest(fmt.Sprintf("unsupported key type %s", k.Kty))
+}
+
+func decodeBase64URL(s string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, terror.Newf(terror.BadRequest, "base64", err)
+	}
+	return b, nil
+}
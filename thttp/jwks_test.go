@@ -0,0 +1,143 @@
+package thttp
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/WojciechWiderski/tofu/terror"
+)
+
+// jwksServer serves a set with the Ed25519 key "a", failing while fail is set. Requests wait for release
+// when it is not nil.
+type jwksServer struct {
+	*httptest.Server
+	requests atomic.Int32
+	fail     atomic.Bool
+	release  chan struct{}
+}
+
+func newJWKSServer(t *testing.T, release chan struct{}) *jwksServer {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey() error = %v", err)
+	}
+	body := fmt.Sprintf(`{"keys":[{"kty":"OKP","crv":"Ed25519","kid":"a","x":"%s"}]}`, base64.RawURLEncoding.EncodeToString(pub))
+
+	s := &jwksServer{release: release}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		if s.release != nil {
+			<-s.release
+		}
+		if s.fail.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestJWKS_Key(t *testing.T) {
+	tests := []struct {
+		name         string
+		kid          string
+		fail         bool
+		refresh      time.Duration
+		fetched      time.Duration
+		failed       time.Duration
+		cached       bool
+		wantRequests int32
+		wantKind     terror.Kind
+	}{
+		{name: "first fetch", kid: "a", wantRequests: 1},
+		{name: "cached key", kid: "a", cached: true, fetched: time.Second, wantRequests: 0},
+		{name: "stale key is refetched", kid: "a", cached: true, refresh: time.Minute, fetched: 2 * time.Minute, wantRequests: 1},
+		{name: "unknown kid is rate limited", kid: "b", cached: true, fetched: time.Second, wantRequests: 0, wantKind: terror.Unauthorized},
+		{name: "unknown kid after the rate limit", kid: "b", cached: true, fetched: 2 * jwksMinRefresh, wantRequests: 1, wantKind: terror.Unauthorized},
+		{name: "failed fetch", kid: "a", fail: true, wantRequests: 1, wantKind: terror.Internal},
+		{name: "failed fetch keeps the stale key", kid: "a", fail: true, cached: true, refresh: time.Minute, fetched: 2 * time.Minute, wantRequests: 1},
+		{name: "backoff after a failure", kid: "a", failed: time.Second, wantRequests: 0, wantKind: terror.Internal},
+		{name: "backoff keeps the stale key", kid: "a", cached: true, refresh: time.Minute, fetched: 2 * time.Minute, failed: time.Second, wantRequests: 0},
+		{name: "backoff passed", kid: "a", failed: 2 * jwksFailureBackoff, wantRequests: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newJWKSServer(t, nil)
+			j := newJWKS(srv.URL, tt.refresh)
+			if tt.cached {
+				if _, err := j.key(context.Background(), "a"); err != nil {
+					t.Fatalf("key() error = %v", err)
+				}
+				j.fetched = time.Now().Add(-tt.fetched)
+				srv.requests.Store(0)
+			}
+			if tt.failed > 0 {
+				j.failed, j.fetchErr = time.Now().Add(-tt.failed), errors.New("down")
+			}
+			srv.fail.Store(tt.fail)
+
+			key, err := j.key(context.Background(), tt.kid)
+			if tt.wantKind != (terror.Kind{}) {
+				if !errors.Is(err, tt.wantKind) {
+					t.Errorf("key() error = %v, want %s", err, tt.wantKind)
+				}
+			} else if err != nil || key == nil {
+				t.Errorf("key() = %v, %v, want a key", key, err)
+			}
+			if got := srv.requests.Load(); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+// TestJWKS_KeyConcurrent checks that concurrent callers share one fetch and a canceled caller does not
+// fail the others.
+func TestJWKS_KeyConcurrent(t *testing.T) {
+	release := make(chan struct{})
+	srv := newJWKSServer(t, release)
+	j := newJWKS(srv.URL, 0)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	const n = 50
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx := context.Background()
+			if i == 0 {
+				ctx = canceled
+			}
+			_, errs[i] = j.key(ctx, "a")
+		}(i)
+	}
+	for srv.requests.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	close(release)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("key() %d error = %v", i, err)
+		}
+	}
+	if got := srv.requests.Load(); got != 1 {
+		t.Errorf("requests = %d, want 1", got)
+	}
+}
@@ -2,13 +2,25 @@ package thttp
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/WojciechWiderski/tofu/tcontext"
 	"github.com/WojciechWiderski/tofu/terror"
+	"github.com/WojciechWiderski/tofu/tlogger"
+	"github.com/WojciechWiderski/tofu/tmetrics"
 	"github.com/WojciechWiderski/tofu/tmodel"
+	"github.com/WojciechWiderski/tofu/ttrace"
 )
 
 func ModelMiddleware(models *tmodel.Models) func(next http.Handler) http.Handler {
@@ -17,15 +29,16 @@ func ModelMiddleware(models *tmodel.Models) func(next http.Handler) http.Handler
 			ctx := r.Context()
 			for _, model := range models.All {
 
-				modelName := chi.URLParam(r, "tmodel")
-				if model.Name == modelName {
+				modelName := chi.URLParam(r, "model")
+				if model.Name == modelName && !model.Internal {
+					ctx = tlogger.ContextWith(ctx, slog.String(tlogger.KeyModel, model.Name))
 					r = r.WithContext(context.WithValue(ctx, tcontext.ModelCtxKey, model))
 					next.ServeHTTP(w, r)
 					return
 				}
 			}
 
-			terror.HandleError(w, r, terror.NewBadRequest("wrong path - model"))
+			terror.HandleError(w, r, terror.NewNotFound("wrong path - model"))
 		})
 	}
 }
@@ -37,6 +50,7 @@ func RouteTypeMiddleware() func(next http.Handler) http.Handler {
 			routeType := tmodel.NewRouteType(chi.URLParam(r, "route-type"))
 
 			if routeType != tmodel.WrongRtType {
+				ctx = tlogger.ContextWith(ctx, slog.String(tlogger.KeyRouteType, routeType.String()))
 				r = r.WithContext(context.WithValue(ctx, tcontext.RouteTypeCtxKey, routeType))
 				next.ServeHTTP(w, r)
 				return
@@ -56,3 +70,121 @@ func PatternMiddleware() func(next http.Handler) http.Handler {
 		})
 	}
 }
+
+// RequestIDHeaderMiddleware echoes the request id set by middleware.RequestID and adds it to the log
+// context, so a client can match a problem response with the server log.
+func RequestIDHeaderMiddleware() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if id := middleware.GetReqID(r.Context()); id != "" {
+				w.Header().Set(middleware.RequestIDHeader, id)
+				r = r.WithContext(tlogger.ContextWith(r.Context(), slog.String(tlogger.KeyRequestID, id)))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RecoverMiddleware turns a panic in a handler into an Internal problem response.
+func RecoverMiddleware() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				rec := recover()
+				if rec == nil || rec == http.ErrAbortHandler {
+					if rec != nil {
+						panic(rec)
+					}
+					return
+				}
+				terror.HandleError(w, r, terror.NewInternalf("panic", fmt.Errorf("%v", rec)))
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// LoggerMiddleware logs every request with its status and duration through tlogger.
+func LoggerMiddleware() func(next http.Handler) http.Handler {
+	log := tlogger.Logger("thttp")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			log.InfoContext(r.Context(), fmt.Sprintf("%s %s", r.Method, r.URL.Path),
+				slog.Int("status", status),
+				slog.Int("bytes", ww.BytesWritten()),
+				slog.Duration("duration", time.Since(start)),
+			)
+		})
+	}
+}
+
+// MetricsMiddleware records the count and the latency of every request, the model label is set for
+// registered models only to keep the label values bounded.
+func MetricsMiddleware(models *tmodel.Models) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			var route, modelName, routeType string
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				route = rctx.RoutePattern()
+				if model := models.Get(rctx.URLParam("model")); model != nil {
+					modelName = model.Name
+					routeType = tmodel.NewRouteType(rctx.URLParam("route-type")).String()
+				}
+			}
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			tmetrics.ObserveHTTP(r.Method, route, modelName, routeType, status, start)
+		})
+	}
+}
+
+// TracingMiddleware starts a server span for every request, continuing the trace of a W3C traceparent
+// header. The span is named by the route once chi has matched it.
+func TracingMiddleware() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := ttrace.Start(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer))
+			defer span.End()
+			span.SetAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+			)
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			if rctx := chi.RouteContext(ctx); rctx != nil {
+				if route := rctx.RoutePattern(); route != "" {
+					span.SetName(r.Method + " " + route)
+					span.SetAttributes(semconv.HTTPRoute(route))
+				}
+				if model := rctx.URLParam("model"); model != "" {
+					span.SetAttributes(ttrace.AttrModel.String(model), ttrace.AttrRouteType.String(rctx.URLParam("route-type")))
+				}
+			}
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+		})
+	}
+}
@@ -0,0 +1,410 @@
+package thttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/WojciechWiderski/tofu/tmodel"
+)
+
+type OpenAPI struct {
+	Title   string
+	Version string
+	// UI serves a Redoc page rendering the document at /api/docs.
+	UI bool
+}
+
+func WithOpenAPI(title string, version string, ui bool) func(*HttpAPI) {
+	return func(api *HttpAPI) {
+		api.OpenAPI = OpenAPI{Title: title, Version: version, UI: ui}
+	}
+}
+
+type schemas map[string]interface{}
+
+// OpenAPIDocument describes every registered model with its generic routes and custom routes as OpenAPI 3.1.
+func (a *HttpAPI) OpenAPIDocument() map[string]interface{} {
+	title, version := a.OpenAPI.Title, a.OpenAPI.Version
+	if title == "" {
+		title = "Tofu API"
+	}
+	if version == "" {
+		version = "1.0.0"
+	}
+
+	components := schemas{}
+	paths := map[string]interface{}{}
+	for _, model := range a.Models.All {
+		if model.Internal {
+			continue
+		}
+		ref := components.add(reflect.TypeOf(model.In))
+		for path, item := range modelPaths(model, ref) {
+			paths[path] = item
+		}
+	}
+	components["Error"] = problemSchema
+
+	doc := map[string]interface{}{
+		"openapi": "3.1.0",
+		"info":    map[string]interface{}{"title": title, "version": version},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": components,
+		},
+	}
+	if a.Auth != nil || a.APIKeys != nil {
+		a.documentAuth(doc, paths)
+	}
+	return doc
+}
+
+// documentAuth adds the bearer and the api key schemes, required globally or on the operations of the
+// auth scopes.
+func (a *HttpAPI) documentAuth(doc map[string]interface{}, paths map[string]interface{}) {
+	securitySchemes := map[string]interface{}{}
+	var security []interface{}
+	if a.Auth != nil {
+		securitySchemes["bearerAuth"] = map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"}
+		security = append(security, map[string]interface{}{"bearerAuth": []string{}})
+	}
+	if a.APIKeys != nil {
+		securitySchemes["apiKeyAuth"] = map[string]interface{}{"type": "apiKey", "in": "header", "name": APIKeyHeader}
+		security = append(security, map[string]interface{}{"apiKeyAuth": []string{}})
+	}
+	doc["components"].(map[string]interface{})["securitySchemes"] = securitySchemes
+	if a.Auth == nil || a.Auth.Global() {
+		doc["security"] = security
+		return
+	}
+
+	for path, item := range paths {
+		// paths are /api/{model}/{route-type}/...
+		parts := strings.Split(path, "/")
+		if len(parts) < 4 || !a.Auth.Required(parts[2], tmodel.NewRouteType(parts[3])) {
+			continue
+		}
+		for _, op := range item.(map[string]interface{}) {
+			op.(map[string]interface{})["security"] = security
+		}
+	}
+}
+
+func (a *HttpAPI) HandlerOpenAPI(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	return a.OpenAPIDocument(), nil
+}
+
+func (a *HttpAPI) HandlerDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = fmt.Fprintf(w, docsPage, a.OpenAPI.Title)
+}
+
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+	<title>%s</title>
+	<meta charset="utf-8"/>
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+</head>
+<body>
+	<redoc spec-url="/api/openapi.json"></redoc>
+	<script src="https://cdn.redoc.ly/redoc/latest/bundles/redoc.standalone.js"></script>
+</body>
+</html>
+`
+
+func modelPaths(model *tmodel.Model, ref map[string]interface{}) map[string]interface{} {
+	base := fmt.Sprintf("/api/%s", model.Name)
+	tag := []string{model.Name}
+	array := func(items interface{}) map[string]interface{} {
+		return map[string]interface{}{"type": "array", "items": items}
+	}
+	results := array(map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"index": map[string]interface{}{"type": "integer"},
+			"item":  ref,
+			"error": map[string]interface{}{"type": "string"},
+		},
+	})
+	page := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"items":       array(ref),
+			"total":       map[string]interface{}{"type": "integer"},
+			"limit":       map[string]interface{}{"type": "integer"},
+			"offset":      map[string]interface{}{"type": "integer"},
+			"next_cursor": map[string]interface{}{"type": "string"},
+			"prev_cursor": map[string]interface{}{"type": "string"},
+		},
+	}
+	idParam := []interface{}{pathParam("id", "Record id.")}
+
+	paths := map[string]interface{}{
+		base + "/" + tmodel.RouteGetOne.String() + "/": map[string]interface{}{
+			"get": operation(tag, "Get one "+model.Name+" matching the by or filter params", append(filterParams(false), includeParam), nil, ref),
+		},
+		base + "/" + tmodel.RouteGetOne.String() + "/{id}": map[string]interface{}{
+			"get": operation(tag, "Get one "+model.Name+" by id", append(idParam, includeParam), nil, ref),
+		},
+		base + "/" + tmodel.RouteGetMany.String() + "/": map[string]interface{}{
+			"get": operation(tag, "Get many "+model.Name, append(filterParams(true), includeParam), nil, page),
+		},
+		base + "/" + tmodel.RouteAddOne.String() + "/": map[string]interface{}{
+			"post": operation(tag, "Add one "+model.Name, nil, ref, nil),
+		},
+		base + "/" + tmodel.RouteAddMany.String() + "/": map[string]interface{}{
+			"post": operation(tag, "Add many "+model.Name, nil, array(ref), results),
+		},
+		base + "/" + tmodel.RouteUpdate.String() + "/{id}": map[string]interface{}{
+			"put": operation(tag, "Update "+model.Name, idParam, ref, nil),
+		},
+		base + "/" + tmodel.RouteDeleteOne.String() + "/{id}": map[string]interface{}{
+			"delete": operation(tag, "Delete one "+model.Name, idParam, nil, results),
+		},
+		base + "/" + tmodel.RouteDeleteMany.String() + "/": map[string]interface{}{
+			"delete": operation(tag, "Delete many "+model.Name, filterParams(false), nil, results),
+		},
+	}
+
+	for method, routes := range model.Routes {
+		for pattern, route := range routes {
+			ownPattern, params := ownPathParams(pattern)
+			path := fmt.Sprintf("%s/%s/%s", base, tmodel.RouteOwn.String(), ownPattern)
+			item, ok := paths[path].(map[string]interface{})
+			if !ok {
+				item = map[string]interface{}{}
+				paths[path] = item
+			}
+			var body interface{}
+			if method != http.MethodGet && method != http.MethodDelete {
+				body = map[string]interface{}{}
+			}
+			item[strings.ToLower(method)] = operation(tag, fmt.Sprintf("%s %s %s", route.Method, model.Name, pattern), params, body, map[string]interface{}{})
+		}
+	}
+	return paths
+}
+
+func operation(tags []string, summary string, params []interface{}, body interface{}, resp interface{}) map[string]interface{} {
+	ok := map[string]interface{}{"description": "OK"}
+	if resp != nil {
+		ok["content"] = map[string]interface{}{"application/json": map[string]interface{}{"schema": resp}}
+	}
+	errResp := map[string]interface{}{
+		"description": "Error",
+		"content": map[string]interface{}{
+			"application/problem+json": map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/Error"}},
+		},
+	}
+
+	op := map[string]interface{}{
+		"tags":    tags,
+		"summary": summary,
+		"responses": map[string]interface{}{
+			"200":     ok,
+			"default": errResp,
+		},
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+	if body != nil {
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": body}},
+		}
+	}
+	return op
+}
+
+// problemSchema describes terror.Problem, the RFC 7807 body of every error response.
+var problemSchema = map[string]interface{}{
+	"type":     "object",
+	"required": []string{"type", "title", "status"},
+	"properties": map[string]interface{}{
+		"type":       map[string]interface{}{"type": "string", "format": "uri-reference"},
+		"title":      map[string]interface{}{"type": "string"},
+		"status":     map[string]interface{}{"type": "integer"},
+		"detail":     map[string]interface{}{"type": "string"},
+		"instance":   map[string]interface{}{"type": "string"},
+		"code":       map[string]interface{}{"type": "string", "description": "Machine readable error code, e.g. duplicated_key."},
+		"request_id": map[string]interface{}{"type": "string"},
+		"errors": map[string]interface{}{
+			"type":        "array",
+			"description": "Failing fields of a 422 response.",
+			"items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"field":   map[string]interface{}{"type": "string"},
+					"rule":    map[string]interface{}{"type": "string"},
+					"message": map[string]interface{}{"type": "string"},
+				},
+			},
+		},
+		"details": map[string]interface{}{"description": "Extra data of the error, e.g. the per-item results of a failed add-many."},
+	},
+}
+
+var includeParam = queryParam("include", "Comma separated relations to load, e.g. dates,days_of_the_week.", "string")
+
+func filterParams(page bool) []interface{} {
+	params := []interface{}{
+		queryParam("by", "Field compared with value, from and to.", "string"),
+		queryParam("value", "Value the by field has to be equal to.", "string"),
+		queryParam("from", "Lowest value of the by field.", "string"),
+		queryParam("to", "Highest value of the by field.", "string"),
+		map[string]interface{}{
+			"name":        "filter",
+			"in":          "query",
+			"style":       "deepObject",
+			"explode":     true,
+			"description": "Conditions like filter[status][in]=1,2 or filter[name][like]=foo.",
+			"schema":      map[string]interface{}{"type": "object"},
+		},
+	}
+	if page {
+		params = append(params,
+			queryParam("limit", "Page size.", "integer"),
+			queryParam("offset", "Records to skip.", "integer"),
+			queryParam("cursor", "Cursor from next_cursor or prev_cursor.", "string"),
+			queryParam("sort", "Comma separated fields, a leading - sorts descending.", "string"),
+		)
+	}
+	return params
+}
+
+var ownParam = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)(?::[^/]+)?\}`)
+
+// ownPathParams returns the OpenAPI path of an own route pattern without the param regexps, and its
+// path params.
+func ownPathParams(pattern string) (string, []interface{}) {
+	var params []interface{}
+	for _, match := range ownParam.FindAllStringSubmatch(pattern, -1) {
+		param := pathParam(match[1], "Path param "+match[1]+".")
+		param["schema"] = map[string]interface{}{"type": "string"}
+		params = append(params, param)
+	}
+	return ownParam.ReplaceAllString(strings.Trim(pattern, "/"), "{$1}"), params
+}
+
+func queryParam(name string, description string, typ string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        name,
+		"in":          "query",
+		"description": description,
+		"schema":      map[string]interface{}{"type": typ},
+	}
+}
+
+func pathParam(name string, description string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        name,
+		"in":          "path",
+		"required":    true,
+		"description": description,
+		"schema":      map[string]interface{}{"type": "integer"},
+	}
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// add returns the schema of typ, structs are put into components and referenced.
+func (s schemas) add(typ reflect.Type) map[string]interface{} {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	switch typ {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case deletedAtType:
+		return map[string]interface{}{"type": []string{"string", "null"}, "format": "date-time"}
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": s.add(typ.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.add(typ.Elem())}
+	case reflect.Struct:
+		if typ.Implements(marshalerType) || reflect.PtrTo(typ).Implements(marshalerType) {
+			return map[string]interface{}{}
+		}
+		name := typ.Name()
+		if name == "" {
+			return s.object(typ)
+		}
+		if _, ok := s[name]; !ok {
+			// Registered before the fields so recursive types end in a reference.
+			s[name] = map[string]interface{}{}
+			s[name] = s.object(typ)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+func (s schemas) object(typ reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	s.fields(typ, properties)
+
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+}
+
+// fields follows encoding/json naming, embedded structs without a json name are flattened.
+func (s schemas) fields(typ reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			s.fields(fieldType, properties)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = s.add(field.Type)
+	}
+}
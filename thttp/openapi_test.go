@@ -0,0 +1,74 @@
+package thttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/WojciechWiderski/tofu/tmodel"
+)
+
+func TestOpenAPIDocument(t *testing.T) {
+	srv := newTestServer(t, tmodel.NewModels(tmodel.NewModel(&record{}, "record")), WithOpenAPI("test", "1.0.0", false))
+	status, body := do(t, srv, http.MethodGet, "/api/openapi.json", "")
+	if status != http.StatusOK {
+		t.Fatalf("GET /api/openapi.json = %d %s", status, body)
+	}
+	var doc struct {
+		Paths      map[string]map[string]operationDoc `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]interface{} `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal([]byte(body), &doc); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		wantParams []string
+	}{
+		{name: "get one by id", path: "/api/record/get-one/{id}", wantParams: []string{"id", "include"}},
+		{name: "get one by filter", path: "/api/record/get-one/", wantParams: []string{"by", "value", "include"}},
+		{name: "get many", path: "/api/record/get-many/", wantParams: []string{"limit", "cursor", "sort"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op, ok := doc.Paths[tt.path]["get"]
+			if !ok {
+				t.Fatalf("path %s is not documented", tt.path)
+			}
+			params := map[string]bool{}
+			for _, param := range op.Parameters {
+				params[param.Name] = true
+			}
+			for _, want := range tt.wantParams {
+				if !params[want] {
+					t.Errorf("%s params = %v, want %s", tt.path, params, want)
+				}
+			}
+			if _, ok := op.Responses["default"].Content["application/problem+json"]; !ok {
+				t.Errorf("%s default response = %+v, want application/problem+json", tt.path, op.Responses["default"])
+			}
+		})
+	}
+
+	problem := doc.Components.Schemas["Error"].Properties
+	for _, field := range []string{"type", "title", "status", "detail", "instance", "code", "request_id", "errors", "details"} {
+		if _, ok := problem[field]; !ok {
+			t.Errorf("Error schema properties = %v, want %s", problem, field)
+		}
+	}
+}
+
+type operationDoc struct {
+	Parameters []struct {
+		Name string `json:"name"`
+	} `json:"parameters"`
+	Responses map[string]struct {
+		Content map[string]interface{} `json:"content"`
+	} `json:"responses"`
+}
@@ -0,0 +1,85 @@
+package thttp
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/WojciechWiderski/tofu/tcontext"
+	"github.com/WojciechWiderski/tofu/terror"
+	"github.com/WojciechWiderski/tofu/tlogger"
+	"github.com/WojciechWiderski/tofu/tmodel"
+)
+
+// ownRoutes registers the own routes of every model at /{model}/own/{pattern}, chi matches them before
+// the generic /{model}/{route-type} routes.
+func (a *HttpAPI) ownRoutes(r chi.Router) {
+	for _, model := range a.Models.All {
+		if model.Internal {
+			continue
+		}
+		for method, routes := range model.Routes {
+			for pattern, route := range routes {
+				path := "/" + model.Name + "/" + tmodel.RouteOwn.String() + "/" + pattern
+				middlewares := append([]func(http.Handler) http.Handler{OwnRouteMiddleware(model, pattern), a.authMiddleware()}, route.Middlewares...)
+				r.With(middlewares...).Method(method, path, handle(a.handlerOwn(route)))
+			}
+		}
+	}
+}
+
+// OwnRouteMiddleware puts model, the own route type and pattern into the context like the generic routes.
+func OwnRouteMiddleware(model *tmodel.Model, pattern string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := tlogger.ContextWith(r.Context(),
+				slog.String(tlogger.KeyModel, model.Name),
+				slog.String(tlogger.KeyRouteType, tmodel.RouteOwn.String()),
+			)
+			ctx = tcontext.ContextWithModel(ctx, model)
+			ctx = tcontext.ContextWithRouteType(ctx, tmodel.RouteOwn)
+			ctx = tcontext.ContextWithPattern(ctx, pattern)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// handlerOwn runs route after the role and row level checks, a write runs in one transaction. The path
+// params of the pattern are read with chi.URLParam.
+func (a *HttpAPI) handlerOwn(route tmodel.Route) func(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	return func(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+		ctx := r.Context()
+		model, err := a.Models.GetRawModel(tcontext.ModelFromCtx(ctx).Name)
+		if err != nil {
+			return nil, terror.Wrap("a.Models.GetRawModel", err)
+		}
+		ctx = tcontext.ContextWithModel(ctx, model)
+		ctx = a.withEvent(ctx, model)
+
+		if err := authorizeRoles(ctx, model, tmodel.RouteOwn); err != nil {
+			return nil, terror.Wrap("authorizeRoles", err)
+		}
+		if err := authorizeRecord(ctx, model, tmodel.RouteOwn, nil); err != nil {
+			return nil, terror.Wrap("authorizeRecord", err)
+		}
+
+		run := func(ctx context.Context) (interface{}, error) {
+			resp, err := route.Fn(ctx, w, r.WithContext(ctx), a.Database)
+			if err != nil {
+				return nil, terror.Wrap(fmt.Sprintf("route %s %s", route.Method, route.Pattern), err)
+			}
+			return resp, nil
+		}
+
+		var resp interface{}
+		if route.Method == http.MethodGet || model.Store == nil {
+			resp, err = run(ctx)
+		} else {
+			resp, err = a.inTx(ctx, run)
+		}
+		return a.respond(ctx, resp, err)
+	}
+}
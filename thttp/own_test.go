@@ -0,0 +1,115 @@
+package thttp
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/WojciechWiderski/tofu/tdatabase"
+	"github.com/WojciechWiderski/tofu/terror"
+	"github.com/WojciechWiderski/tofu/tmodel"
+)
+
+func newOwnRoute(t *testing.T, pattern string, method string, fn func(ctx context.Context, w http.ResponseWriter, r *http.Request, operations tdatabase.DBOperations) (interface{}, error), middlewares ...func(http.Handler) http.Handler) tmodel.Route {
+	t.Helper()
+	route, err := tmodel.NewRoute(tmodel.RouteOwn, pattern, method, fn, middlewares...)
+	if err != nil {
+		t.Fatalf("NewRoute() error = %v", err)
+	}
+	return route
+}
+
+// setMax writes max to the record of the id path param.
+func setMax(max int, err error) func(ctx context.Context, w http.ResponseWriter, r *http.Request, operations tdatabase.DBOperations) (interface{}, error) {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request, operations tdatabase.DBOperations) (interface{}, error) {
+		id, convErr := strconv.Atoi(chi.URLParam(r, "id"))
+		if convErr != nil {
+			return nil, terror.Newf(terror.BadRequest, "strconv.Atoi", convErr)
+		}
+		out := &record{}
+		if err := operations.Update(ctx, &record{Max: max}, out, id); err != nil {
+			return nil, err
+		}
+		return out, err
+	}
+}
+
+func TestOwnRoutes(t *testing.T) {
+	limited := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("token") != "ok" {
+				http.Error(w, "slow down", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	model := tmodel.NewModel(&record{}, "record").
+		AddRoute(newOwnRoute(t, "stats", http.MethodGet, func(ctx context.Context, w http.ResponseWriter, r *http.Request, operations tdatabase.DBOperations) (interface{}, error) {
+			count, err := operations.Count(ctx, &record{}, tdatabase.ParamRequest{})
+			return map[string]int64{"count": count}, err
+		})).
+		AddRoute(newOwnRoute(t, "{id:[0-9]+}/max", http.MethodPost, setMax(50, nil))).
+		AddRoute(newOwnRoute(t, "{id:[0-9]+}/max", http.MethodPut, setMax(60, terror.NewConflict("undone")))).
+		AddRoute(newOwnRoute(t, "{id:[0-9]+}/max", http.MethodPatch, setMax(70, nil), limited)).
+		AddRoute(newOwnRoute(t, "{id}", http.MethodDelete, func(ctx context.Context, w http.ResponseWriter, r *http.Request, operations tdatabase.DBOperations) (interface{}, error) {
+			return map[string]string{"deleted": chi.URLParam(r, "id")}, nil
+		}))
+	srv := newTestServer(t, tmodel.NewModels(model))
+	if status, body := do(t, srv, http.MethodPost, "/api/record/add-one/", `{"name":"a","max":10}`); status != http.StatusOK {
+		t.Fatalf("add-one = %d %s", status, body)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantBody   string
+		wantMax    string
+	}{
+		{name: "get", method: http.MethodGet, path: "/api/record/own/stats", wantStatus: http.StatusOK, wantBody: `{"count":1}`},
+		{name: "post with param", method: http.MethodPost, path: "/api/record/own/1/max", wantStatus: http.StatusOK, wantBody: `"max":50`, wantMax: `"max":50`},
+		{name: "put error rolls back", method: http.MethodPut, path: "/api/record/own/1/max", wantStatus: http.StatusConflict, wantBody: "undone", wantMax: `"max":50`},
+		{name: "middleware rejects", method: http.MethodPatch, path: "/api/record/own/1/max", wantStatus: http.StatusTooManyRequests, wantMax: `"max":50`},
+		{name: "middleware passes", method: http.MethodPatch, path: "/api/record/own/1/max?token=ok", wantStatus: http.StatusOK, wantMax: `"max":70`},
+		{name: "delete", method: http.MethodDelete, path: "/api/record/own/abc", wantStatus: http.StatusOK, wantBody: `{"deleted":"abc"}`},
+		{name: "param regexp", method: http.MethodPost, path: "/api/record/own/abc/max", wantStatus: http.StatusNotFound},
+		{name: "other method", method: http.MethodGet, path: "/api/record/own/1/max", wantStatus: http.StatusMethodNotAllowed},
+		{name: "unknown pattern", method: http.MethodGet, path: "/api/record/own/nope", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := do(t, srv, tt.method, tt.path, "")
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", status, tt.wantStatus, body)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", body, tt.wantBody)
+			}
+			if tt.wantMax == "" {
+				return
+			}
+			if _, stored := do(t, srv, http.MethodGet, "/api/record/get-one/1", ""); !strings.Contains(stored, tt.wantMax) {
+				t.Errorf("get-one = %s, want it to contain %s", stored, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestOwnRoutes_Roles(t *testing.T) {
+	model := tmodel.NewModel(&record{}, "record").
+		AddRoute(newOwnRoute(t, "stats", http.MethodGet, func(ctx context.Context, w http.ResponseWriter, r *http.Request, operations tdatabase.DBOperations) (interface{}, error) {
+			return map[string]bool{"ok": true}, nil
+		})).
+		AllowRoles(tmodel.RouteOwn, "admin")
+	srv := newTestServer(t, tmodel.NewModels(model))
+
+	if status, body := do(t, srv, http.MethodGet, "/api/record/own/stats", ""); status != http.StatusUnauthorized {
+		t.Errorf("own route without roles = %d %s, want %d", status, body, http.StatusUnauthorized)
+	}
+}
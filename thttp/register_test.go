@@ -0,0 +1,134 @@
+package thttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/WojciechWiderski/tofu/tdatabase"
+	"github.com/WojciechWiderski/tofu/terror"
+	"github.com/WojciechWiderski/tofu/tmodel"
+)
+
+type task struct {
+	ID    uint   `json:"id"`
+	Title string `json:"title" validate:"required"`
+	Done  bool   `json:"done"`
+}
+
+func TestRegister_Handle(t *testing.T) {
+	ctx := context.Background()
+	models := tmodel.NewModels()
+	tasks := tmodel.Register[task](models, "task")
+	newTestServer(t, models)
+
+	for i := 0; i < 150; i++ {
+		if err := tasks.Create(ctx, &task{Title: fmt.Sprintf("task %d", i)}); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		call    func() (interface{}, error)
+		want    string
+		wantErr error
+	}{
+		{
+			name: "get",
+			call: func() (interface{}, error) { return tasks.Get(ctx, 1) },
+			want: "&{ID:1 Title:task 0 Done:false}",
+		},
+		{
+			name: "get by",
+			call: func() (interface{}, error) {
+				return tasks.GetBy(ctx, tdatabase.ParamRequest{By: "title", Value: "task 7"})
+			},
+			want: "&{ID:8 Title:task 7 Done:false}",
+		},
+		{
+			name: "list every record",
+			call: func() (interface{}, error) {
+				items, err := tasks.List(ctx, tdatabase.ParamRequest{})
+				return len(items), err
+			},
+			want: "150",
+		},
+		{
+			name: "update",
+			call: func() (interface{}, error) { return tasks.Update(ctx, 2, &task{Done: true}) },
+			want: "&{ID:2 Title:task 1 Done:true}",
+		},
+		{
+			name:    "get missing",
+			call:    func() (interface{}, error) { return tasks.Get(ctx, 999) },
+			wantErr: terror.NotFound,
+		},
+		{
+			name: "delete",
+			call: func() (interface{}, error) {
+				if err := tasks.Delete(ctx, 3); err != nil {
+					return nil, err
+				}
+				return tasks.Get(ctx, 3)
+			},
+			wantErr: terror.NotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.call()
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && fmt.Sprintf("%+v", got) != tt.want {
+				t.Errorf("got %+v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegister_Routes(t *testing.T) {
+	models := tmodel.NewModels()
+	tasks := tmodel.Register[task](models, "task")
+	tasks.BeforeValidate(tmodel.RouteAll, func(ctx context.Context, in *task) error {
+		in.Title = strings.TrimSpace(in.Title)
+		return nil
+	}).BeforeSave(tmodel.RouteAddOne, func(ctx context.Context, in *task) error {
+		if in.Title == "forbidden" {
+			return terror.NewForbidden("forbidden title")
+		}
+		return nil
+	})
+	srv := newTestServer(t, models)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "add one", method: http.MethodPost, path: "/api/task/add-one/", body: `{"title":"  write tests  "}`, wantStatus: http.StatusOK},
+		{name: "hook changed the record", method: http.MethodGet, path: "/api/task/get-one/1", wantStatus: http.StatusOK, wantBody: `"title":"write tests"`},
+		{name: "validated after the hook", method: http.MethodPost, path: "/api/task/add-one/", body: `{"title":"   "}`, wantStatus: http.StatusUnprocessableEntity, wantBody: `"field":"title"`},
+		{name: "hook rejects", method: http.MethodPost, path: "/api/task/add-one/", body: `{"title":"forbidden"}`, wantStatus: http.StatusForbidden, wantBody: "forbidden title"},
+		{name: "add many runs the hook per item", method: http.MethodPost, path: "/api/task/add-many/", body: `[{"title":" a "},{"title":" b "}]`, wantStatus: http.StatusOK},
+		{name: "items changed", method: http.MethodGet, path: "/api/task/get-one/3", wantStatus: http.StatusOK, wantBody: `"title":"b"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := do(t, srv, tt.method, tt.path, tt.body)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", status, tt.wantStatus, body)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", body, tt.wantBody)
+			}
+		})
+	}
+}
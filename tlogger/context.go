@@ -0,0 +1,31 @@
+package tlogger
+
+import (
+	"context"
+	"log/slog"
+)
+
+const (
+	KeyRequestID = "request_id"
+	KeyModel     = "model"
+	KeyRouteType = "route_type"
+	KeyUser      = "user"
+)
+
+type ctxKey struct{}
+
+// ContextWith returns ctx carrying attrs, they are added to every record logged with the context.
+func ContextWith(ctx context.Context, attrs ...slog.Attr) context.Context {
+	prev := attrsFromContext(ctx)
+	all := make([]slog.Attr, 0, len(prev)+len(attrs))
+	all = append(append(all, prev...), attrs...)
+	return context.WithValue(ctx, ctxKey{}, all)
+}
+
+func attrsFromContext(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(ctxKey{}).([]slog.Attr)
+	return attrs
+}
@@ -0,0 +1,158 @@
+package tlogger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const colorRed = "\033[38;5;160m"
+const colorGreen = "\033[38;5;40m"
+const colorYellow = "\033[38;5;220m"
+const colorNone = "\033[0m"
+
+// NewHandler returns a sink writing to w in format, levels are filtered by tlogger before the sink.
+func NewHandler(format Format, w io.Writer) slog.Handler {
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug, ReplaceAttr: replaceLevel}
+	switch format {
+	case FormatJSON:
+		return slog.NewJSONHandler(w, opts)
+	case FormatText:
+		return slog.NewTextHandler(w, opts)
+	}
+	return &colorHandler{w: w, mu: &sync.Mutex{}}
+}
+
+func replaceLevel(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.LevelKey && len(groups) == 0 && a.Value.Any() == LevelSuccess {
+		a.Value = slog.StringValue("SUCCESS")
+	}
+	return a
+}
+
+// handler applies the global or package level and the context attributes, then fans the record out to
+// the sinks current at the time of the call.
+type handler struct {
+	pkg string
+	ops []func(slog.Handler) slog.Handler
+}
+
+func (h *handler) Enabled(_ context.Context, lvl slog.Level) bool {
+	mu.RLock()
+	min, ok := packageLevels[h.pkg]
+	mu.RUnlock()
+	if !ok || h.pkg == "" {
+		min = level.Level()
+	}
+	return lvl >= min
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	mu.RLock()
+	current := sinks
+	mu.RUnlock()
+
+	ctxAttrs := attrsFromContext(ctx)
+	var errs []error
+	for _, sink := range current {
+		if !sink.Enabled(ctx, r.Level) {
+			continue
+		}
+		if len(ctxAttrs) > 0 {
+			sink = sink.WithAttrs(ctxAttrs)
+		}
+		for _, op := range h.ops {
+			sink = op(sink)
+		}
+		errs = append(errs, sink.Handle(ctx, r.Clone()))
+	}
+	return errors.Join(errs...)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(sink slog.Handler) slog.Handler { return sink.WithAttrs(attrs) })
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return h.with(func(sink slog.Handler) slog.Handler { return sink.WithGroup(name) })
+}
+
+func (h *handler) with(op func(slog.Handler) slog.Handler) *handler {
+	ops := make([]func(slog.Handler) slog.Handler, 0, len(h.ops)+1)
+	return &handler{pkg: h.pkg, ops: append(append(ops, h.ops...), op)}
+}
+
+// colorHandler keeps the coloured one line output of the first tlogger, attributes follow the message.
+type colorHandler struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	prefix string
+	attrs  []byte
+}
+
+func (h *colorHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *colorHandler) Handle(_ context.Context, r slog.Record) error {
+	color := ""
+	switch {
+	case r.Level >= slog.LevelError:
+		color = colorRed
+	case r.Level >= slog.LevelWarn:
+		color = colorYellow
+	case r.Level >= LevelSuccess:
+		color = colorGreen
+	}
+
+	buf := bytes.NewBuffer(append([]byte{}, h.attrs...))
+	r.Attrs(func(a slog.Attr) bool {
+		writeAttr(buf, h.prefix, a)
+		return true
+	})
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := fmt.Fprintf(h.w, "%s %s %s%s %s \n", color, r.Time.Format(time.DateTime), r.Message, buf.Bytes(), colorNone)
+	return err
+}
+
+func (h *colorHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	buf := bytes.NewBuffer(append([]byte{}, h.attrs...))
+	for _, a := range attrs {
+		writeAttr(buf, h.prefix, a)
+	}
+	return &colorHandler{w: h.w, mu: h.mu, prefix: h.prefix, attrs: buf.Bytes()}
+}
+
+func (h *colorHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &colorHandler{w: h.w, mu: h.mu, prefix: h.prefix + name + ".", attrs: h.attrs}
+}
+
+func writeAttr(buf *bytes.Buffer, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			writeAttr(buf, prefix, ga)
+		}
+		return
+	}
+	fmt.Fprintf(buf, " %s%s=%v", prefix, a.Key, a.Value)
+}
@@ -1,33 +1,132 @@
 package tlogger
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"os"
-	"time"
+	"strings"
+	"sync"
+
+	"github.com/WojciechWiderski/tofu/tconfig"
+)
+
+// LevelSuccess sits between info and warn, so it passes an info level filter.
+const LevelSuccess = slog.Level(2)
+
+type Format string
+
+const (
+	FormatColor Format = "color"
+	FormatText  Format = "text"
+	FormatJSON  Format = "json"
+)
+
+var (
+	level = new(slog.LevelVar)
+
+	mu            sync.RWMutex
+	sinks         = []slog.Handler{NewHandler(FormatColor, os.Stdout)}
+	packageLevels = map[string]slog.Level{}
+
+	std = slog.New(&handler{})
 )
 
-const colorRed = "\033[38;5;160m"
-const colorGreen = "\033[38;5;40m"
-const colorYellow = "\033[38;5;220m"
-const colorNone = "\033[0m"
+// Configure sets the level, the format of the stdout sink and the per package levels from config.
+func Configure(config tconfig.Logger) error {
+	lvl, err := ParseLevel(config.Level)
+	if err != nil {
+		return err
+	}
+	format := Format(strings.ToLower(config.Format))
+	switch format {
+	case "":
+		format = FormatColor
+	case FormatColor, FormatText, FormatJSON:
+	default:
+		return fmt.Errorf("wrong log format %s", config.Format)
+	}
+
+	levels := map[string]slog.Level{}
+	for pkg, raw := range config.Packages {
+		if levels[pkg], err = ParseLevel(raw); err != nil {
+			return fmt.Errorf("package %s: %w", pkg, err)
+		}
+	}
+
+	level.Set(lvl)
+	mu.Lock()
+	defer mu.Unlock()
+	sinks = []slog.Handler{NewHandler(format, os.Stdout)}
+	packageLevels = levels
+	return nil
+}
+
+// ParseLevel parses debug, info, success, warn or error, an empty string is info.
+func ParseLevel(raw string) (slog.Level, error) {
+	switch strings.ToLower(raw) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "success":
+		return LevelSuccess, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("wrong log level %s", raw)
+}
+
+func SetLevel(lvl slog.Level) {
+	level.Set(lvl)
+}
+
+// SetPackageLevel overrides the global level for the loggers returned by Logger(pkg).
+func SetPackageLevel(pkg string, lvl slog.Level) {
+	mu.Lock()
+	defer mu.Unlock()
+	packageLevels[pkg] = lvl
+}
+
+// SetHandler replaces every sink with h.
+func SetHandler(h slog.Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	sinks = []slog.Handler{h}
+}
+
+// AddSink sends every record to h as well, h may filter records by its own Enabled.
+func AddSink(h slog.Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	sinks = append(append([]slog.Handler{}, sinks...), h)
+}
+
+// Default returns the logger behind Info, Warn, Error and Success.
+func Default() *slog.Logger {
+	return std
+}
+
+// Logger returns a logger with the package attribute, its level can be set by SetPackageLevel. Sinks and
+// levels changed later apply to loggers created before.
+func Logger(pkg string) *slog.Logger {
+	return slog.New(&handler{pkg: pkg}).With(slog.String("package", pkg))
+}
 
 func Error(msg string) {
-	writeLog(msg, colorRed)
+	std.Log(context.Background(), slog.LevelError, msg)
 }
 
 func Success(msg string) {
-	writeLog(msg, colorGreen)
+	std.Log(context.Background(), LevelSuccess, msg)
 }
 
 func Warn(msg string) {
-	writeLog(msg, colorYellow)
+	std.Log(context.Background(), slog.LevelWarn, msg)
 }
 
 func Info(msg string) {
-	writeLog(msg, "")
-}
-
-func writeLog(msg string, color string) {
-	now := time.Now().Format("2006-01-02 15:04:05")
-	fmt.Fprintf(os.Stdout, "%s %s %s %s \n", color, now, msg, colorNone)
+	std.Log(context.Background(), slog.LevelInfo, msg)
 }
@@ -0,0 +1,130 @@
+package tlogger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/WojciechWiderski/tofu/tconfig"
+)
+
+// capture sends every record to a JSON buffer until the test ends.
+func capture(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	SetHandler(NewHandler(FormatJSON, &buf))
+	t.Cleanup(func() {
+		if err := Configure(tconfig.Logger{}); err != nil {
+			t.Errorf("Configure() error = %v", err)
+		}
+	})
+	return &buf
+}
+
+func records(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var out []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("json.Unmarshal(%s) error = %v", line, err)
+		}
+		out = append(out, record)
+	}
+	return out
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    slog.Level
+		wantErr bool
+	}{
+		{raw: "", want: slog.LevelInfo},
+		{raw: "DEBUG", want: slog.LevelDebug},
+		{raw: "success", want: LevelSuccess},
+		{raw: "warning", want: slog.LevelWarn},
+		{raw: "error", want: slog.LevelError},
+		{raw: "loud", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := ParseLevel(tt.raw)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseLevel() = %v, %v, want %v, wantErr %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  tconfig.Logger
+		wantErr bool
+	}{
+		{name: "defaults", config: tconfig.Logger{}},
+		{name: "json with package levels", config: tconfig.Logger{Level: "warn", Format: "JSON", Packages: map[string]string{"thttp": "debug"}}},
+		{name: "wrong level", config: tconfig.Logger{Level: "loud"}, wantErr: true},
+		{name: "wrong format", config: tconfig.Logger{Format: "xml"}, wantErr: true},
+		{name: "wrong package level", config: tconfig.Logger{Packages: map[string]string{"thttp": "loud"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(func() { _ = Configure(tconfig.Logger{}) })
+			if err := Configure(tt.config); (err != nil) != tt.wantErr {
+				t.Errorf("Configure() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLogger(t *testing.T) {
+	buf := capture(t)
+	SetLevel(slog.LevelWarn)
+	SetPackageLevel("thttp", slog.LevelDebug)
+
+	ctx := ContextWith(context.Background(), slog.String(KeyRequestID, "r1"))
+	ctx = ContextWith(ctx, slog.String(KeyModel, "task"))
+
+	Info("dropped by the global level")
+	Warn("kept")
+	Success("dropped as well")
+	Logger("tqueue").Info("dropped by the global level")
+	Logger("thttp").DebugContext(ctx, "kept by the package level")
+
+	got := records(t, buf)
+	if len(got) != 2 {
+		t.Fatalf("records = %v, want 2", got)
+	}
+	if got[0]["msg"] != "kept" || got[0]["level"] != "WARN" {
+		t.Errorf("record 0 = %v", got[0])
+	}
+	want := map[string]interface{}{"msg": "kept by the package level", "package": "thttp", KeyRequestID: "r1", KeyModel: "task"}
+	for key, value := range want {
+		if got[1][key] != value {
+			t.Errorf("record 1 %s = %v, want %v", key, got[1][key], value)
+		}
+	}
+}
+
+func TestSuccessLevel(t *testing.T) {
+	buf := capture(t)
+	var sink bytes.Buffer
+	AddSink(slog.NewJSONHandler(&sink, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	Success("migrated")
+
+	if got := records(t, buf); len(got) != 1 || got[0]["level"] != "SUCCESS" {
+		t.Errorf("records = %v, want one SUCCESS record", got)
+	}
+	if sink.Len() != 0 {
+		t.Errorf("warn sink got %s", sink.String())
+	}
+}
@@ -0,0 +1,85 @@
+package tmetrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/WojciechWiderski/tofu/tdatabase"
+)
+
+// DB records the duration and the errors of every call to the wrapped DBOperations.
+type DB struct {
+	tdatabase.DBOperations
+	backend string
+}
+
+// InstrumentDB wraps db, the backend label is the package name of the store behind db, e.g. sqlite or
+// memory, see tdatabase.Backend.
+func InstrumentDB(db tdatabase.DBOperations) *DB {
+	if instrumented, ok := db.(*DB); ok {
+		return instrumented
+	}
+	return &DB{DBOperations: db, backend: tdatabase.Backend(db)}
+}
+
+// Unwrap returns the wrapped DBOperations, e.g. to reach the gorm connection of a backend.
+func (d *DB) Unwrap() tdatabase.DBOperations {
+	return d.DBOperations
+}
+
+func (d *DB) Add(ctx context.Context, in interface{}) (err error) {
+	defer d.observe("add", time.Now(), &err)
+	return d.DBOperations.Add(ctx, in)
+}
+
+func (d *DB) AddMany(ctx context.Context, in []interface{}) (_ []tdatabase.Result, err error) {
+	defer d.observe("add_many", time.Now(), &err)
+	return d.DBOperations.AddMany(ctx, in)
+}
+
+func (d *DB) GetOne(ctx context.Context, in interface{}, params tdatabase.ParamRequest) (_ interface{}, err error) {
+	defer d.observe("get_one", time.Now(), &err)
+	return d.DBOperations.GetOne(ctx, in, params)
+}
+
+func (d *DB) GetMany(ctx context.Context, in interface{}, params tdatabase.ParamRequest) (_ []interface{}, err error) {
+	defer d.observe("get_many", time.Now(), &err)
+	return d.DBOperations.GetMany(ctx, in, params)
+}
+
+func (d *DB) Count(ctx context.Context, in interface{}, params tdatabase.ParamRequest) (_ int64, err error) {
+	defer d.observe("count", time.Now(), &err)
+	return d.DBOperations.Count(ctx, in, params)
+}
+
+func (d *DB) Update(ctx context.Context, update interface{}, in interface{}, id interface{}) (err error) {
+	defer d.observe("update", time.Now(), &err)
+	return d.DBOperations.Update(ctx, update, in, id)
+}
+
+func (d *DB) Delete(ctx context.Context, in interface{}, id interface{}) (err error) {
+	defer d.observe("delete", time.Now(), &err)
+	return d.DBOperations.Delete(ctx, in, id)
+}
+
+func (d *DB) DeleteMany(ctx context.Context, in interface{}, params tdatabase.ParamRequest) (_ []tdatabase.Result, err error) {
+	defer d.observe("delete_many", time.Now(), &err)
+	return d.DBOperations.DeleteMany(ctx, in, params)
+}
+
+func (d *DB) Ping(ctx context.Context) (err error) {
+	defer d.observe("ping", time.Now(), &err)
+	return d.DBOperations.Ping(ctx)
+}
+
+// WithTx hands fn the transaction wrapped as well, so calls inside it are recorded too.
+func (d *DB) WithTx(ctx context.Context, fn func(ctx context.Context, tx tdatabase.DBOperations) error) (err error) {
+	defer d.observe("tx", time.Now(), &err)
+	return d.DBOperations.WithTx(ctx, func(ctx context.Context, tx tdatabase.DBOperations) error {
+		return fn(ctx, &DB{DBOperations: tx, backend: d.backend})
+	})
+}
+
+func (d *DB) observe(operation string, start time.Time, err *error) {
+	ObserveDB(d.backend, operation, start, *err)
+}
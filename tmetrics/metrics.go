@@ -0,0 +1,114 @@
+// Package tmetrics collects the Prometheus metrics of tofu and serves them at /metrics.
+package tmetrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "tofu"
+
+// Registry holds the tofu metrics with the Go and process collectors, register app metrics here to serve
+// them from the same endpoint.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route, model, route type and status.",
+	}, []string{"method", "route", "model", "route_type", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route, model and route type.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "model", "route_type"})
+
+	dbDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_operation_duration_seconds",
+		Help:      "DBOperations call latency by backend and operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"backend", "operation"})
+
+	dbErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_operation_errors_total",
+		Help:      "DBOperations calls returning an error by backend and operation.",
+	}, []string{"backend", "operation"})
+
+	hookDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "hook_duration_seconds",
+		Help:      "Model hook latency by model and hook.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"model", "hook"})
+
+	hookErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "hook_errors_total",
+		Help:      "Model hooks returning an error by model and hook.",
+	}, []string{"model", "hook"})
+
+	mqttPublished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mqtt_messages_published_total",
+		Help:      "MQTT messages published by topic.",
+	}, []string{"topic"})
+
+	mqttReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mqtt_messages_received_total",
+		Help:      "MQTT messages received by subscription topic.",
+	}, []string{"topic"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration,
+		dbDuration, dbErrors,
+		hookDuration, hookErrors,
+		mqttPublished, mqttReceived,
+	)
+}
+
+// Handler serves Registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+func ObserveHTTP(method, route, model, routeType string, status int, start time.Time) {
+	httpRequests.WithLabelValues(method, route, model, routeType, strconv.Itoa(status)).Inc()
+	httpDuration.WithLabelValues(method, route, model, routeType).Observe(time.Since(start).Seconds())
+}
+
+func ObserveDB(backend, operation string, start time.Time, err error) {
+	dbDuration.WithLabelValues(backend, operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		dbErrors.WithLabelValues(backend, operation).Inc()
+	}
+}
+
+func ObserveHook(model, hook string, start time.Time, err error) {
+	hookDuration.WithLabelValues(model, hook).Observe(time.Since(start).Seconds())
+	if err != nil {
+		hookErrors.WithLabelValues(model, hook).Inc()
+	}
+}
+
+func MQTTPublished(topic string) {
+	mqttPublished.WithLabelValues(topic).Inc()
+}
+
+func MQTTReceived(topic string) {
+	mqttReceived.WithLabelValues(topic).Inc()
+}
@@ -0,0 +1,124 @@
+package tmetrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/WojciechWiderski/tofu/tdatabase"
+	"github.com/WojciechWiderski/tofu/tdatabase/memory"
+	"github.com/WojciechWiderski/tofu/tmodel"
+	"github.com/WojciechWiderski/tofu/ttrace"
+)
+
+type item struct {
+	ID   uint
+	Name string
+}
+
+func TestDB(t *testing.T) {
+	store := memory.New(tmodel.NewModels(tmodel.NewModel(&item{}, "item")))
+	if err := store.Migrate(); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	// Wrapped inside ttrace, the backend is still the store behind it.
+	db := InstrumentDB(ttrace.InstrumentDB(store))
+	if again := InstrumentDB(db); again != db {
+		t.Errorf("InstrumentDB() wrapped an instrumented db again")
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		operation  string
+		call       func() error
+		wantErrors float64
+	}{
+		{name: "add", operation: "add", call: func() error { return db.Add(ctx, &item{Name: "a"}) }},
+		{
+			name:      "failing get one",
+			operation: "get_one",
+			call: func() error {
+				_, err := db.GetOne(ctx, &item{}, tdatabase.ParamRequest{By: "id", Value: 9})
+				return err
+			},
+			wantErrors: 1,
+		},
+		{
+			name:      "transaction",
+			operation: "tx",
+			call: func() error {
+				return db.WithTx(ctx, func(ctx context.Context, tx tdatabase.DBOperations) error {
+					return tx.Delete(ctx, &item{}, 1)
+				})
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); (err != nil) != (tt.wantErrors > 0) {
+				t.Fatalf("call error = %v", err)
+			}
+			if testutil.CollectAndCount(dbDuration) == 0 {
+				t.Errorf("no duration recorded")
+			}
+			if got := testutil.ToFloat64(dbErrors.WithLabelValues("memory", tt.operation)); got != tt.wantErrors {
+				t.Errorf("errors of %s = %v, want %v", tt.operation, got, tt.wantErrors)
+			}
+		})
+	}
+	if got := testutil.ToFloat64(dbErrors.WithLabelValues("memory", "delete")); got != 0 {
+		t.Errorf("errors of the delete in the transaction = %v, want 0", got)
+	}
+}
+
+func TestObserve(t *testing.T) {
+	start := time.Now()
+	ObserveHTTP(http.MethodGet, "/api/{model}/{route-type}/", "task", "get-many", http.StatusOK, start)
+	ObserveHook("task", "after-save", start, errors.New("boom"))
+	MQTTPublished("tasks")
+	MQTTReceived("tasks")
+
+	tests := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{name: "http requests", got: testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, "/api/{model}/{route-type}/", "task", "get-many", "200")), want: 1},
+		{name: "hook errors", got: testutil.ToFloat64(hookErrors.WithLabelValues("task", "after-save")), want: 1},
+		{name: "published", got: testutil.ToFloat64(mqttPublished.WithLabelValues("tasks")), want: 1},
+		{name: "received", got: testutil.ToFloat64(mqttReceived.WithLabelValues("tasks")), want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	MQTTPublished("handler")
+	srv := httptest.NewServer(Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("http.Get() error = %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{`tofu_mqtt_messages_published_total{topic="handler"} 1`, "go_goroutines", "process_"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics body does not contain %s", want)
+		}
+	}
+}
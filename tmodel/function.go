@@ -2,32 +2,59 @@ package tmodel
 
 import (
 	"context"
+	"errors"
 
 	"github.com/WojciechWiderski/tofu/tdatabase"
 )
 
+// FunctionType is the stage of a route at which a hook chain runs, in the order of the constants.
 type FunctionType uint8
 
 const (
 	WrongFnType FunctionType = iota
-	FnBeforeDBO
-	FnAfterDBO
+	// FnBeforeValidate runs on the decoded payload before the validate tags and the validators.
+	FnBeforeValidate
+	// FnBeforeSave runs before the database call, after the validation and the authorization.
+	FnBeforeSave
+	// FnAfterSave runs after the database call in the transaction of the route.
+	FnAfterSave
+	// FnAfterCommit runs once the transaction is committed, an error no longer undoes the write.
+	FnAfterCommit
+	// FnBeforeRespond runs last and may replace Event.Response.
+	FnBeforeRespond
+)
+
+// FnBeforeDBO and FnAfterDBO are the former names of FnBeforeSave and FnAfterSave.
+const (
+	FnBeforeDBO = FnBeforeSave
+	FnAfterDBO  = FnAfterSave
 )
 
 var FunctionTypeMap = map[string]FunctionType{
-	"wrong-fn-type": WrongFnType,
-	"fn-before-dbo": FnBeforeDBO,
-	"fn-after-dbo":  FnAfterDBO,
+	"wrong-fn-type":   WrongFnType,
+	"before-validate": FnBeforeValidate,
+	"before-save":     FnBeforeSave,
+	"after-save":      FnAfterSave,
+	"after-commit":    FnAfterCommit,
+	"before-respond":  FnBeforeRespond,
+	"fn-before-dbo":   FnBeforeDBO,
+	"fn-after-dbo":    FnAfterDBO,
 }
 
 func (rt FunctionType) String() string {
 	switch rt {
 	case WrongFnType:
 		return "wrong-fn-type"
-	case FnBeforeDBO:
-		return "fn-before-dbo"
-	case FnAfterDBO:
-		return "fn-after-dbo"
+	case FnBeforeValidate:
+		return "before-validate"
+	case FnBeforeSave:
+		return "before-save"
+	case FnAfterSave:
+		return "after-save"
+	case FnAfterCommit:
+		return "after-commit"
+	case FnBeforeRespond:
+		return "before-respond"
 	default:
 		return ""
 	}
@@ -45,16 +72,67 @@ func NewFunctionType(in string) FunctionType {
 	}
 }
 
+// ErrStop ends the route from a hook without an error, the route responds with Event.Response. The
+// database work done so far is committed and the later stages do not run.
+var ErrStop = errors.New("hook stopped the route")
+
+// Event is the state of a route passed along its hook chains.
+type Event struct {
+	Model     *Model
+	RouteType RouteType
+	Stage     FunctionType
+	// In is the entity of the route: the decoded payload on add-one and, until the save, on update, the
+	// stored record on get-one and after the update, a zero value on the other route types. A hook may
+	// change it or set another value of the model type.
+	In interface{}
+	// Items are the decoded payloads of add-many.
+	Items []interface{}
+	// ID is the id of the update and delete-one routes, see Model.ParseID.
+	ID       interface{}
+	Params   tdatabase.ParamRequest
+	Response interface{}
+	DB       tdatabase.DBOperations
+}
+
+// Hook is a function of a chain, an error rejects the route and ErrStop ends it.
+type Hook func(ctx context.Context, e *Event) error
+
 type Fn struct {
 	FunctionType FunctionType
 	RouteType    RouteType
-	F            func(ctx context.Context, operations tdatabase.DBOperations) (interface{}, error)
+	Hook         Hook
 }
 
+// NewFn adapts a function of the former signature, a non-nil result replaces Event.In.
 func NewFn(fnType FunctionType, rType RouteType, f func(ctx context.Context, operations tdatabase.DBOperations) (interface{}, error)) Fn {
 	return Fn{
 		FunctionType: fnType,
 		RouteType:    rType,
-		F:            f,
+		Hook: func(ctx context.Context, e *Event) error {
+			out, err := f(ctx, e.DB)
+			if err != nil {
+				return err
+			}
+			if out != nil {
+				e.In = out
+			}
+			return nil
+		},
+	}
+}
+
+// Chain returns the hooks of stage for routeType in the order they were added, the RouteAll hooks first.
+func (m *Model) Chain(routeType RouteType, stage FunctionType) []Fn {
+	var chain []Fn
+	for _, rt := range []RouteType{RouteAll, routeType} {
+		for _, fn := range m.Functions[rt] {
+			if fn.FunctionType == stage {
+				chain = append(chain, fn)
+			}
+		}
+		if routeType == RouteAll {
+			break
+		}
 	}
+	return chain
 }
@@ -0,0 +1,108 @@
+package tmodel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/WojciechWiderski/tofu/tdatabase"
+)
+
+func TestModel_Chain(t *testing.T) {
+	var ran []string
+	hook := func(name string) Hook {
+		return func(ctx context.Context, e *Event) error {
+			ran = append(ran, name)
+			return nil
+		}
+	}
+	model := NewModel(&task{}, "task").
+		AddHook(RouteAddOne, FnBeforeSave, hook("add-one 1")).
+		AddHook(RouteAll, FnBeforeSave, hook("all")).
+		AddHook(RouteAddOne, FnAfterSave, hook("after-save")).
+		AddHook(RouteAddOne, FnBeforeSave, hook("add-one 2")).
+		AddHook(RouteUpdate, FnBeforeSave, hook("update"))
+
+	tests := []struct {
+		name      string
+		routeType RouteType
+		stage     FunctionType
+		want      []string
+	}{
+		{name: "route type after all", routeType: RouteAddOne, stage: FnBeforeSave, want: []string{"all", "add-one 1", "add-one 2"}},
+		{name: "stage", routeType: RouteAddOne, stage: FnAfterSave, want: []string{"after-save"}},
+		{name: "other route type", routeType: RouteGetOne, stage: FnBeforeSave, want: []string{"all"}},
+		{name: "all once", routeType: RouteAll, stage: FnBeforeSave, want: []string{"all"}},
+		{name: "empty", routeType: RouteAddOne, stage: FnBeforeRespond, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ran = nil
+			for _, fn := range model.Chain(tt.routeType, tt.stage) {
+				if err := fn.Hook(context.Background(), &Event{}); err != nil {
+					t.Fatalf("Hook() error = %v", err)
+				}
+			}
+			if len(ran) != len(tt.want) {
+				t.Fatalf("ran %v, want %v", ran, tt.want)
+			}
+			for i := range ran {
+				if ran[i] != tt.want[i] {
+					t.Errorf("ran %v, want %v", ran, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewFn(t *testing.T) {
+	errFn := errors.New("fn failed")
+	stored := &task{Title: "stored"}
+
+	tests := []struct {
+		name    string
+		out     interface{}
+		err     error
+		wantIn  interface{}
+		wantErr error
+	}{
+		{name: "replace in", out: stored, wantIn: stored},
+		{name: "keep in", wantIn: &task{Title: "in"}},
+		{name: "error", err: errFn, wantIn: &task{Title: "in"}, wantErr: errFn},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := NewFn(FnBeforeSave, RouteAddOne, func(ctx context.Context, operations tdatabase.DBOperations) (interface{}, error) {
+				return tt.out, tt.err
+			})
+			event := &Event{In: &task{Title: "in"}}
+			if err := fn.Hook(context.Background(), event); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Hook() error = %v, want %v", err, tt.wantErr)
+			}
+			if got, want := event.In.(*task).Title, tt.wantIn.(*task).Title; got != want {
+				t.Errorf("In.Title = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestNewFunctionType(t *testing.T) {
+	tests := []struct {
+		in   string
+		want FunctionType
+	}{
+		{in: "before-validate", want: FnBeforeValidate},
+		{in: "after-commit", want: FnAfterCommit},
+		{in: "fn-before-dbo", want: FnBeforeSave},
+		{in: "fn-after-dbo", want: FnAfterSave},
+		{in: "", want: WrongFnType},
+		{in: "nope", want: WrongFnType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := NewFunctionType(tt.in); got != tt.want {
+				t.Errorf("NewFunctionType(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
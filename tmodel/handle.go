@@ -0,0 +1,144 @@
+package tmodel
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/WojciechWiderski/tofu/tdatabase"
+	"github.com/WojciechWiderski/tofu/terror"
+)
+
+// Handle is the typed access to a model added by Register, its methods call the Store of the model
+// directly, the hook chains run on the http routes only.
+type Handle[T any] struct {
+	Model *Model
+}
+
+// TypedHook is a Hook receiving Event.In as a T, it may change the record in place.
+type TypedHook[T any] func(ctx context.Context, in *T) error
+
+// Register adds a model of T named name to models and returns its typed handle, the model gets the
+// generic http routes like one added with Models.Set.
+func Register[T any](models *Models, name string) *Handle[T] {
+	model := NewModel(new(T), name)
+	model.newIn = func() interface{} { return new(T) }
+	models.Set(model)
+	return &Handle[T]{Model: model}
+}
+
+// AddHook appends hook to the functionType chain of routeType, see Event.In for the record it receives.
+// On add-many the hook runs for every item.
+func (h *Handle[T]) AddHook(routeType RouteType, functionType FunctionType, hook TypedHook[T]) *Handle[T] {
+	h.Model.AddHook(routeType, functionType, func(ctx context.Context, e *Event) error {
+		if e.Items != nil {
+			for _, item := range e.Items {
+				if err := h.callHook(ctx, hook, item); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return h.callHook(ctx, hook, e.In)
+	})
+	return h
+}
+
+func (h *Handle[T]) callHook(ctx context.Context, hook TypedHook[T], in interface{}) error {
+	typed, ok := in.(*T)
+	if !ok {
+		return terror.NewInternal(fmt.Sprintf("hook of %s got %T", h.Model.Name, in))
+	}
+	return hook(ctx, typed)
+}
+
+func (h *Handle[T]) BeforeValidate(routeType RouteType, hook TypedHook[T]) *Handle[T] {
+	return h.AddHook(routeType, FnBeforeValidate, hook)
+}
+
+func (h *Handle[T]) BeforeSave(routeType RouteType, hook TypedHook[T]) *Handle[T] {
+	return h.AddHook(routeType, FnBeforeSave, hook)
+}
+
+func (h *Handle[T]) AfterSave(routeType RouteType, hook TypedHook[T]) *Handle[T] {
+	return h.AddHook(routeType, FnAfterSave, hook)
+}
+
+func (h *Handle[T]) AfterCommit(routeType RouteType, hook TypedHook[T]) *Handle[T] {
+	return h.AddHook(routeType, FnAfterCommit, hook)
+}
+
+func (h *Handle[T]) store() (tdatabase.DBOperations, error) {
+	if h.Model.Store == nil {
+		return nil, terror.NewInternal(fmt.Sprintf("model %s has no store, run the app first", h.Model.Name))
+	}
+	return h.Model.Store, nil
+}
+
+// Create adds in, its id is set on return.
+func (h *Handle[T]) Create(ctx context.Context, in *T) error {
+	store, err := h.store()
+	if err != nil {
+		return err
+	}
+	if err := store.Add(ctx, in); err != nil {
+		return terror.Wrap(fmt.Sprintf("store.Add model - %s", h.Model.Name), err)
+	}
+	return nil
+}
+
+func (h *Handle[T]) Get(ctx context.Context, id interface{}) (*T, error) {
+	return h.GetBy(ctx, tdatabase.ParamRequest{By: "id", Value: id})
+}
+
+// GetBy returns the first record matching params, NotFound without one.
+func (h *Handle[T]) GetBy(ctx context.Context, params tdatabase.ParamRequest) (*T, error) {
+	store, err := h.store()
+	if err != nil {
+		return nil, err
+	}
+	out, err := store.GetOne(ctx, new(T), params)
+	if err != nil {
+		return nil, terror.Wrap(fmt.Sprintf("store.GetOne model - %s by - %v by value - %v.", h.Model.Name, params.By, params.Value), err)
+	}
+	return out.(*T), nil
+}
+
+func (h *Handle[T]) List(ctx context.Context, params tdatabase.ParamRequest) ([]*T, error) {
+	store, err := h.store()
+	if err != nil {
+		return nil, err
+	}
+	items, err := store.GetMany(ctx, new(T), params)
+	if err != nil {
+		return nil, terror.Wrap(fmt.Sprintf("store.GetMany model - %s", h.Model.Name), err)
+	}
+	out := make([]*T, 0, len(items))
+	for _, item := range items {
+		out = append(out, item.(*T))
+	}
+	return out, nil
+}
+
+// Update writes the non-zero fields of update to the record id and returns the updated record.
+func (h *Handle[T]) Update(ctx context.Context, id interface{}, update *T) (*T, error) {
+	store, err := h.store()
+	if err != nil {
+		return nil, err
+	}
+	out := new(T)
+	if err := store.Update(ctx, update, out, id); err != nil {
+		return nil, terror.Wrap(fmt.Sprintf("store.Update model - %s id - %v", h.Model.Name, id), err)
+	}
+	return out, nil
+}
+
+func (h *Handle[T]) Delete(ctx context.Context, id interface{}) error {
+	store, err := h.store()
+	if err != nil {
+		return err
+	}
+	if err := store.Delete(ctx, new(T), id); err != nil {
+		return terror.Wrap(fmt.Sprintf("store.Delete model - %s id - %v", h.Model.Name, id), err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package tmodel
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/WojciechWiderski/tofu/tdatabase"
+	"github.com/WojciechWiderski/tofu/terror"
+)
+
+type task struct {
+	ID    uint   `json:"id"`
+	Title string `json:"title"`
+}
+
+func TestRegister(t *testing.T) {
+	models := NewModels()
+	tasks := Register[task](models, "task")
+
+	if got := models.Get("task"); got != tasks.Model {
+		t.Fatalf("models.Get() = %v, want the registered model", got)
+	}
+	if _, ok := tasks.Model.NewIn().(*task); !ok {
+		t.Errorf("NewIn() = %T, want *task", tasks.Model.NewIn())
+	}
+	raw, err := models.GetRawModel("task")
+	if err != nil {
+		t.Fatalf("GetRawModel() error = %v", err)
+	}
+	if _, ok := raw.In.(*task); !ok {
+		t.Errorf("GetRawModel().In = %T, want *task", raw.In)
+	}
+}
+
+func TestHandle_AddHook(t *testing.T) {
+	errHook := errors.New("hook failed")
+	tests := []struct {
+		name      string
+		event     *Event
+		hookErr   error
+		wantTitle []string
+		wantErr   error
+	}{
+		{name: "in", event: &Event{In: &task{Title: "a"}}, wantTitle: []string{"A"}},
+		{name: "items", event: &Event{Items: []interface{}{&task{Title: "a"}, &task{Title: "b"}}}, wantTitle: []string{"A", "B"}},
+		{name: "hook error", event: &Event{In: &task{Title: "a"}}, hookErr: errHook, wantErr: errHook},
+		{name: "stop", event: &Event{In: &task{Title: "a"}}, hookErr: ErrStop, wantErr: ErrStop},
+		{name: "other type", event: &Event{In: &struct{}{}}, wantErr: terror.Internal},
+		{name: "other item type", event: &Event{Items: []interface{}{&task{Title: "a"}, "b"}}, wantErr: terror.Internal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tasks := Register[task](NewModels(), "task")
+			tasks.BeforeSave(RouteAll, func(ctx context.Context, in *task) error {
+				in.Title = strings.ToUpper(in.Title)
+				return tt.hookErr
+			})
+
+			chain := tasks.Model.Chain(RouteAddOne, FnBeforeSave)
+			if len(chain) != 1 {
+				t.Fatalf("Chain() = %d hooks, want 1", len(chain))
+			}
+			err := chain[0].Hook(context.Background(), tt.event)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("Hook() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantTitle == nil {
+				return
+			}
+			var got []string
+			if tt.event.Items != nil {
+				for _, item := range tt.event.Items {
+					got = append(got, item.(*task).Title)
+				}
+			} else {
+				got = append(got, tt.event.In.(*task).Title)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantTitle, ",") {
+				t.Errorf("titles = %v, want %v", got, tt.wantTitle)
+			}
+		})
+	}
+}
+
+func TestHandle_Stages(t *testing.T) {
+	tasks := Register[task](NewModels(), "task")
+	hook := func(context.Context, *task) error { return nil }
+	tasks.BeforeValidate(RouteAddOne, hook).
+		BeforeSave(RouteAddOne, hook).
+		AfterSave(RouteAddOne, hook).
+		AfterCommit(RouteAddOne, hook)
+
+	for _, stage := range []FunctionType{FnBeforeValidate, FnBeforeSave, FnAfterSave, FnAfterCommit} {
+		if got := len(tasks.Model.Chain(RouteAddOne, stage)); got != 1 {
+			t.Errorf("Chain(%s) = %d hooks, want 1", stage, got)
+		}
+	}
+}
+
+func TestHandle_NoStore(t *testing.T) {
+	ctx := context.Background()
+	tasks := Register[task](NewModels(), "task")
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{name: "create", call: func() error { return tasks.Create(ctx, &task{}) }},
+		{name: "get", call: func() error { _, err := tasks.Get(ctx, 1); return err }},
+		{name: "list", call: func() error { _, err := tasks.List(ctx, tdatabase.ParamRequest{}); return err }},
+		{name: "update", call: func() error { _, err := tasks.Update(ctx, 1, &task{}); return err }},
+		{name: "delete", call: func() error { return tasks.Delete(ctx, 1) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, terror.Internal) {
+				t.Errorf("error = %v, want Internal", err)
+			}
+		})
+	}
+}
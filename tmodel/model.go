@@ -4,38 +4,121 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm/schema"
 
 	"github.com/WojciechWiderski/tofu/tdatabase"
+	"github.com/WojciechWiderski/tofu/terror"
 	"github.com/WojciechWiderski/tofu/tlogger"
 )
 
 type Model struct {
-	Name      string
-	In        interface{}
-	Functions map[RouteType]Fn
-	Routes    map[string]map[string]Route
-	Store     tdatabase.DBOperations
+	Name       string
+	In         interface{}
+	Functions  map[RouteType][]Fn
+	Routes     map[string]map[string]Route
+	Validators []Validator
+	Roles      map[RouteType][]string
+	Authorizer Authorizer
+	// Internal models are migrated with the others but get no generic routes, e.g. the api_key model.
+	Internal bool
+	Store    tdatabase.DBOperations
+
+	newIn     func() interface{}
+	relations []Relation
+	idKind    reflect.Kind
 }
 
+// Validator checks a decoded payload of the model on add and update routes and returns the failing fields.
+type Validator func(ctx context.Context, in interface{}) []terror.FieldError
+
 func NewModel(in interface{}, name string) *Model {
 	tlogger.Info(fmt.Sprintf("Model %s created.", name))
+	s := parseSchema(in, name)
 	return &Model{
 		Name:      name,
 		In:        in,
-		Functions: make(map[RouteType]Fn),
+		Functions: make(map[RouteType][]Fn),
 		Routes:    make(map[string]map[string]Route),
+		Roles:     make(map[RouteType][]string),
+		relations: relationsOf(s, MaxIncludeDepth),
+		idKind:    primaryKeyKind(s),
+	}
+}
+
+// primaryKeyKind returns the kind of the primary key of s, Invalid without a schema or a primary key.
+func primaryKeyKind(s *schema.Schema) reflect.Kind {
+	if s == nil || s.PrioritizedPrimaryField == nil {
+		return reflect.Invalid
+	}
+	return s.PrioritizedPrimaryField.IndirectFieldType.Kind()
+}
+
+// ParseID converts an id from a path or query to the primary key type of the model. A string key, e.g. a
+// uuid, is passed on as it is, any other key must be an integer.
+func (m *Model) ParseID(id string) (interface{}, error) {
+	switch m.idKind {
+	case reflect.String, reflect.Array, reflect.Slice:
+		if id == "" {
+			return nil, terror.NewBadRequest("missing id")
+		}
+		return id, nil
+	}
+	parsed, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, terror.NewBadRequest(fmt.Sprintf("wrong id %s", id))
+	}
+	return parsed, nil
+}
+
+// NewIn returns a pointer to a new zero value of the model type, models added by Register skip reflect.
+func (m *Model) NewIn() interface{} {
+	if m.newIn != nil {
+		return m.newIn()
 	}
+	return reflect.New(reflect.ValueOf(m.In).Elem().Type()).Interface()
 }
 
+// AddFunc appends f to the functionType chain of routeType, see NewFn.
 func (m *Model) AddFunc(routeType RouteType, functionType FunctionType, f func(ctx context.Context, operations tdatabase.DBOperations) (interface{}, error)) *Model {
-	m.Functions[routeType] = NewFn(functionType, routeType, f)
+	m.Functions[routeType] = append(m.Functions[routeType], NewFn(functionType, routeType, f))
 	tlogger.Info(fmt.Sprintf("AddFunc for model - %s, route type: %s, function type: %s", m.Name, routeType.String(), functionType.String()))
 	return m
 }
 
+// AddHook appends hook to the functionType chain of routeType, RouteAll chains run before the others.
+func (m *Model) AddHook(routeType RouteType, functionType FunctionType, hook Hook) *Model {
+	m.Functions[routeType] = append(m.Functions[routeType], Fn{FunctionType: functionType, RouteType: routeType, Hook: hook})
+	tlogger.Info(fmt.Sprintf("AddHook for model - %s, route type: %s, function type: %s", m.Name, routeType.String(), functionType.String()))
+	return m
+}
+
+// AddValidator adds a check run after the validate struct tags and before FnBeforeDBO.
+func (m *Model) AddValidator(validator Validator) *Model {
+	m.Validators = append(m.Validators, validator)
+	tlogger.Info(fmt.Sprintf("AddValidator for model - %s", m.Name))
+	return m
+}
+
+// AddRoute adds an own route, it panics on an invalid route or one matching the paths of an added route
+// of the same method, so a conflict stops the app at startup.
 func (m *Model) AddRoute(route Route) *Model {
-	_, ok := m.Routes[route.Method][route.Pattern]
-	if !ok {
+	route.Method = strings.ToUpper(route.Method)
+	route.Pattern = strings.Trim(route.Pattern, "/")
+	if err := route.Validate(); err != nil {
+		panic(terror.Wrap(fmt.Sprintf("AddRoute model - %s", m.Name), err))
+	}
+
+	shape, _ := routeShape(route.Pattern)
+	for pattern := range m.Routes[route.Method] {
+		if other, _ := routeShape(pattern); other == shape {
+			panic(terror.NewConflict(fmt.Sprintf("AddRoute model - %s: %s %s conflicts with %s", m.Name, route.Method, route.Pattern, pattern)))
+		}
+	}
+
+	if _, ok := m.Routes[route.Method]; !ok {
 		m.Routes[route.Method] = make(map[string]Route)
 	}
 	m.Routes[route.Method][route.Pattern] = route
@@ -67,14 +150,19 @@ func (m *Models) Get(name string) *Model {
 func (m *Models) GetRawModel(name string) (*Model, error) {
 	for _, model := range m.All {
 		if model.Name == name {
-			newModelIn := reflect.New(reflect.ValueOf(model.In).Elem().Type()).Interface()
-
 			return &Model{
-				In:        newModelIn,
-				Name:      model.Name,
-				Functions: model.Functions,
-				Routes:    model.Routes,
-				Store:     model.Store,
+				In:         model.NewIn(),
+				Name:       model.Name,
+				Functions:  model.Functions,
+				Routes:     model.Routes,
+				Validators: model.Validators,
+				Roles:      model.Roles,
+				Authorizer: model.Authorizer,
+				Internal:   model.Internal,
+				Store:      model.Store,
+				newIn:      model.newIn,
+				relations:  model.relations,
+				idKind:     model.idKind,
 			}, nil
 		}
 	}
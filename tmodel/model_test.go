@@ -0,0 +1,45 @@
+package tmodel
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/WojciechWiderski/tofu/terror"
+)
+
+func TestModel_ParseID(t *testing.T) {
+	type code struct {
+		Code string `gorm:"primaryKey"`
+	}
+	type token struct {
+		ID uuid.UUID
+	}
+
+	tests := []struct {
+		name    string
+		in      interface{}
+		id      string
+		want    interface{}
+		wantErr error
+	}{
+		{name: "integer key", in: &task{}, id: "5", want: 5},
+		{name: "integer key with text", in: &task{}, id: "abc", wantErr: terror.BadRequest},
+		{name: "integer key empty", in: &task{}, id: "", wantErr: terror.BadRequest},
+		{name: "string key", in: &code{}, id: "abc", want: "abc"},
+		{name: "string key empty", in: &code{}, id: "", wantErr: terror.BadRequest},
+		{name: "uuid key", in: &token{}, id: "3f1c2a9e-7b4d-4c2e-9a51-0d6f8e2b7c10", want: "3f1c2a9e-7b4d-4c2e-9a51-0d6f8e2b7c10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewModel(tt.in, "model").ParseID(tt.id)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("ParseID() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseID() = %v (%T), want %v (%T)", got, got, tt.want, tt.want)
+			}
+		})
+	}
+}
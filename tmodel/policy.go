@@ -0,0 +1,45 @@
+package tmodel
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/WojciechWiderski/tofu/tlogger"
+)
+
+// Authorizer makes row level decisions on a route type of a model. record is the stored record for
+// delete-one, the fetched record for get-one, the decoded payload for add-one and each item for add-many,
+// and nil for get-many, delete-many and own routes. Update is authorized twice, on the stored record and
+// on the record as it will be saved, and fails if either is refused. An error without a terror kind is
+// Forbidden.
+type Authorizer interface {
+	Authorize(ctx context.Context, routeType RouteType, record interface{}) error
+}
+
+type AuthorizerFunc func(ctx context.Context, routeType RouteType, record interface{}) error
+
+func (f AuthorizerFunc) Authorize(ctx context.Context, routeType RouteType, record interface{}) error {
+	return f(ctx, routeType, record)
+}
+
+// AllowRoles restricts routeType to callers with one of roles, RouteAll restricts the route types without
+// roles of their own.
+func (m *Model) AllowRoles(routeType RouteType, roles ...string) *Model {
+	m.Roles[routeType] = append(m.Roles[routeType], roles...)
+	tlogger.Info(fmt.Sprintf("AllowRoles for model - %s, route type: %s, roles: %v", m.Name, routeType.String(), roles))
+	return m
+}
+
+func (m *Model) SetAuthorizer(authorizer Authorizer) *Model {
+	m.Authorizer = authorizer
+	tlogger.Info(fmt.Sprintf("SetAuthorizer for model - %s", m.Name))
+	return m
+}
+
+// RolesFor returns the roles allowed on routeType, nil when every caller is.
+func (m *Model) RolesFor(routeType RouteType) []string {
+	if roles, ok := m.Roles[routeType]; ok {
+		return roles
+	}
+	return m.Roles[RouteAll]
+}
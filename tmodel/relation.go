@@ -0,0 +1,134 @@
+package tmodel
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm/schema"
+
+	"github.com/WojciechWiderski/tofu/terror"
+	"github.com/WojciechWiderski/tofu/tlogger"
+)
+
+// MaxIncludeDepth limits the nesting of an include, e.g. dates.task is two levels deep.
+var MaxIncludeDepth = 2
+
+type RelationKind uint8
+
+const (
+	WrongRelation RelationKind = iota
+	RelationHasOne
+	RelationHasMany
+	RelationBelongsTo
+	RelationManyToMany
+)
+
+var RelationKindMap = map[schema.RelationshipType]RelationKind{
+	schema.HasOne:    RelationHasOne,
+	schema.HasMany:   RelationHasMany,
+	schema.BelongsTo: RelationBelongsTo,
+	schema.Many2Many: RelationManyToMany,
+}
+
+func (k RelationKind) String() string {
+	switch k {
+	case RelationHasOne:
+		return "has-one"
+	case RelationHasMany:
+		return "has-many"
+	case RelationBelongsTo:
+		return "belongs-to"
+	case RelationManyToMany:
+		return "many-to-many"
+	default:
+		return "wrong"
+	}
+}
+
+// Relation is an association of a model derived from its struct fields and gorm tags. Name is the snake
+// case field name used by ?include=, Field the struct field preloaded by the gorm backends.
+type Relation struct {
+	Name      string
+	Field     string
+	Kind      RelationKind
+	Table     string
+	Relations []Relation
+}
+
+var relationNaming = schema.NamingStrategy{}
+
+// parseSchema returns the gorm schema of in, a type gorm cannot parse has no schema and so no relations.
+func parseSchema(in interface{}, name string) *schema.Schema {
+	s, err := schema.Parse(in, &sync.Map{}, relationNaming)
+	if err != nil {
+		tlogger.Warn(fmt.Sprintf("Schema of model %s not parsed: %v", name, err))
+		return nil
+	}
+	return s
+}
+
+// relationsOf returns the relations of s up to depth levels.
+func relationsOf(s *schema.Schema, depth int) []Relation {
+	if s == nil || depth == 0 {
+		return nil
+	}
+	var relations []Relation
+	for _, rel := range s.Relationships.Relations {
+		relation := Relation{
+			Name:  relationNaming.ColumnName("", rel.Name),
+			Field: rel.Name,
+			Kind:  RelationKindMap[rel.Type],
+			Table: rel.FieldSchema.Table,
+		}
+		if rel.FieldSchema != s {
+			relation.Relations = relationsOf(rel.FieldSchema, depth-1)
+		}
+		relations = append(relations, relation)
+	}
+	return relations
+}
+
+// Relations returns the relations of the model.
+func (m *Model) Relations() []Relation {
+	return m.relations
+}
+
+// Includes checks every include, a dot separated path of relation names such as dates or
+// days_of_the_week.task, and returns them as preload paths of struct fields. An unknown relation or
+// one nested deeper than MaxIncludeDepth is a BadRequest.
+func (m *Model) Includes(includes []string) ([]string, error) {
+	var paths []string
+	for _, include := range includes {
+		include = strings.TrimSpace(include)
+		if include == "" {
+			continue
+		}
+		names := strings.Split(include, ".")
+		if len(names) > MaxIncludeDepth {
+			return nil, terror.NewBadRequest(fmt.Sprintf("include %s is deeper than %d", include, MaxIncludeDepth))
+		}
+
+		relations := m.relations
+		fields := make([]string, len(names))
+		for i, name := range names {
+			relation, ok := findRelation(relations, name)
+			if !ok {
+				return nil, terror.NewBadRequest(fmt.Sprintf("model %s has no relation %s", m.Name, include))
+			}
+			fields[i] = relation.Field
+			relations = relation.Relations
+		}
+		paths = append(paths, strings.Join(fields, "."))
+	}
+	return paths, nil
+}
+
+func findRelation(relations []Relation, name string) (Relation, bool) {
+	for _, relation := range relations {
+		if relation.Name == name || relation.Field == name {
+			return relation, true
+		}
+	}
+	return Relation{}, false
+}
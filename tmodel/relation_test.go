@@ -0,0 +1,95 @@
+package tmodel
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/WojciechWiderski/tofu/terror"
+)
+
+type project struct {
+	ID            uint
+	Name          string
+	OwnerID       uint
+	Owner         *owner
+	Tasks         []projectTask
+	DaysOfTheWeek []day `gorm:"many2many:project_days"`
+}
+
+type owner struct {
+	ID      uint
+	Profile *profile
+}
+
+type profile struct {
+	ID      uint
+	OwnerID uint
+}
+
+type projectTask struct {
+	ID        uint
+	ProjectID uint
+	Project   *project
+}
+
+type day struct {
+	ID   uint
+	Name string
+}
+
+func TestModel_Relations(t *testing.T) {
+	relations := NewModel(&project{}, "project").Relations()
+
+	want := map[string]RelationKind{
+		"owner":            RelationBelongsTo,
+		"tasks":            RelationHasMany,
+		"days_of_the_week": RelationManyToMany,
+	}
+	if len(relations) != len(want) {
+		t.Fatalf("Relations() = %+v, want %d relations", relations, len(want))
+	}
+	for _, relation := range relations {
+		if kind, ok := want[relation.Name]; !ok || kind != relation.Kind {
+			t.Errorf("relation %s = %s, want %s", relation.Name, relation.Kind, kind)
+		}
+		if relation.Name == "owner" && (len(relation.Relations) != 1 || relation.Relations[0].Kind != RelationHasOne) {
+			t.Errorf("owner relations = %+v, want a has-one profile", relation.Relations)
+		}
+	}
+
+	if got := NewModel(&day{}, "day").Relations(); len(got) != 0 {
+		t.Errorf("Relations() of day = %+v, want none", got)
+	}
+}
+
+func TestModel_Includes(t *testing.T) {
+	model := NewModel(&project{}, "project")
+
+	tests := []struct {
+		name     string
+		includes []string
+		want     string
+		wantErr  error
+	}{
+		{name: "none", includes: nil, want: ""},
+		{name: "snake case", includes: []string{"days_of_the_week"}, want: "DaysOfTheWeek"},
+		{name: "field name", includes: []string{"Tasks"}, want: "Tasks"},
+		{name: "several", includes: []string{"owner", " tasks ", ""}, want: "Owner,Tasks"},
+		{name: "nested", includes: []string{"owner.profile", "tasks.project"}, want: "Owner.Profile,Tasks.Project"},
+		{name: "unknown", includes: []string{"members"}, wantErr: terror.BadRequest},
+		{name: "unknown nested", includes: []string{"owner.members"}, wantErr: terror.BadRequest},
+		{name: "too deep", includes: []string{"tasks.project.owner"}, wantErr: terror.BadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := model.Includes(tt.includes)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("Includes() error = %v, want %v", err, tt.wantErr)
+			}
+			if strings.Join(got, ",") != tt.want {
+				t.Errorf("Includes() = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,16 +2,23 @@ package tmodel
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"regexp"
+	"strings"
 
 	"github.com/WojciechWiderski/tofu/tdatabase"
+	"github.com/WojciechWiderski/tofu/terror"
 )
 
+// Route is an own route of a model served at /api/{model}/own/{Pattern}, Pattern is a chi pattern which
+// may hold path params such as {id} or {day:[0-9]+}. Middlewares run after the authentication.
 type Route struct {
-	RouteType RouteType
-	Pattern   string
-	Fn        func(ctx context.Context, w http.ResponseWriter, r *http.Request, operations tdatabase.DBOperations) (interface{}, error)
-	Method    string
+	RouteType   RouteType
+	Pattern     string
+	Fn          func(ctx context.Context, w http.ResponseWriter, r *http.Request, operations tdatabase.DBOperations) (interface{}, error)
+	Method      string
+	Middlewares []func(http.Handler) http.Handler
 }
 
 type RouteType uint8
@@ -79,6 +86,80 @@ func (rt RouteType) String() string {
 	}
 }
 
-func NewRoute(routeType RouteType, pattern string, method string, fn func(ctx context.Context, w http.ResponseWriter, r *http.Request, operations tdatabase.DBOperations) (interface{}, error)) {
-	// sprawdzać czy pattern jest ok i czy toutetype jest ok, przenieiść z set route, albo do set route
+// RouteMethods are the methods of own routes.
+var RouteMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+var (
+	patternSegment = regexp.MustCompile(`^[A-Za-z0-9._~-]+$`)
+	patternParam   = regexp.MustCompile(`^\{([A-Za-z_][A-Za-z0-9_]*)(?::(.+))?\}$`)
+)
+
+// NewRoute returns an own route after checking method and pattern, e.g.
+// NewRoute(RouteOwn, "{id}/done", http.MethodPost, fn, middlewares...).
+func NewRoute(routeType RouteType, pattern string, method string, fn func(ctx context.Context, w http.ResponseWriter, r *http.Request, operations tdatabase.DBOperations) (interface{}, error), middlewares ...func(http.Handler) http.Handler) (Route, error) {
+	route := Route{
+		RouteType:   routeType,
+		Pattern:     strings.Trim(pattern, "/"),
+		Fn:          fn,
+		Method:      strings.ToUpper(method),
+		Middlewares: middlewares,
+	}
+	if err := route.Validate(); err != nil {
+		return Route{}, terror.Wrap("route.Validate", err)
+	}
+	return route, nil
+}
+
+// Validate checks the route type, the method and the pattern of r.
+func (r Route) Validate() error {
+	if r.RouteType != RouteOwn {
+		return terror.NewBadRequest(fmt.Sprintf("route type %s is not own", r.RouteType))
+	}
+	if r.Fn == nil {
+		return terror.NewBadRequest(fmt.Sprintf("route %s %s has no fn", r.Method, r.Pattern))
+	}
+	knownMethod := false
+	for _, method := range RouteMethods {
+		knownMethod = knownMethod || method == r.Method
+	}
+	if !knownMethod {
+		return terror.NewBadRequest(fmt.Sprintf("wrong route method %q", r.Method))
+	}
+	_, err := routeShape(r.Pattern)
+	return err
+}
+
+// routeShape returns pattern with every path param replaced by {}, two routes of a method with the same
+// shape match the same paths.
+func routeShape(pattern string) (string, error) {
+	pattern = strings.Trim(pattern, "/")
+	if pattern == "" {
+		return "", terror.NewBadRequest("empty route pattern")
+	}
+
+	segments := strings.Split(pattern, "/")
+	params := map[string]bool{}
+	for i, segment := range segments {
+		if segment == "*" && i == len(segments)-1 {
+			continue
+		}
+		if patternSegment.MatchString(segment) {
+			continue
+		}
+		match := patternParam.FindStringSubmatch(segment)
+		if match == nil {
+			return "", terror.NewBadRequest(fmt.Sprintf("wrong route pattern %q segment %q", pattern, segment))
+		}
+		if params[match[1]] {
+			return "", terror.NewBadRequest(fmt.Sprintf("route pattern %q repeats param %s", pattern, match[1]))
+		}
+		params[match[1]] = true
+		if match[2] != "" {
+			if _, err := regexp.Compile(match[2]); err != nil {
+				return "", terror.Newf(terror.BadRequest, fmt.Sprintf("route pattern %q param %s", pattern, match[1]), err)
+			}
+		}
+		segments[i] = "{}"
+	}
+	return strings.Join(segments, "/"), nil
 }
@@ -0,0 +1,134 @@
+package tmodel
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/WojciechWiderski/tofu/tdatabase"
+	"github.com/WojciechWiderski/tofu/terror"
+)
+
+func ownFn(ctx context.Context, w http.ResponseWriter, r *http.Request, operations tdatabase.DBOperations) (interface{}, error) {
+	return nil, nil
+}
+
+func TestNewRoute(t *testing.T) {
+	tests := []struct {
+		name        string
+		routeType   RouteType
+		pattern     string
+		method      string
+		noFn        bool
+		wantPattern string
+		wantMethod  string
+		wantErr     bool
+	}{
+		{name: "static", routeType: RouteOwn, pattern: "/stats/", method: "get", wantPattern: "stats", wantMethod: http.MethodGet},
+		{name: "param", routeType: RouteOwn, pattern: "{id}/done", method: http.MethodPost, wantPattern: "{id}/done", wantMethod: http.MethodPost},
+		{name: "param regexp", routeType: RouteOwn, pattern: "by-day/{day:[0-9]{4}-[0-9]{2}-[0-9]{2}}", method: http.MethodGet, wantPattern: "by-day/{day:[0-9]{4}-[0-9]{2}-[0-9]{2}}", wantMethod: http.MethodGet},
+		{name: "wildcard", routeType: RouteOwn, pattern: "files/*", method: http.MethodDelete, wantPattern: "files/*", wantMethod: http.MethodDelete},
+		{name: "patch", routeType: RouteOwn, pattern: "{id}", method: http.MethodPatch, wantPattern: "{id}", wantMethod: http.MethodPatch},
+		{name: "not own", routeType: RouteGetOne, pattern: "stats", method: http.MethodGet, wantErr: true},
+		{name: "no fn", routeType: RouteOwn, pattern: "stats", method: http.MethodGet, noFn: true, wantErr: true},
+		{name: "wrong method", routeType: RouteOwn, pattern: "stats", method: "FETCH", wantErr: true},
+		{name: "empty pattern", routeType: RouteOwn, pattern: "/", method: http.MethodGet, wantErr: true},
+		{name: "wrong segment", routeType: RouteOwn, pattern: "a b", method: http.MethodGet, wantErr: true},
+		{name: "wildcard not last", routeType: RouteOwn, pattern: "*/files", method: http.MethodGet, wantErr: true},
+		{name: "repeated param", routeType: RouteOwn, pattern: "{id}/{id}", method: http.MethodGet, wantErr: true},
+		{name: "wrong param regexp", routeType: RouteOwn, pattern: "{id:[0-9}", method: http.MethodGet, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := ownFn
+			if tt.noFn {
+				fn = nil
+			}
+			route, err := NewRoute(tt.routeType, tt.pattern, tt.method, fn)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewRoute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, terror.BadRequest) {
+					t.Errorf("NewRoute() error = %v, want BadRequest", err)
+				}
+				return
+			}
+			if route.Pattern != tt.wantPattern || route.Method != tt.wantMethod {
+				t.Errorf("NewRoute() = %s %s, want %s %s", route.Method, route.Pattern, tt.wantMethod, tt.wantPattern)
+			}
+		})
+	}
+}
+
+func TestModel_AddRoute(t *testing.T) {
+	tests := []struct {
+		name      string
+		first     Route
+		second    Route
+		wantPanic bool
+	}{
+		{
+			name:   "other method",
+			first:  Route{RouteType: RouteOwn, Pattern: "{id}/done", Method: http.MethodPost, Fn: ownFn},
+			second: Route{RouteType: RouteOwn, Pattern: "{id}/done", Method: http.MethodDelete, Fn: ownFn},
+		},
+		{
+			name:   "other shape",
+			first:  Route{RouteType: RouteOwn, Pattern: "{id}/done", Method: http.MethodPost, Fn: ownFn},
+			second: Route{RouteType: RouteOwn, Pattern: "{id}/undone", Method: http.MethodPost, Fn: ownFn},
+		},
+		{
+			name:      "same pattern",
+			first:     Route{RouteType: RouteOwn, Pattern: "stats", Method: http.MethodGet, Fn: ownFn},
+			second:    Route{RouteType: RouteOwn, Pattern: "/stats/", Method: "get", Fn: ownFn},
+			wantPanic: true,
+		},
+		{
+			name:      "same shape",
+			first:     Route{RouteType: RouteOwn, Pattern: "{id}/done", Method: http.MethodPost, Fn: ownFn},
+			second:    Route{RouteType: RouteOwn, Pattern: "{taskID:[0-9]+}/done", Method: http.MethodPost, Fn: ownFn},
+			wantPanic: true,
+		},
+		{
+			name:      "invalid",
+			first:     Route{RouteType: RouteOwn, Pattern: "stats", Method: http.MethodGet, Fn: ownFn},
+			second:    Route{RouteType: RouteOwn, Pattern: "stats", Method: "FETCH", Fn: ownFn},
+			wantPanic: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := NewModel(&task{}, "task").AddRoute(tt.first)
+			defer func() {
+				if r := recover(); (r != nil) != tt.wantPanic {
+					t.Errorf("AddRoute() panic = %v, wantPanic %v", r, tt.wantPanic)
+				}
+			}()
+			model.AddRoute(tt.second)
+			if got := len(model.Routes[tt.second.Method]); got == 0 {
+				t.Errorf("Routes[%s] is empty", tt.second.Method)
+			}
+		})
+	}
+}
+
+func TestNewRouteType(t *testing.T) {
+	tests := []struct {
+		in   string
+		want RouteType
+	}{
+		{in: "get-one", want: RouteGetOne},
+		{in: "delete-many", want: RouteDeleteMany},
+		{in: "stats", want: RouteOwn},
+		{in: "", want: WrongRtType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := NewRouteType(tt.in); got != tt.want {
+				t.Errorf("NewRouteType(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package tqueue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/WojciechWiderski/tofu/ttrace"
+)
+
+// Envelope carries the trace context with a payload, MQTT 3.1.1 spoken by the client has no user
+// properties for it. JSON payloads are kept as they are, other payloads are base64 encoded in Data.
+// Version marks the message as an Envelope, so a foreign message with a trace field is left alone.
+type Envelope struct {
+	Version int               `json:"tofu_envelope"`
+	Trace   map[string]string `json:"trace"`
+	Payload json.RawMessage   `json:"payload,omitempty"`
+	Data    []byte            `json:"data,omitempty"`
+}
+
+const envelopeVersion = 1
+
+func wrap(ctx context.Context, out interface{}) ([]byte, error) {
+	payload, err := toBytes(out)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope := Envelope{Version: envelopeVersion, Trace: map[string]string{}}
+	ttrace.Inject(ctx, envelope.Trace)
+	if json.Valid(payload) {
+		envelope.Payload = payload
+	} else {
+		envelope.Data = payload
+	}
+	return json.Marshal(envelope)
+}
+
+// unwrap returns the trace context and the payload of an envelope, ok is false for any other message,
+// which is returned as it is.
+func unwrap(message []byte) (carrier map[string]string, payload []byte, ok bool) {
+	if len(message) == 0 || message[0] != '{' {
+		return nil, message, false
+	}
+	var envelope Envelope
+	if err := json.Unmarshal(message, &envelope); err != nil || envelope.Version != envelopeVersion {
+		return nil, message, false
+	}
+	if envelope.Payload != nil {
+		return envelope.Trace, envelope.Payload, true
+	}
+	return envelope.Trace, envelope.Data, true
+}
+
+func toBytes(out interface{}) ([]byte, error) {
+	switch payload := out.(type) {
+	case []byte:
+		return payload, nil
+	case string:
+		return []byte(payload), nil
+	case bytes.Buffer:
+		return payload.Bytes(), nil
+	case *bytes.Buffer:
+		return payload.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unknown payload type %T", out)
+}
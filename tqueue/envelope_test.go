@@ -0,0 +1,42 @@
+package tqueue
+
+import (
+	"context"
+	"testing"
+)
+
+func TestUnwrap(t *testing.T) {
+	wrapped, err := wrap(context.Background(), `{"x":1}`)
+	if err != nil {
+		t.Fatalf("wrap() error = %v", err)
+	}
+	binary, err := wrap(context.Background(), []byte("raw"))
+	if err != nil {
+		t.Fatalf("wrap() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		message     string
+		wantPayload string
+		wantOk      bool
+	}{
+		{name: "json envelope", message: string(wrapped), wantPayload: `{"x":1}`, wantOk: true},
+		{name: "data envelope", message: string(binary), wantPayload: "raw", wantOk: true},
+		{name: "foreign trace field", message: `{"trace":{"traceparent":"00-1"},"x":1}`, wantPayload: `{"trace":{"traceparent":"00-1"},"x":1}`},
+		{name: "other version", message: `{"tofu_envelope":2,"trace":{},"payload":{}}`, wantPayload: `{"tofu_envelope":2,"trace":{},"payload":{}}`},
+		{name: "plain json", message: `{"x":1}`, wantPayload: `{"x":1}`},
+		{name: "not json", message: "text", wantPayload: "text"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, payload, ok := unwrap([]byte(tt.message))
+			if ok != tt.wantOk {
+				t.Errorf("unwrap() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if string(payload) != tt.wantPayload {
+				t.Errorf("unwrap() payload = %s, want %s", payload, tt.wantPayload)
+			}
+		})
+	}
+}
@@ -1,11 +1,19 @@
 package tqueue
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/WojciechWiderski/tofu/tconfig"
+	"github.com/WojciechWiderski/tofu/terror"
+	"github.com/WojciechWiderski/tofu/tlogger"
+	"github.com/WojciechWiderski/tofu/tmetrics"
+	"github.com/WojciechWiderski/tofu/ttrace"
 )
 
 type MQTT struct {
@@ -26,8 +34,30 @@ type PubFn struct {
 }
 
 func (m *MQTT) AddSubscribe(topic string, fn func(in interface{})) {
+	m.AddSubscribeContext(topic, func(ctx context.Context, in interface{}) {
+		fn(in)
+	})
+}
+
+// AddSubscribeContext subscribes fn with a context carrying the consumer span, a child of the publisher
+// span when the message came in an Envelope.
+func (m *MQTT) AddSubscribeContext(topic string, fn func(ctx context.Context, in interface{})) {
 	var messagePubHandler mqtt.MessageHandler = func(client mqtt.Client, msg mqtt.Message) {
-		fn(msg.Payload())
+		tmetrics.MQTTReceived(topic)
+
+		ctx := context.Background()
+		carrier, payload, ok := unwrap(msg.Payload())
+		if ok {
+			ctx = ttrace.Extract(ctx, carrier)
+		}
+		ctx, span := ttrace.Start(ctx, topic+" receive", trace.WithSpanKind(trace.SpanKindConsumer))
+		span.SetAttributes(
+			semconv.MessagingSystem("mqtt"),
+			semconv.MessagingDestinationName(msg.Topic()),
+			semconv.MessagingOperationReceive,
+		)
+		defer span.End()
+		fn(ctx, payload)
 	}
 	m.Subscribers = append(m.Subscribers, SubFn{
 		Topic: topic,
@@ -42,12 +72,14 @@ func (m *MQTT) AddPublisher(topic string, fn func() (interface{}, error)) {
 	})
 }
 
+var log = tlogger.Logger("tqueue")
+
 var connectHandler mqtt.OnConnectHandler = func(client mqtt.Client) {
-	fmt.Println("Connected")
+	log.Info("MQTT connected")
 }
 
 var connectLostHandler mqtt.ConnectionLostHandler = func(client mqtt.Client, err error) {
-	fmt.Printf("Connect lost: %v", err)
+	log.Error("MQTT connection lost", slog.String("error", err.Error()))
 }
 
 func NewMqtt(config tconfig.MQTT) *MQTT {
@@ -82,18 +114,46 @@ func (m *MQTT) connectToBroker() (mqtt.Client, error) {
 func (m *MQTT) Publish(topic string, fn func() (interface{}, error)) {
 	out, err := fn()
 	if err == nil {
-		token := m.Client.Publish(topic, 0, false, out)
-		token.Wait()
+		_ = m.PublishContext(context.Background(), topic, out)
 	}
 }
 
-func (m *MQTT) Subscribe(topic string, fn mqtt.MessageHandler) {
+// PublishContext publishes out in a producer span, with config.TraceEnvelope the trace context travels
+// in an Envelope.
+func (m *MQTT) PublishContext(ctx context.Context, topic string, out interface{}) (err error) {
+	ctx, span := ttrace.Start(ctx, topic+" publish", trace.WithSpanKind(trace.SpanKindProducer))
+	span.SetAttributes(
+		semconv.MessagingSystem("mqtt"),
+		semconv.MessagingDestinationName(topic),
+		semconv.MessagingOperationPublish,
+	)
+	defer func() { ttrace.End(span, err) }()
+
+	if m.config.TraceEnvelope {
+		if out, err = wrap(ctx, out); err != nil {
+			return terror.Wrap("wrap", terror.NewBadRequest(err.Error()))
+		}
+	}
+	token := m.Client.Publish(topic, 0, false, out)
+	if token.Wait() && token.Error() != nil {
+		return terror.NewInternalf("m.Client.Publish", token.Error())
+	}
+	tmetrics.MQTTPublished(topic)
+	return nil
+}
+
+// Subscribe subscribes fn to topic and returns the error of a subscribe the broker did not acknowledge.
+func (m *MQTT) Subscribe(topic string, fn mqtt.MessageHandler) error {
 	token := m.Client.Subscribe(topic, 1, fn)
-	token.Wait()
-	fmt.Println("Subscribed to topic: ", topic)
+	if token.Wait() && token.Error() != nil {
+		log.Error("MQTT subscribe failed", slog.String("topic", topic), slog.String("error", token.Error().Error()))
+		return terror.NewInternalf(fmt.Sprintf("m.Client.Subscribe - topic: %s", topic), token.Error())
+	}
+	log.Info("MQTT subscribed", slog.String("topic", topic))
+	return nil
 }
 
 func (m *MQTT) Disconnect() {
-	fmt.Println("Disconnecting...")
+	log.Info("MQTT disconnecting")
 	m.Client.Disconnect(250)
 }
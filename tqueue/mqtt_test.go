@@ -0,0 +1,48 @@
+package tqueue
+
+import (
+	"errors"
+	"testing"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/WojciechWiderski/tofu/terror"
+)
+
+// client is an mqtt.Client whose Subscribe completes with err.
+type client struct {
+	mqtt.Client
+	err error
+}
+
+func (c client) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	return &token{err: c.err}
+}
+
+type token struct {
+	mqtt.Token
+	err error
+}
+
+func (t *token) Wait() bool   { return true }
+func (t *token) Error() error { return t.err }
+
+func TestMQTT_Subscribe(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantErr error
+	}{
+		{name: "acknowledged"},
+		{name: "refused", err: errors.New("not authorized"), wantErr: terror.Internal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &MQTT{Client: client{err: tt.err}}
+			err := m.Subscribe("topic", nil)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Errorf("Subscribe() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package ttrace
+
+import (
+	"context"
+	"reflect"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/WojciechWiderski/tofu/tdatabase"
+)
+
+// DB starts a client span for every call to the wrapped DBOperations.
+type DB struct {
+	tdatabase.DBOperations
+	backend string
+}
+
+// InstrumentDB wraps db, the backend attribute is the package name of the store behind db, e.g. sqlite or
+// memory, see tdatabase.Backend.
+func InstrumentDB(db tdatabase.DBOperations) *DB {
+	if instrumented, ok := db.(*DB); ok {
+		return instrumented
+	}
+	return &DB{DBOperations: db, backend: tdatabase.Backend(db)}
+}
+
+// Unwrap returns the wrapped DBOperations, e.g. to reach the gorm connection of a backend.
+func (d *DB) Unwrap() tdatabase.DBOperations {
+	return d.DBOperations
+}
+
+func (d *DB) Add(ctx context.Context, in interface{}) (err error) {
+	ctx, span := d.start(ctx, "add", in)
+	defer func() { End(span, err) }()
+	return d.DBOperations.Add(ctx, in)
+}
+
+func (d *DB) AddMany(ctx context.Context, in []interface{}) (_ []tdatabase.Result, err error) {
+	ctx, span := d.start(ctx, "add_many", nil)
+	defer func() { End(span, err) }()
+	return d.DBOperations.AddMany(ctx, in)
+}
+
+func (d *DB) GetOne(ctx context.Context, in interface{}, params tdatabase.ParamRequest) (_ interface{}, err error) {
+	ctx, span := d.start(ctx, "get_one", in)
+	defer func() { End(span, err) }()
+	return d.DBOperations.GetOne(ctx, in, params)
+}
+
+func (d *DB) GetMany(ctx context.Context, in interface{}, params tdatabase.ParamRequest) (_ []interface{}, err error) {
+	ctx, span := d.start(ctx, "get_many", in)
+	defer func() { End(span, err) }()
+	return d.DBOperations.GetMany(ctx, in, params)
+}
+
+func (d *DB) Count(ctx context.Context, in interface{}, params tdatabase.ParamRequest) (_ int64, err error) {
+	ctx, span := d.start(ctx, "count", in)
+	defer func() { End(span, err) }()
+	return d.DBOperations.Count(ctx, in, params)
+}
+
+func (d *DB) Update(ctx context.Context, update interface{}, in interface{}, id interface{}) (err error) {
+	ctx, span := d.start(ctx, "update", in)
+	defer func() { End(span, err) }()
+	return d.DBOperations.Update(ctx, update, in, id)
+}
+
+func (d *DB) Delete(ctx context.Context, in interface{}, id interface{}) (err error) {
+	ctx, span := d.start(ctx, "delete", in)
+	defer func() { End(span, err) }()
+	return d.DBOperations.Delete(ctx, in, id)
+}
+
+func (d *DB) DeleteMany(ctx context.Context, in interface{}, params tdatabase.ParamRequest) (_ []tdatabase.Result, err error) {
+	ctx, span := d.start(ctx, "delete_many", in)
+	defer func() { End(span, err) }()
+	return d.DBOperations.DeleteMany(ctx, in, params)
+}
+
+func (d *DB) Ping(ctx context.Context) (err error) {
+	ctx, span := d.start(ctx, "ping", nil)
+	defer func() { End(span, err) }()
+	return d.DBOperations.Ping(ctx)
+}
+
+// WithTx hands fn the transaction wrapped as well, so its calls are children of the tx span.
+func (d *DB) WithTx(ctx context.Context, fn func(ctx context.Context, tx tdatabase.DBOperations) error) (err error) {
+	ctx, span := d.start(ctx, "tx", nil)
+	defer func() { End(span, err) }()
+	return d.DBOperations.WithTx(ctx, func(ctx context.Context, tx tdatabase.DBOperations) error {
+		return fn(ctx, &DB{DBOperations: tx, backend: d.backend})
+	})
+}
+
+func (d *DB) start(ctx context.Context, operation string, in interface{}) (context.Context, trace.Span) {
+	ctx, span := Start(ctx, "db "+operation, trace.WithSpanKind(trace.SpanKindClient))
+	span.SetAttributes(AttrBackend.String(d.backend), AttrOperation.String(operation))
+	if in != nil {
+		t := reflect.TypeOf(in)
+		for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+			t = t.Elem()
+		}
+		span.SetAttributes(AttrModel.String(t.Name()))
+	}
+	return ctx, span
+}
@@ -0,0 +1,110 @@
+package ttrace
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/WojciechWiderski/tofu/tdatabase"
+	"github.com/WojciechWiderski/tofu/tdatabase/memory"
+	"github.com/WojciechWiderski/tofu/tmetrics"
+	"github.com/WojciechWiderski/tofu/tmodel"
+)
+
+type item struct {
+	ID   uint
+	Name string
+}
+
+func TestDB(t *testing.T) {
+	exporter, _ := newExporter(t, sdktrace.WithSyncer)
+	store := memory.New(tmodel.NewModels(tmodel.NewModel(&item{}, "item")))
+	if err := store.Migrate(); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	// Wrapped around tmetrics as Run does, the backend is still the store behind it.
+	db := InstrumentDB(tmetrics.InstrumentDB(store))
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		call       func() error
+		wantSpans  []string
+		wantStatus codes.Code
+	}{
+		{
+			name:      "add",
+			call:      func() error { return db.Add(ctx, &item{Name: "a"}) },
+			wantSpans: []string{"db add"},
+		},
+		{
+			name: "get one of a missing record",
+			call: func() error {
+				_, err := db.GetOne(ctx, &item{}, tdatabase.ParamRequest{By: "id", Value: 9})
+				return err
+			},
+			wantSpans:  []string{"db get_one"},
+			wantStatus: codes.Error,
+		},
+		{
+			name: "calls in a transaction",
+			call: func() error {
+				return db.WithTx(ctx, func(ctx context.Context, tx tdatabase.DBOperations) error {
+					return tx.Delete(ctx, &item{}, 1)
+				})
+			},
+			wantSpans: []string{"db delete", "db tx"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter.Reset()
+			err := tt.call()
+			if (err != nil) != (tt.wantStatus == codes.Error) {
+				t.Fatalf("call error = %v, want status %s", err, tt.wantStatus)
+			}
+
+			spans := exporter.GetSpans()
+			if len(spans) != len(tt.wantSpans) {
+				t.Fatalf("spans = %v, want %v", spans.Snapshots(), tt.wantSpans)
+			}
+			for i, span := range spans {
+				if span.Name != tt.wantSpans[i] {
+					t.Errorf("span %d = %s, want %s", i, span.Name, tt.wantSpans[i])
+				}
+				if !hasAttribute(span.Attributes, AttrBackend.String("memory")) {
+					t.Errorf("span %s attributes = %v, want backend memory", span.Name, span.Attributes)
+				}
+			}
+			if last := spans[len(spans)-1]; last.Status.Code != tt.wantStatus {
+				t.Errorf("span %s status = %s, want %s", last.Name, last.Status.Code, tt.wantStatus)
+			}
+			if len(spans) > 1 && spans[0].Parent.SpanID() != spans[1].SpanContext.SpanID() {
+				t.Errorf("span %s is not a child of %s", spans[0].Name, spans[1].Name)
+			}
+		})
+	}
+}
+
+func TestInstrumentDBTwice(t *testing.T) {
+	store := memory.New(tmodel.NewModels())
+	db := InstrumentDB(store)
+	if again := InstrumentDB(db); again != db {
+		t.Errorf("InstrumentDB() wrapped an instrumented db again")
+	}
+	if db.Unwrap() != store {
+		t.Errorf("Unwrap() = %v, want the store", db.Unwrap())
+	}
+}
+
+func hasAttribute(attrs []attribute.KeyValue, want attribute.KeyValue) bool {
+	for _, attr := range attrs {
+		if attr == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+// Package ttrace sets up OpenTelemetry tracing for tofu and holds the helpers its packages trace with.
+package ttrace
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/WojciechWiderski/tofu/tconfig"
+)
+
+const instrumentationName = "github.com/WojciechWiderski/tofu"
+
+// Attribute keys of the tofu spans next to the semantic conventions.
+const (
+	AttrModel     = attribute.Key("tofu.model")
+	AttrRouteType = attribute.Key("tofu.route_type")
+	AttrHook      = attribute.Key("tofu.hook")
+	AttrBackend   = attribute.Key("tofu.db.backend")
+	AttrOperation = attribute.Key("tofu.db.operation")
+)
+
+// Tracer returns the tofu tracer of the global provider, it does nothing until NewProvider is called.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// NewProvider builds a provider exporting to the exporter of config and registers it globally with the
+// W3C trace context and baggage propagators. opts are applied last, e.g. in tests
+// sdktrace.WithSyncer(tracetest.NewInMemoryExporter()) with the none exporter. Shut the provider down to
+// flush the spans.
+func NewProvider(ctx context.Context, config tconfig.Tracing, opts ...sdktrace.TracerProviderOption) (*sdktrace.TracerProvider, error) {
+	serviceName := config.ServiceName
+	if serviceName == "" {
+		serviceName = "tofu"
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("resource.Merge: %w", err)
+	}
+
+	sampler := sdktrace.AlwaysSample()
+	if config.SampleRatio > 0 && config.SampleRatio < 1 {
+		sampler = sdktrace.TraceIDRatioBased(config.SampleRatio)
+	}
+	providerOpts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+	}
+
+	switch strings.ToLower(config.Exporter) {
+	case "", "none":
+	case "stdout":
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, fmt.Errorf("stdouttrace.New: %w", err)
+		}
+		providerOpts = append(providerOpts, sdktrace.WithBatcher(exporter))
+	case "otlp":
+		var clientOpts []otlptracehttp.Option
+		if config.Endpoint != "" {
+			clientOpts = append(clientOpts, otlptracehttp.WithEndpoint(config.Endpoint))
+		}
+		if config.Insecure {
+			clientOpts = append(clientOpts, otlptracehttp.WithInsecure())
+		}
+		exporter, err := otlptracehttp.New(ctx, clientOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("otlptracehttp.New: %w", err)
+		}
+		providerOpts = append(providerOpts, sdktrace.WithBatcher(exporter))
+	default:
+		return nil, fmt.Errorf("wrong trace exporter %s", config.Exporter)
+	}
+
+	provider := sdktrace.NewTracerProvider(append(providerOpts, opts...)...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider, nil
+}
+
+// Start starts a span of the tofu tracer.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, opts...)
+}
+
+// End records err on span and ends it, meant for defer with a named error result.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Inject writes the trace context of ctx to carrier.
+func Inject(ctx context.Context, carrier map[string]string) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(carrier))
+}
+
+// Extract returns ctx with the remote trace context read from carrier.
+func Extract(ctx context.Context, carrier map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(carrier))
+}
@@ -0,0 +1,110 @@
+package ttrace
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/WojciechWiderski/tofu/tconfig"
+)
+
+func newExporter(t *testing.T, opt func(sdktrace.SpanExporter) sdktrace.TracerProviderOption) (*tracetest.InMemoryExporter, *sdktrace.TracerProvider) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider, err := NewProvider(context.Background(), tconfig.Tracing{}, opt(exporter))
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+	return exporter, provider
+}
+
+func TestNewProvider(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  tconfig.Tracing
+		wantErr bool
+	}{
+		{name: "no exporter", config: tconfig.Tracing{}},
+		{name: "none", config: tconfig.Tracing{Exporter: "none", SampleRatio: 0.5}},
+		{name: "stdout", config: tconfig.Tracing{Exporter: "STDOUT"}},
+		{name: "wrong exporter", config: tconfig.Tracing{Exporter: "nope"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, err := NewProvider(context.Background(), tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewProvider() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if provider != nil {
+				_ = provider.Shutdown(context.Background())
+			}
+		})
+	}
+}
+
+func TestProviderShutdownFlushes(t *testing.T) {
+	exporter, provider := newExporter(t, func(e sdktrace.SpanExporter) sdktrace.TracerProviderOption {
+		return sdktrace.WithBatcher(keepSpans{e})
+	})
+
+	_, span := Start(context.Background(), "batched")
+	span.End()
+	if err := provider.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if spans := exporter.GetSpans(); len(spans) != 1 || spans[0].Name != "batched" {
+		t.Errorf("exported spans = %v, want the batched span", spans.Snapshots())
+	}
+}
+
+// keepSpans keeps the spans of the in-memory exporter on shutdown, which would otherwise reset them.
+type keepSpans struct {
+	sdktrace.SpanExporter
+}
+
+func (keepSpans) Shutdown(context.Context) error {
+	return nil
+}
+
+func TestInjectExtract(t *testing.T) {
+	newExporter(t, sdktrace.WithSyncer)
+
+	ctx, span := Start(context.Background(), "publish")
+	defer span.End()
+	carrier := map[string]string{}
+	Inject(ctx, carrier)
+
+	got := trace.SpanContextFromContext(Extract(context.Background(), carrier))
+	if !got.IsRemote() || got.TraceID() != span.SpanContext().TraceID() {
+		t.Errorf("Extract() = %v, want the trace %s", got, span.SpanContext().TraceID())
+	}
+}
+
+func TestEnd(t *testing.T) {
+	exporter, _ := newExporter(t, sdktrace.WithSyncer)
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus codes.Code
+	}{
+		{name: "ok", wantStatus: codes.Unset},
+		{name: "error", err: context.Canceled, wantStatus: codes.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter.Reset()
+			_, span := Start(context.Background(), tt.name)
+			End(span, tt.err)
+			spans := exporter.GetSpans()
+			if len(spans) != 1 || spans[0].Status.Code != tt.wantStatus {
+				t.Errorf("spans = %v, want one with status %s", spans.Snapshots(), tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+// Package tvalidate checks model payloads against rules declared in `validate` struct tags.
+//
+// Rules are separated by commas: required, min=N, max=N, len=N, oneof=a b c, regex=pattern and the
+// cross-field comparisons eqfield, nefield, gtfield, gtefield, ltfield and ltefield taking a Go field name,
+// e.g. `validate:"required,ltefield=MaxExperience"`. min and max compare numbers by value and strings,
+// slices and maps by length. regex has to be the last rule because the pattern may contain commas.
+package tvalidate
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WojciechWiderski/tofu/terror"
+)
+
+const tagName = "validate"
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	patterns sync.Map
+)
+
+// Struct validates in and returns every failing field. In partial mode zero value fields are skipped,
+// which is used for updates where only the non-zero fields are written.
+func Struct(in interface{}, partial bool) []terror.FieldError {
+	value := reflect.ValueOf(in)
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var errs []terror.FieldError
+	validateStruct(value, "", partial, &errs)
+	return errs
+}
+
+func validateStruct(value reflect.Value, prefix string, partial bool, errs *[]terror.FieldError) {
+	typ := value.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fieldValue := value.Field(i)
+
+		name := prefix + jsonName(field)
+		if field.Anonymous && field.Tag.Get("json") == "" {
+			name = strings.TrimSuffix(prefix, ".")
+		}
+
+		if tag := field.Tag.Get(tagName); tag != "" && tag != "-" {
+			if !(partial && fieldValue.IsZero()) {
+				for _, rule := range parseRules(tag) {
+					if err := rule.check(value, fieldValue, partial); err != "" {
+						*errs = append(*errs, terror.FieldError{Field: name, Rule: rule.name, Message: err})
+						// The other rules say nothing useful about a missing value.
+						if rule.name == "required" {
+							break
+						}
+					}
+				}
+			}
+		}
+
+		nested(fieldValue, name, field.Anonymous, partial, errs)
+	}
+}
+
+// nested validates structs, pointers to structs and slices of them inside a model, e.g. Task.Dates.
+func nested(value reflect.Value, name string, anonymous bool, partial bool, errs *[]terror.FieldError) {
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		if value.Type() == timeType {
+			return
+		}
+		prefix := name + "."
+		if anonymous && name == "" {
+			prefix = ""
+		}
+		validateStruct(value, prefix, partial, errs)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			nested(value.Index(i), fmt.Sprintf("%s[%d]", name, i), false, partial, errs)
+		}
+	}
+}
+
+type rule struct {
+	name  string
+	param string
+}
+
+func parseRules(tag string) []rule {
+	var rules []rule
+	for tag != "" {
+		var part string
+		if strings.HasPrefix(tag, "regex=") {
+			part, tag = tag, ""
+		} else {
+			part, tag, _ = strings.Cut(tag, ",")
+		}
+		name, param, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if name != "" {
+			rules = append(rules, rule{name: name, param: param})
+		}
+	}
+	return rules
+}
+
+// check returns an empty string when the rule passes and the message otherwise.
+func (r rule) check(parent reflect.Value, value reflect.Value, partial bool) string {
+	switch r.name {
+	case "required":
+		if value.IsZero() {
+			return "is required"
+		}
+	case "min", "max", "len":
+		limit, err := strconv.ParseFloat(r.param, 64)
+		if err != nil {
+			return fmt.Sprintf("wrong %s rule parameter %s", r.name, r.param)
+		}
+		size, isLength := measure(value)
+		if isLength && r.name == "len" && size != limit {
+			return fmt.Sprintf("must have length %s", r.param)
+		}
+		if r.name == "min" && size < limit {
+			if isLength {
+				return fmt.Sprintf("must have at least %s items", r.param)
+			}
+			return fmt.Sprintf("must be at least %s", r.param)
+		}
+		if r.name == "max" && size > limit {
+			if isLength {
+				return fmt.Sprintf("must have at most %s items", r.param)
+			}
+			return fmt.Sprintf("must be at most %s", r.param)
+		}
+	case "oneof":
+		current := fmt.Sprint(indirect(value).Interface())
+		for _, allowed := range strings.Fields(r.param) {
+			if current == allowed {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of %s", strings.Join(strings.Fields(r.param), ", "))
+	case "regex":
+		pattern, err := compile(r.param)
+		if err != nil {
+			return fmt.Sprintf("wrong regex rule parameter %s", r.param)
+		}
+		if !pattern.MatchString(fmt.Sprint(indirect(value).Interface())) {
+			return fmt.Sprintf("must match %s", r.param)
+		}
+	case "eqfield", "nefield", "gtfield", "gtefield", "ltfield", "ltefield":
+		other := parent.FieldByName(r.param)
+		if !other.IsValid() {
+			return fmt.Sprintf("wrong %s rule parameter %s", r.name, r.param)
+		}
+		if partial && other.IsZero() {
+			return ""
+		}
+		c, ok := compare(value, other)
+		if !ok {
+			return fmt.Sprintf("cannot be compared with %s", r.param)
+		}
+		switch {
+		case r.name == "eqfield" && c != 0:
+			return fmt.Sprintf("must be equal to %s", r.param)
+		case r.name == "nefield" && c == 0:
+			return fmt.Sprintf("must not be equal to %s", r.param)
+		case r.name == "gtfield" && c <= 0:
+			return fmt.Sprintf("must be greater than %s", r.param)
+		case r.name == "gtefield" && c < 0:
+			return fmt.Sprintf("must be greater than or equal to %s", r.param)
+		case r.name == "ltfield" && c >= 0:
+			return fmt.Sprintf("must be less than %s", r.param)
+		case r.name == "ltefield" && c > 0:
+			return fmt.Sprintf("must be less than or equal to %s", r.param)
+		}
+	default:
+		return fmt.Sprintf("unknown rule %s", r.name)
+	}
+	return ""
+}
+
+// measure returns the number used by min, max and len and whether it is a length.
+func measure(value reflect.Value) (float64, bool) {
+	value = indirect(value)
+	switch value.Kind() {
+	case reflect.String:
+		return float64(len([]rune(value.String()))), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(value.Len()), true
+	}
+	n, _ := number(value)
+	return n, false
+}
+
+func compare(a reflect.Value, b reflect.Value) (int, bool) {
+	a, b = indirect(a), indirect(b)
+	if a.Type() == timeType && b.Type() == timeType {
+		return a.Interface().(time.Time).Compare(b.Interface().(time.Time)), true
+	}
+	if a.Kind() == reflect.String && b.Kind() == reflect.String {
+		return strings.Compare(a.String(), b.String()), true
+	}
+
+	x, okA := number(a)
+	y, okB := number(b)
+	if !okA || !okB {
+		return 0, false
+	}
+	switch {
+	case x < y:
+		return -1, true
+	case x > y:
+		return 1, true
+	}
+	return 0, true
+}
+
+func number(value reflect.Value) (float64, bool) {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), true
+	}
+	return 0, false
+}
+
+func indirect(value reflect.Value) reflect.Value {
+	for value.Kind() == reflect.Ptr && !value.IsNil() {
+		value = value.Elem()
+	}
+	return value
+}
+
+func compile(pattern string) (*regexp.Regexp, error) {
+	if cached, ok := patterns.Load(pattern); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(pattern, compiled)
+	return compiled, nil
+}
+
+func jsonName(field reflect.StructField) string {
+	if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+	return field.Name
+}
@@ -0,0 +1,148 @@
+package tvalidate
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/WojciechWiderski/tofu/terror"
+)
+
+type Base struct {
+	Code string `json:"code" validate:"len=3"`
+}
+
+type date struct {
+	Day int `json:"day" validate:"min=1,max=31"`
+}
+
+type task struct {
+	Base
+	Name  string    `json:"name" validate:"required,max=5"`
+	Kind  string    `json:"kind" validate:"oneof=home work"`
+	Slug  string    `json:"slug" validate:"regex=^[a-z]{1,3}$"`
+	Min   int       `json:"min" validate:"ltefield=Max"`
+	Max   int       `json:"max"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end" validate:"gtfield=Start"`
+	Tags  []string  `json:"tags" validate:"max=2"`
+	Dates []date    `json:"dates"`
+	Next  *date     `json:"next"`
+}
+
+func valid() task {
+	return task{
+		Base: Base{Code: "abc"},
+		Name: "task", Kind: "home", Slug: "ab", Min: 1, Max: 2,
+		Start: time.Unix(0, 0), End: time.Unix(10, 0),
+	}
+}
+
+func TestStruct(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      func() interface{}
+		partial bool
+		want    []terror.FieldError
+	}{
+		{name: "valid", in: func() interface{} { v := valid(); return &v }},
+		{name: "nil pointer", in: func() interface{} { return (*task)(nil) }},
+		{name: "not a struct", in: func() interface{} { return 5 }},
+		{
+			name: "required stops the other rules",
+			in:   func() interface{} { v := valid(); v.Name = ""; return v },
+			want: []terror.FieldError{{Field: "name", Rule: "required", Message: "is required"}},
+		},
+		{
+			name: "string length and embedded field",
+			in:   func() interface{} { v := valid(); v.Name, v.Code = "toolong", "ab"; return v },
+			want: []terror.FieldError{
+				{Field: "code", Rule: "len", Message: "must have length 3"},
+				{Field: "name", Rule: "max", Message: "must have at most 5 items"},
+			},
+		},
+		{
+			name: "oneof, regex and slice length",
+			in: func() interface{} {
+				v := valid()
+				v.Kind, v.Slug, v.Tags = "play", "ABC", []string{"a", "b", "c"}
+				return v
+			},
+			want: []terror.FieldError{
+				{Field: "kind", Rule: "oneof", Message: "must be one of home, work"},
+				{Field: "slug", Rule: "regex", Message: "must match ^[a-z]{1,3}$"},
+				{Field: "tags", Rule: "max", Message: "must have at most 2 items"},
+			},
+		},
+		{
+			name: "cross-field numbers and times",
+			in:   func() interface{} { v := valid(); v.Min, v.End = 3, time.Unix(0, 0); return v },
+			want: []terror.FieldError{
+				{Field: "min", Rule: "ltefield", Message: "must be less than or equal to Max"},
+				{Field: "end", Rule: "gtfield", Message: "must be greater than Start"},
+			},
+		},
+		{
+			name: "nested slices and pointers",
+			in:   func() interface{} { v := valid(); v.Dates, v.Next = []date{{Day: 1}, {Day: 40}}, &date{}; return v },
+			want: []terror.FieldError{
+				{Field: "dates[1].day", Rule: "max", Message: "must be at most 31"},
+				{Field: "next.day", Rule: "min", Message: "must be at least 1"},
+			},
+		},
+		{
+			name:    "partial skips zero fields",
+			in:      func() interface{} { return &task{Slug: "abc"} },
+			partial: true,
+		},
+		{
+			name:    "partial checks the sent fields",
+			in:      func() interface{} { return &task{Min: 5, Max: 1, Kind: "play"} },
+			partial: true,
+			want: []terror.FieldError{
+				{Field: "kind", Rule: "oneof", Message: "must be one of home, work"},
+				{Field: "min", Rule: "ltefield", Message: "must be less than or equal to Max"},
+			},
+		},
+		{
+			name: "wrong rules",
+			in: func() interface{} {
+				return &struct {
+					A int `validate:"min=x"`
+					B int `validate:"nope"`
+					C int `validate:"eqfield=Missing"`
+				}{}
+			},
+			want: []terror.FieldError{
+				{Field: "A", Rule: "min", Message: "wrong min rule parameter x"},
+				{Field: "B", Rule: "nope", Message: "unknown rule nope"},
+				{Field: "C", Rule: "eqfield", Message: "wrong eqfield rule parameter Missing"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Struct(tt.in(), tt.partial); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Struct() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want []rule
+	}{
+		{tag: "required", want: []rule{{name: "required"}}},
+		{tag: "required, min=1,max=5", want: []rule{{name: "required"}, {name: "min", param: "1"}, {name: "max", param: "5"}}},
+		{tag: "required,regex=^[a-z]{1,3}$", want: []rule{{name: "required"}, {name: "regex", param: "^[a-z]{1,3}$"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			if got := parseRules(tt.tag); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRules() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}